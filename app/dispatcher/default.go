@@ -24,11 +24,35 @@ func NewDefaultDispatcher(ohm *outbound.Manager, router *Router) *DefaultDispatc
 
 // Dispatch создает соединение через outbound
 func (d *DefaultDispatcher) Dispatch(ctx context.Context, dest commnet.Destination) (net.Conn, error) {
+	handler, err := d.selectHandler(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler.Dial(ctx, dest)
+}
+
+// Bind принимает входящее соединение от dest через outbound, выбранный маршрутизацией
+func (d *DefaultDispatcher) Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error) {
+	handler, err := d.selectHandler(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	binder, ok := handler.(outbound.Binder)
+	if !ok {
+		return nil, fmt.Errorf("outbound %s does not support BIND", handler.Tag())
+	}
+	return binder.Bind(ctx, dest)
+}
+
+// selectHandler выбирает outbound для dest
+func (d *DefaultDispatcher) selectHandler(ctx context.Context, dest commnet.Destination) (outbound.Handler, error) {
 	// Выбираем outbound через router
 	var handler outbound.Handler
 
 	if d.router != nil {
-		tag := d.router.MatchOutbound(dest)
+		tag := d.router.MatchOutbound(ctx, dest)
 		if tag != "" {
 			handler = d.ohm.Select(tag)
 		}
@@ -42,7 +66,7 @@ func (d *DefaultDispatcher) Dispatch(ctx context.Context, dest commnet.Destinati
 		}
 	}
 
-	return handler.Dial(ctx, dest)
+	return handler, nil
 }
 
 // DispatchWithTag создает соединение через конкретный outbound по тегу
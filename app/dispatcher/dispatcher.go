@@ -11,3 +11,13 @@ type Interface interface {
 	// Dispatch создает соединение к destination через соответствующий outbound
 	Dispatch(ctx context.Context, dest commnet.Destination) (net.Conn, error)
 }
+
+// TagDispatcher dispatcher, умеющий отправить соединение через outbound по тегу, минуя routing
+type TagDispatcher interface {
+	DispatchWithTag(ctx context.Context, dest commnet.Destination, tag string) (net.Conn, error)
+}
+
+// Binder dispatcher, умеющий принять входящее соединение от dest через outbound (SOCKS BIND)
+type Binder interface {
+	Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error)
+}
@@ -1,8 +1,10 @@
 package dispatcher
 
 import (
+	"context"
 	"fmt"
 	commnet "koria-core/common/net"
+	"koria-core/common/session"
 	v2config "koria-core/config/v2"
 	"log"
 	"net"
@@ -18,11 +20,13 @@ type Router struct {
 
 // RoutingRule внутреннее представление правила маршрутизации
 type RoutingRule struct {
-	domainPatterns []*regexp.Regexp
-	ipCIDRs        []*net.IPNet
-	portRanges     []PortRange
-	network        string // "tcp", "udp", ""
-	outboundTag    string
+	domains     *DomainMatcher
+	ipCIDRs     []*net.IPNet
+	sourceCIDRs []*net.IPNet // адрес клиента
+	users       map[string]bool
+	portRanges  []PortRange
+	network     string // "tcp", "udp", ""
+	outboundTag string
 }
 
 // PortRange диапазон портов
@@ -62,22 +66,58 @@ func parseRoutingRule(config v2config.RoutingRule) (RoutingRule, error) {
 	}
 
 	// Парсим domain patterns
-	for _, pattern := range config.Domain {
-		regex, err := domainPatternToRegex(pattern)
+	if len(config.Domain) > 0 {
+		domains, err := NewDomainMatcher(config.Domain)
 		if err != nil {
-			return rule, fmt.Errorf("invalid domain pattern %s: %w", pattern, err)
+			return rule, err
 		}
-		rule.domainPatterns = append(rule.domainPatterns, regex)
+		rule.domains = domains
 	}
 
 	// Парсим IP CIDRs
-	for _, cidr := range config.IP {
+	ipCIDRs, err := parseCIDRList(config.IP)
+	if err != nil {
+		return rule, err
+	}
+	rule.ipCIDRs = ipCIDRs
+
+	// Парсим сети источника
+	sourceCIDRs, err := parseCIDRList(config.Source)
+	if err != nil {
+		return rule, err
+	}
+	rule.sourceCIDRs = sourceCIDRs
+
+	// Пользователи inbound
+	if len(config.User) > 0 {
+		rule.users = make(map[string]bool, len(config.User))
+		for _, user := range config.User {
+			rule.users[user] = true
+		}
+	}
+
+	// Парсим port ranges
+	if config.Port != "" {
+		ranges, err := parsePortRanges(config.Port)
+		if err != nil {
+			return rule, fmt.Errorf("invalid port specification %s: %w", config.Port, err)
+		}
+		rule.portRanges = ranges
+	}
+
+	return rule, nil
+}
+
+// parseCIDRList парсит список CIDR, одиночный IP считается сетью /32 или /128
+func parseCIDRList(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range list {
 		_, ipNet, err := net.ParseCIDR(cidr)
 		if err != nil {
 			// Попробуем как одиночный IP
 			ip := net.ParseIP(cidr)
 			if ip == nil {
-				return rule, fmt.Errorf("invalid IP/CIDR %s: %w", cidr, err)
+				return nil, fmt.Errorf("invalid IP/CIDR %s: %w", cidr, err)
 			}
 			// Создаем /32 или /128 CIDR
 			if ip.To4() != nil {
@@ -86,19 +126,37 @@ func parseRoutingRule(config v2config.RoutingRule) (RoutingRule, error) {
 				_, ipNet, _ = net.ParseCIDR(cidr + "/128")
 			}
 		}
-		rule.ipCIDRs = append(rule.ipCIDRs, ipNet)
+		nets = append(nets, ipNet)
 	}
+	return nets, nil
+}
 
-	// Парсим port ranges
-	if config.Port != "" {
-		ranges, err := parsePortRanges(config.Port)
+// DomainMatcher набор доменных шаблонов в синтаксисе правил routing
+type DomainMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+// NewDomainMatcher разбирает доменные шаблоны (см. domainPatternToRegex)
+func NewDomainMatcher(patterns []string) (*DomainMatcher, error) {
+	matcher := &DomainMatcher{}
+	for _, pattern := range patterns {
+		regex, err := domainPatternToRegex(pattern)
 		if err != nil {
-			return rule, fmt.Errorf("invalid port specification %s: %w", config.Port, err)
+			return nil, fmt.Errorf("invalid domain pattern %s: %w", pattern, err)
 		}
-		rule.portRanges = ranges
+		matcher.patterns = append(matcher.patterns, regex)
 	}
+	return matcher, nil
+}
 
-	return rule, nil
+// Match проверяет, совпадает ли домен хотя бы с одним шаблоном
+func (m *DomainMatcher) Match(domain string) bool {
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(domain) {
+			return true
+		}
+	}
+	return false
 }
 
 // domainPatternToRegex конвертирует domain pattern в regex
@@ -192,9 +250,12 @@ func parsePortRanges(portSpec string) ([]PortRange, error) {
 }
 
 // MatchOutbound возвращает тег outbound для destination
-func (r *Router) MatchOutbound(dest commnet.Destination) string {
+// Адрес клиента и пользователь для правил source и user берутся из сведений
+// о входящем соединении в ctx
+func (r *Router) MatchOutbound(ctx context.Context, dest commnet.Destination) string {
+	inbound := session.InboundFromContext(ctx)
 	for _, rule := range r.rules {
-		if r.matchRule(rule, dest) {
+		if r.matchRule(rule, inbound, dest) {
 			log.Printf("[Router] Matched rule -> %s for %s", rule.outboundTag, dest.String())
 			return rule.outboundTag
 		}
@@ -205,7 +266,7 @@ func (r *Router) MatchOutbound(dest commnet.Destination) string {
 }
 
 // matchRule проверяет совпадает ли destination с правилом
-func (r *Router) matchRule(rule RoutingRule, dest commnet.Destination) bool {
+func (r *Router) matchRule(rule RoutingRule, inbound *session.Inbound, dest commnet.Destination) bool {
 	// Проверка network (tcp/udp)
 	if rule.network != "" && string(dest.Network) != rule.network {
 		return false
@@ -226,17 +287,8 @@ func (r *Router) matchRule(rule RoutingRule, dest commnet.Destination) bool {
 	}
 
 	// Если есть domain patterns - проверяем domain
-	if len(rule.domainPatterns) > 0 {
-		matched := false
-		for _, pattern := range rule.domainPatterns {
-			if pattern.MatchString(dest.Address) {
-				matched = true
-				break
-			}
-		}
-		if !matched {
-			return false
-		}
+	if rule.domains != nil && !rule.domains.Match(dest.Address) {
+		return false
 	}
 
 	// Если есть IP CIDRs - проверяем IP
@@ -260,8 +312,33 @@ func (r *Router) matchRule(rule RoutingRule, dest commnet.Destination) bool {
 		}
 	}
 
+	// Если есть сети источника - проверяем адрес клиента
+	if len(rule.sourceCIDRs) > 0 {
+		// Адрес клиента неизвестен - правило не совпадает
+		source := inbound.SourceIP()
+		if source == nil {
+			return false
+		}
+
+		matched := false
+		for _, cidr := range rule.sourceCIDRs {
+			if cidr.Contains(source) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	// Если есть пользователи - проверяем, под кем клиент вошел в inbound
+	if len(rule.users) > 0 && (inbound == nil || !rule.users[inbound.User]) {
+		return false
+	}
+
 	// Если нет никаких условий - правило всегда совпадает (default)
-	if len(rule.domainPatterns) == 0 && len(rule.ipCIDRs) == 0 && len(rule.portRanges) == 0 && rule.network == "" {
+	if rule.domains == nil && len(rule.ipCIDRs) == 0 && len(rule.sourceCIDRs) == 0 && len(rule.users) == 0 && len(rule.portRanges) == 0 && rule.network == "" {
 		return true
 	}
 
@@ -15,6 +15,12 @@ type Handler interface {
 	Dial(ctx context.Context, dest commnet.Destination) (net.Conn, error)
 }
 
+// Binder необязательный интерфейс Handler: прием входящего TCP соединения от dest
+// (SOCKS BIND). Addr() слушателя - адрес, который сообщают клиенту для dest
+type Binder interface {
+	Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error)
+}
+
 // Manager управляет исходящими обработчиками
 type Manager struct {
 	defaultHandler Handler
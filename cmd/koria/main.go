@@ -1,27 +1,42 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"image/png"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"koria-core/app/dispatcher"
 	"koria-core/app/proxyman/inbound"
 	"koria-core/app/proxyman/outbound"
+	commnet "koria-core/common/net"
 	"koria-core/config"
 	v2config "koria-core/config/v2"
+	"koria-core/proxy/blackhole"
+	"koria-core/proxy/dns"
+	"koria-core/proxy/forward"
 	"koria-core/proxy/freedom"
 	proxyhttp "koria-core/proxy/http"
 	koriaproxy "koria-core/proxy/koria"
+	"koria-core/proxy/mixed"
+	"koria-core/protocol/minecraft"
+	"koria-core/protocol/steganography"
 	"koria-core/proxy/socks"
+	"koria-core/proxy/tproxy"
 	"koria-core/transport"
 )
 
@@ -128,40 +143,163 @@ func NewInstance(cfg *v2config.Config) (*Instance, error) {
 func (i *Instance) initOutbounds(configs []v2config.OutboundConfig) error {
 	ctx := context.Background()
 
-	for idx, cfg := range configs {
-		log.Printf("Initializing outbound [%d]: %s (%s)", idx, cfg.Tag, cfg.Protocol)
+	// Koria outbound подключается к серверу сразу при создании, поэтому outbound
+	// с dialer создается после того, через который он подключается
+	pending := make([]int, len(configs))
+	for idx := range configs {
+		pending[idx] = idx
+	}
 
-		var handler outbound.Handler
-		var err error
+	for len(pending) > 0 {
+		var deferred []int
+		for _, idx := range pending {
+			cfg := configs[idx]
+			if dialer := outboundDialer(cfg); dialer != "" && i.ohm.GetHandler(dialer) == nil {
+				deferred = append(deferred, idx)
+				continue
+			}
 
-		switch cfg.Protocol {
-		case "freedom":
-			handler = freedom.NewHandler(cfg.Tag)
+			log.Printf("Initializing outbound [%d]: %s (%s)", idx, cfg.Tag, cfg.Protocol)
 
-		case "koria":
-			handler, err = i.createKoriaOutbound(cfg)
+			handler, err := i.createOutbound(cfg)
 			if err != nil {
-				return fmt.Errorf("create koria outbound: %w", err)
+				return err
 			}
 
-		default:
-			return fmt.Errorf("unsupported outbound protocol: %s", cfg.Protocol)
+			if err := i.ohm.AddHandler(ctx, handler); err != nil {
+				return fmt.Errorf("add outbound handler: %w", err)
+			}
 		}
 
-		if err := i.ohm.AddHandler(ctx, handler); err != nil {
-			return fmt.Errorf("add outbound handler: %w", err)
+		if len(deferred) == len(pending) {
+			cfg := configs[deferred[0]]
+			return fmt.Errorf("outbound %s: dialer %q not found or forms a cycle", cfg.Tag, outboundDialer(cfg))
 		}
+		pending = deferred
+	}
 
-		// Первый outbound становится дефолтным
-		if idx == 0 {
-			i.ohm.SetDefaultHandler(handler)
-			log.Printf("  → Set as default outbound")
-		}
+	// Первый outbound становится дефолтным
+	if len(configs) > 0 {
+		i.ohm.SetDefaultHandler(i.ohm.GetHandler(configs[0].Tag))
+		log.Printf("  → Default outbound: %s", configs[0].Tag)
 	}
 
 	return nil
 }
 
+// createOutbound создает outbound handler по протоколу
+func (i *Instance) createOutbound(cfg v2config.OutboundConfig) (outbound.Handler, error) {
+	switch cfg.Protocol {
+	case "freedom":
+		handler, err := i.createFreedomOutbound(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create freedom outbound: %w", err)
+		}
+		return handler, nil
+
+	case "socks":
+		handler, err := i.createSocksOutbound(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create socks outbound: %w", err)
+		}
+		return handler, nil
+
+	case "http":
+		handler, err := i.createHTTPOutbound(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create http outbound: %w", err)
+		}
+		return handler, nil
+
+	case "koria":
+		handler, err := i.createKoriaOutbound(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create koria outbound: %w", err)
+		}
+		return handler, nil
+
+	case "blackhole":
+		return blackhole.NewHandler(cfg.Tag), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported outbound protocol: %s", cfg.Protocol)
+	}
+}
+
+// outboundDialer возвращает тег outbound, через который подключается Koria outbound
+func outboundDialer(cfg v2config.OutboundConfig) string {
+	if cfg.Protocol != "koria" {
+		return ""
+	}
+	dialer, _ := cfg.Settings["dialer"].(string)
+	return dialer
+}
+
+// createSocksOutbound создает SOCKS5 outbound handler
+func (i *Instance) createSocksOutbound(cfg v2config.OutboundConfig) (outbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.SocksOutboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal socks settings: %w", err)
+	}
+
+	log.Printf("  → Upstream SOCKS5 server %s:%d", settings.Address, settings.Port)
+
+	return socks.NewHandler(cfg.Tag, &socks.OutboundConfig{
+		Address: settings.Address,
+		Port:    settings.Port,
+		User:    settings.User,
+		Pass:    settings.Pass,
+	})
+}
+
+// createHTTPOutbound создает HTTP outbound handler
+func (i *Instance) createHTTPOutbound(cfg v2config.OutboundConfig) (outbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.HTTPOutboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal http settings: %w", err)
+	}
+
+	log.Printf("  → Upstream HTTP proxy %s:%d", settings.Address, settings.Port)
+
+	return proxyhttp.NewHandler(cfg.Tag, &proxyhttp.OutboundConfig{
+		Address: settings.Address,
+		Port:    settings.Port,
+		User:    settings.User,
+		Pass:    settings.Pass,
+	}), nil
+}
+
+// createFreedomOutbound создает Freedom outbound handler
+func (i *Instance) createFreedomOutbound(cfg v2config.OutboundConfig) (outbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.FreedomOutboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal freedom settings: %w", err)
+	}
+
+	if settings.ProxyProtocol != 0 {
+		log.Printf("  → PROXY protocol v%d header to destinations", settings.ProxyProtocol)
+	}
+
+	return freedom.NewHandlerWithConfig(cfg.Tag, &freedom.Config{
+		ProxyProtocol: settings.ProxyProtocol,
+	})
+}
+
 // createKoriaOutbound создает Koria outbound handler
 func (i *Instance) createKoriaOutbound(cfg v2config.OutboundConfig) (outbound.Handler, error) {
 	// Парсим settings
@@ -181,14 +319,68 @@ func (i *Instance) createKoriaOutbound(cfg v2config.OutboundConfig) (outbound.Ha
 		return nil, fmt.Errorf("parse user id: %w", err)
 	}
 
+	carrierMode, err := steganography.ParseSelectorMode(settings.CarrierMode)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := minecraft.ProfileByName(settings.Version)
+	if err != nil {
+		return nil, err
+	}
+
 	// Создаем transport client
 	clientConfig := &transport.ClientConfig{
-		ServerAddr: settings.Address,
-		ServerPort: settings.Port,
-		UserID:     userID,
+		ServerAddr:  settings.Address,
+		ServerPort:  settings.Port,
+		UserID:      userID,
+		Channels:    settings.Channels,
+		CarrierMode: carrierMode,
+		Version:     version,
+	}
+
+	if settings.Timeouts != nil {
+		timeouts := []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{"dial", settings.Timeouts.Dial, &clientConfig.DialTimeout},
+			{"login", settings.Timeouts.Login, &clientConfig.LoginTimeout},
+		}
+		for _, t := range timeouts {
+			if t.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(t.value)
+			if err != nil {
+				return nil, fmt.Errorf("parse timeouts.%s: %w", t.name, err)
+			}
+			*t.dst = d
+		}
+	}
+
+	// TCP соединение с сервером через другой outbound (upstream прокси или еще один Koria сервер)
+	if settings.Dialer != "" {
+		dialer := i.ohm.GetHandler(settings.Dialer)
+		if dialer == nil {
+			return nil, fmt.Errorf("dialer outbound not found: %s", settings.Dialer)
+		}
+		clientConfig.Dialer = func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, portStr, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			port, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port: %w", err)
+			}
+			return dialer.Dial(ctx, commnet.Destination{Network: commnet.Network(network), Address: host, Port: uint16(port)})
+		}
+		log.Printf("  → Dialing through outbound %s", settings.Dialer)
 	}
 
-	log.Printf("  → Connecting to %s:%d (UUID: %s)", settings.Address, settings.Port, userID)
+	log.Printf("  → Connecting to %s:%d as Minecraft %s (UUID: %s)", settings.Address, settings.Port, version, userID)
 
 	client, err := transport.Dial(context.Background(), clientConfig)
 	if err != nil {
@@ -212,10 +404,40 @@ func (i *Instance) initInbounds(configs []v2config.InboundConfig) error {
 
 		switch cfg.Protocol {
 		case "http":
-			handler = proxyhttp.NewServer(cfg.Tag, cfg.Listen, i.d)
+			handler, err = i.createHTTPInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create http inbound: %w", err)
+			}
 
 		case "socks":
-			handler = socks.NewServer(cfg.Tag, cfg.Listen, i.d)
+			handler, err = i.createSocksInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create socks inbound: %w", err)
+			}
+
+		case "mixed":
+			handler, err = i.createMixedInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create mixed inbound: %w", err)
+			}
+
+		case "redirect", "tproxy":
+			handler, err = i.createTProxyInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create %s inbound: %w", cfg.Protocol, err)
+			}
+
+		case "forward":
+			handler, err = i.createForwardInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create forward inbound: %w", err)
+			}
+
+		case "dns":
+			handler, err = i.createDNSInbound(cfg)
+			if err != nil {
+				return fmt.Errorf("create dns inbound: %w", err)
+			}
 
 		case "koria":
 			handler, err = i.createKoriaInbound(cfg)
@@ -235,6 +457,208 @@ func (i *Instance) initInbounds(configs []v2config.InboundConfig) error {
 	return nil
 }
 
+// createHTTPInbound создает HTTP inbound handler
+func (i *Instance) createHTTPInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.HTTPInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal http settings: %w", err)
+	}
+
+	if settings.AcceptProxyProtocol {
+		log.Printf("  → Expecting PROXY protocol header")
+	}
+
+	var accounts map[string]string
+	if len(settings.Accounts) > 0 {
+		accounts = make(map[string]string, len(settings.Accounts))
+		for _, account := range settings.Accounts {
+			// В Basic логин отделяется от пароля первым двоеточием
+			if account.User == "" || strings.Contains(account.User, ":") {
+				return nil, fmt.Errorf("invalid account %q: user must be non-empty and contain no colon", account.User)
+			}
+			accounts[account.User] = account.Pass
+		}
+		log.Printf("  → Basic proxy authentication, %d accounts", len(accounts))
+	}
+
+	return proxyhttp.NewServerWithConfig(cfg.Tag, &proxyhttp.Config{
+		Listen:              cfg.Listen,
+		AcceptProxyProtocol: settings.AcceptProxyProtocol,
+		Accounts:            accounts,
+	}, i.d), nil
+}
+
+// createSocksInbound создает SOCKS5 inbound handler
+func (i *Instance) createSocksInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.SocksInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal socks settings: %w", err)
+	}
+
+	if settings.AcceptProxyProtocol {
+		log.Printf("  → Expecting PROXY protocol header")
+	}
+
+	var accounts map[string]string
+	if len(settings.Accounts) > 0 {
+		accounts = make(map[string]string, len(settings.Accounts))
+		for _, account := range settings.Accounts {
+			if account.User == "" || len(account.User) > 255 || len(account.Pass) > 255 {
+				return nil, fmt.Errorf("invalid account %q: user must be 1-255 bytes, pass at most 255", account.User)
+			}
+			accounts[account.User] = account.Pass
+		}
+		log.Printf("  → Username/password authentication, %d accounts", len(accounts))
+	}
+
+	return socks.NewServerWithConfig(cfg.Tag, &socks.Config{
+		Listen:              cfg.Listen,
+		AcceptProxyProtocol: settings.AcceptProxyProtocol,
+		Accounts:            accounts,
+	}, i.d), nil
+}
+
+// createMixedInbound создает mixed inbound handler
+func (i *Instance) createMixedInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.MixedInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal mixed settings: %w", err)
+	}
+
+	if settings.AcceptProxyProtocol {
+		log.Printf("  → Expecting PROXY protocol header")
+	}
+
+	var accounts map[string]string
+	if len(settings.Accounts) > 0 {
+		accounts = make(map[string]string, len(settings.Accounts))
+		for _, account := range settings.Accounts {
+			// Учетная запись должна подходить и для RFC 1929, и для Basic
+			if account.User == "" || len(account.User) > 255 || len(account.Pass) > 255 || strings.Contains(account.User, ":") {
+				return nil, fmt.Errorf("invalid account %q: user must be 1-255 bytes without colon, pass at most 255", account.User)
+			}
+			accounts[account.User] = account.Pass
+		}
+		log.Printf("  → Username/password authentication, %d accounts", len(accounts))
+	}
+
+	return mixed.NewServer(cfg.Tag, &mixed.Config{
+		Listen:              cfg.Listen,
+		AcceptProxyProtocol: settings.AcceptProxyProtocol,
+		Accounts:            accounts,
+	}, i.d), nil
+}
+
+// createTProxyInbound создает прозрачный прокси: режим совпадает с именем протокола
+func (i *Instance) createTProxyInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.TProxyInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal %s settings: %w", cfg.Protocol, err)
+	}
+
+	tcp, udp := commnet.ParseNetworkList(settings.Network)
+	if !tcp && !udp {
+		return nil, fmt.Errorf("invalid network %q: expected tcp, udp or tcp,udp", settings.Network)
+	}
+	if udp && cfg.Protocol != tproxy.ModeTProxy {
+		return nil, fmt.Errorf("udp is only supported by tproxy inbound")
+	}
+
+	return tproxy.NewServer(cfg.Tag, &tproxy.Config{
+		Listen:  cfg.Listen,
+		Mode:    cfg.Protocol,
+		Network: settings.Network,
+	}, i.d), nil
+}
+
+// createForwardInbound создает проброс порта к фиксированному назначению
+func (i *Instance) createForwardInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.ForwardInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal forward settings: %w", err)
+	}
+
+	if settings.Address == "" || settings.Port == 0 {
+		return nil, fmt.Errorf("forward inbound requires address and port")
+	}
+	tcp, udp := commnet.ParseNetworkList(settings.Network)
+	if !tcp && !udp {
+		return nil, fmt.Errorf("invalid network %q: expected tcp, udp or tcp,udp", settings.Network)
+	}
+
+	log.Printf("  → Forwarding to %s:%d (%s)", settings.Address, settings.Port, settings.Network)
+
+	return forward.NewServer(cfg.Tag, &forward.Config{
+		Listen:  cfg.Listen,
+		Address: settings.Address,
+		Port:    settings.Port,
+		Network: settings.Network,
+	}, i.d), nil
+}
+
+// createDNSInbound создает DNS inbound handler
+func (i *Instance) createDNSInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
+	settingsJSON, err := jsonMarshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+
+	var settings v2config.DNSInboundSettings
+	if err := jsonUnmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal dns settings: %w", err)
+	}
+
+	upstreams := make([]dns.Upstream, 0, len(settings.Servers))
+	for _, server := range settings.Servers {
+		if server.Address == "" {
+			return nil, fmt.Errorf("dns server address is required")
+		}
+		// Без проверки запросы молча ушли бы в outbound по умолчанию
+		if server.OutboundTag != "" && i.ohm.GetHandler(server.OutboundTag) == nil {
+			return nil, fmt.Errorf("dns server %s: outbound %q not found", server.Address, server.OutboundTag)
+		}
+		upstreams = append(upstreams, dns.Upstream{
+			Address:     server.Address,
+			Port:        server.Port,
+			Domains:     server.Domains,
+			OutboundTag: server.OutboundTag,
+		})
+	}
+	log.Printf("  → %d upstream DNS servers", len(upstreams))
+
+	return dns.NewServer(cfg.Tag, &dns.Config{
+		Listen:       cfg.Listen,
+		Upstreams:    upstreams,
+		CacheSize:    settings.CacheSize,
+		DisableCache: settings.DisableCache,
+	}, i.d)
+}
+
 // createKoriaInbound создает Koria inbound handler
 func (i *Instance) createKoriaInbound(cfg v2config.InboundConfig) (inbound.Handler, error) {
 	// Парсим settings
@@ -265,7 +689,171 @@ func (i *Instance) createKoriaInbound(cfg v2config.InboundConfig) (inbound.Handl
 		log.Printf("  → Client [%d]: %s (%s)", i, userID, client.Email)
 	}
 
-	return koriaproxy.NewServer(cfg.Tag, cfg.Listen, users, i.d)
+	carrierMode, err := steganography.ParseSelectorMode(settings.CarrierMode)
+	if err != nil {
+		return nil, err
+	}
+
+	serverConfig := &transport.ServerConfig{
+		ListenAddr:  cfg.Listen,
+		Users:       users,
+		Channels:    settings.Channels,
+		CarrierMode: carrierMode,
+		Fallback:    settings.Fallback,
+		Hardened:    settings.Hardened,
+
+		MaxPendingPerIP: settings.MaxPendingPerIP,
+
+		AcceptProxyProtocol: settings.AcceptProxyProtocol,
+	}
+
+	if settings.AcceptProxyProtocol {
+		log.Printf("  → Expecting PROXY protocol header")
+	}
+
+	if settings.Timeouts != nil {
+		timeouts := []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{"handshake", settings.Timeouts.Handshake, &serverConfig.HandshakeTimeout},
+			{"login", settings.Timeouts.Login, &serverConfig.LoginTimeout},
+			{"firstFrame", settings.Timeouts.FirstFrame, &serverConfig.FirstFrameTimeout},
+		}
+		for _, t := range timeouts {
+			if t.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(t.value)
+			if err != nil {
+				return nil, fmt.Errorf("parse timeouts.%s: %w", t.name, err)
+			}
+			*t.dst = d
+		}
+	}
+
+	if settings.Fallback != "" {
+		log.Printf("  → Fallback for unauthenticated clients: %s", settings.Fallback)
+	}
+
+	if settings.Access != nil {
+		access, err := buildAccessConfig(settings.Access)
+		if err != nil {
+			return nil, fmt.Errorf("access settings: %w", err)
+		}
+		serverConfig.Access = access
+	}
+
+	if settings.Query {
+		// Как vanilla: по умолчанию Query слушает UDP на том же порту, что и игра
+		serverConfig.QueryAddr = cfg.Listen
+		if settings.QueryPort != 0 {
+			host, _, err := net.SplitHostPort(cfg.Listen)
+			if err != nil {
+				return nil, fmt.Errorf("parse listen address: %w", err)
+			}
+			serverConfig.QueryAddr = net.JoinHostPort(host, strconv.Itoa(settings.QueryPort))
+		}
+		log.Printf("  → GameSpy4 Query on udp %s", serverConfig.QueryAddr)
+	}
+
+	if settings.Status != nil {
+		status, err := buildStatusConfig(settings.Status)
+		if err != nil {
+			return nil, fmt.Errorf("status settings: %w", err)
+		}
+		serverConfig.Status = status
+
+		if status.Mirror != "" {
+			log.Printf("  → Status mirrored from %s", status.Mirror)
+		}
+	}
+
+	return koriaproxy.NewServer(cfg.Tag, serverConfig, i.d)
+}
+
+// buildAccessConfig конвертирует настройки доступа: списки сетей и длительность бана
+func buildAccessConfig(settings *v2config.AccessSettings) (*transport.AccessConfig, error) {
+	allow, err := transport.ParseCIDRs(settings.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	deny, err := transport.ParseCIDRs(settings.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+
+	access := &transport.AccessConfig{
+		Allow:    allow,
+		Deny:     deny,
+		Rate:     settings.Rate,
+		Burst:    settings.Burst,
+		BanAfter: settings.BanAfter,
+	}
+
+	if settings.BanDuration != "" {
+		access.BanDuration, err = time.ParseDuration(settings.BanDuration)
+		if err != nil {
+			return nil, fmt.Errorf("parse banDuration: %w", err)
+		}
+	}
+
+	return access, nil
+}
+
+// buildStatusConfig конвертирует настройки статуса: MOTD в chat component, favicon в data URI
+func buildStatusConfig(settings *v2config.StatusSettings) (*transport.StatusConfig, error) {
+	status := &transport.StatusConfig{
+		VersionName:  settings.Version,
+		Protocol:     settings.Protocol,
+		EchoProtocol: settings.EchoProtocol,
+		MaxPlayers:   settings.MaxPlayers,
+		OnlineMin:    settings.OnlineMin,
+		OnlineMax:    settings.OnlineMax,
+		Sample:       settings.Sample,
+		Mirror:       settings.Mirror,
+	}
+
+	// MOTD строкой превращаем в {"text": ...}, объект или массив передаем как есть
+	if len(settings.MOTD) > 0 {
+		var text string
+		if err := json.Unmarshal(settings.MOTD, &text); err == nil {
+			status.Description, _ = json.Marshal(map[string]string{"text": text})
+		} else {
+			var component interface{}
+			if err := json.Unmarshal(settings.MOTD, &component); err != nil {
+				return nil, fmt.Errorf("parse motd: %w", err)
+			}
+			status.Description = settings.MOTD
+		}
+	}
+
+	if settings.Favicon != "" {
+		data, err := os.ReadFile(settings.Favicon)
+		if err != nil {
+			return nil, fmt.Errorf("read favicon: %w", err)
+		}
+		// Клиент принимает только PNG 64x64, остальное молча не показывает
+		img, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode favicon: %w", err)
+		}
+		if img.Width != 64 || img.Height != 64 {
+			return nil, fmt.Errorf("favicon must be 64x64, got %dx%d", img.Width, img.Height)
+		}
+		status.Favicon = "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	if settings.MirrorInterval != "" {
+		interval, err := time.ParseDuration(settings.MirrorInterval)
+		if err != nil {
+			return nil, fmt.Errorf("parse mirrorInterval: %w", err)
+		}
+		status.MirrorInterval = interval
+	}
+
+	return status, nil
 }
 
 // Start запускает инстанс
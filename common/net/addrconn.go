@@ -0,0 +1,31 @@
+package net
+
+import (
+	"net"
+)
+
+// AddrConn соединение с адресами, которые сообщила другая сторона туннеля: например,
+// адрес исходящего соединения на сервере вместо адреса локального конца потока.
+// Пустой адрес берется у исходного соединения
+type AddrConn struct {
+	net.Conn
+
+	Local  net.Addr
+	Remote net.Addr
+}
+
+// LocalAddr возвращает сообщенный локальный адрес
+func (c *AddrConn) LocalAddr() net.Addr {
+	if c.Local != nil {
+		return c.Local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// RemoteAddr возвращает сообщенный удаленный адрес
+func (c *AddrConn) RemoteAddr() net.Addr {
+	if c.Remote != nil {
+		return c.Remote
+	}
+	return c.Conn.RemoteAddr()
+}
@@ -0,0 +1,29 @@
+package net
+
+import (
+	"bufio"
+	"net"
+)
+
+// BufferedConn соединение, чтение из которого идет через bufio.Reader
+// Нужен, когда при разборе заголовков прочитано больше, чем занимает заголовок:
+// остаток в буфере принадлежит потоку данных и не должен потеряться
+type BufferedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+// NewBufferedConn оборачивает соединение и reader, который читает из него.
+// Если буфер пуст, возвращается исходное соединение
+func NewBufferedConn(conn net.Conn, reader *bufio.Reader) net.Conn {
+	if reader.Buffered() == 0 {
+		return conn
+	}
+	return &BufferedConn{Conn: conn, reader: reader}
+}
+
+// Read читает сначала из буфера, затем из соединения
+func (c *BufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
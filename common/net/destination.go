@@ -17,6 +17,22 @@ const (
 	UDP Network = "udp"
 )
 
+// ParseNetworkList разбирает список сетей "tcp", "udp", "tcp,udp". Пустой список - только TCP
+func ParseNetworkList(list string) (tcp, udp bool) {
+	if list == "" {
+		return true, false
+	}
+	for _, name := range strings.Split(list, ",") {
+		switch Network(strings.TrimSpace(name)) {
+		case TCP:
+			tcp = true
+		case UDP:
+			udp = true
+		}
+	}
+	return tcp, udp
+}
+
 // Destination представляет пункт назначения
 type Destination struct {
 	Network Network
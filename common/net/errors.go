@@ -0,0 +1,68 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrorClass класс ошибки подключения к назначению. Inbound сообщает его клиенту:
+// кодом ответа SOCKS5, строкой "ERR <класс>" в потоке Koria
+type ErrorClass string
+
+const (
+	ErrorGeneral            ErrorClass = "general"             // Прочие ошибки
+	ErrorNotAllowed         ErrorClass = "not-allowed"         // Запрещено правилами
+	ErrorNetworkUnreachable ErrorClass = "network-unreachable" // Сеть недоступна
+	ErrorHostUnreachable    ErrorClass = "host-unreachable"    // Хост недоступен или не резолвится
+	ErrorConnectionRefused  ErrorClass = "refused"             // Соединение отклонено
+	ErrorTTLExpired         ErrorClass = "ttl-expired"         // Таймаут
+)
+
+// ClassError ошибка с известным классом, например из ответа upstream прокси или Koria сервера
+type ClassError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ClassError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ClassError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError определяет класс ошибки подключения
+func ClassifyError(err error) ErrorClass {
+	var classErr *ClassError
+	if errors.As(err, &classErr) {
+		return classErr.Class
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return ErrorNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return ErrorHostUnreachable
+	}
+
+	// Имя не резолвится - хост недоступен, даже если DNS не ответил вовремя
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorHostUnreachable
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ETIMEDOUT) {
+		return ErrorTTLExpired
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTTLExpired
+	}
+
+	return ErrorGeneral
+}
@@ -0,0 +1,72 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// MaxPacketSize максимальный размер датаграммы, которую переносит StreamPacketConn
+const MaxPacketSize = 65535
+
+// StreamPacketConn переносит UDP датаграммы через потоковое соединение (например,
+// виртуальный поток Koria). Каждая датаграмма идет с 2-байтовой длиной (big endian):
+// один Write - одна датаграмма, один Read - одна датаграмма
+type StreamPacketConn struct {
+	net.Conn
+
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+}
+
+// NewStreamPacketConn оборачивает потоковое соединение для передачи датаграмм
+func NewStreamPacketConn(conn net.Conn) *StreamPacketConn {
+	return &StreamPacketConn{Conn: conn}
+}
+
+// Read читает одну датаграмму. Как у UDP, не поместившаяся в b часть отбрасывается
+func (c *StreamPacketConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(header[:]))
+
+	n := length
+	if n > len(b) {
+		n = len(b)
+	}
+	if _, err := io.ReadFull(c.Conn, b[:n]); err != nil {
+		return 0, err
+	}
+	if n < length {
+		if _, err := io.CopyN(io.Discard, c.Conn, int64(length-n)); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Write отправляет b одной датаграммой
+func (c *StreamPacketConn) Write(b []byte) (int, error) {
+	if len(b) > MaxPacketSize {
+		return 0, fmt.Errorf("packet too large: %d bytes", len(b))
+	}
+
+	// Длина и данные одним вызовом, чтобы датаграммы из разных горутин не перемешались
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,256 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ProxyHeaderTimeout время на заголовок PROXY protocol после подключения
+	ProxyHeaderTimeout = 5 * time.Second
+
+	// proxyV1MaxLength максимальная длина строки v1 вместе с CRLF
+	proxyV1MaxLength = 107
+)
+
+// proxyV2Signature первые 12 байт заголовка PROXY protocol v2
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyConn соединение, принятое через балансировщик с PROXY protocol:
+// RemoteAddr и LocalAddr берутся из заголовка, а не из сокета
+type ProxyConn struct {
+	net.Conn
+
+	remote net.Addr
+	local  net.Addr
+}
+
+// RemoteAddr возвращает адрес клиента из заголовка
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// LocalAddr возвращает адрес, на который подключался клиент
+func (c *ProxyConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// ReadProxyHeader читает заголовок PROXY protocol v1 или v2 из начала соединения.
+// Читается ровно заголовок, данные клиента остаются в conn. Заголовок обязателен:
+// балансировщик отправляет его всегда, а без него адрес источника нельзя доверять.
+// Для LOCAL и UNKNOWN (проверки здоровья балансировщика) возвращается исходное соединение
+func ReadProxyHeader(conn net.Conn) (net.Conn, error) {
+	// 12 байт есть в любом заголовке: сигнатура v2 или "PROXY UNKNOWN\r\n"
+	var start [12]byte
+	if _, err := io.ReadFull(conn, start[:]); err != nil {
+		return nil, fmt.Errorf("read proxy header: %w", err)
+	}
+
+	var remote, local net.Addr
+	var err error
+	switch {
+	case bytes.Equal(start[:], proxyV2Signature):
+		remote, local, err = readProxyV2(conn)
+	case bytes.HasPrefix(start[:], []byte("PROXY ")):
+		remote, local, err = readProxyV1(conn, start[:])
+	default:
+		return nil, fmt.Errorf("missing proxy protocol header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if remote == nil {
+		return conn, nil
+	}
+	return &ProxyConn{Conn: conn, remote: remote, local: local}, nil
+}
+
+// readProxyV1 дочитывает текстовый заголовок: "PROXY TCP4 src dst sport dport\r\n"
+func readProxyV1(conn net.Conn, start []byte) (net.Addr, net.Addr, error) {
+	line := append([]byte(nil), start...)
+
+	// Читаем по байту, чтобы не забрать данные клиента после заголовка
+	var b [1]byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return nil, nil, fmt.Errorf("proxy v1 header too long")
+		}
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return nil, nil, fmt.Errorf("read proxy v1 header: %w", err)
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid proxy v1 header: %q", strings.TrimSpace(string(line)))
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if srcIP == nil || dstIP == nil {
+		return nil, nil, fmt.Errorf("invalid proxy v1 address")
+	}
+	// Семейство смотрим по записи: ::ffff:a.b.c.d в TCP6 - допустимый IPv6 адрес
+	ipv6 := fields[1] == "TCP6"
+	if strings.Contains(fields[2], ":") != ipv6 || strings.Contains(fields[3], ":") != ipv6 {
+		return nil, nil, fmt.Errorf("proxy v1 address does not match %s", fields[1])
+	}
+
+	srcPort, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid proxy v1 source port: %w", err)
+	}
+	dstPort, err := strconv.ParseUint(fields[5], 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid proxy v1 destination port: %w", err)
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+}
+
+// readProxyV2 дочитывает двоичный заголовок после сигнатуры
+func readProxyV2(conn net.Conn) (net.Addr, net.Addr, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, nil, fmt.Errorf("read proxy v2 header: %w", err)
+	}
+
+	version, command := header[0]>>4, header[0]&0x0F
+	family, transport := header[1]>>4, header[1]&0x0F
+	length := binary.BigEndian.Uint16(header[2:])
+
+	if version != 2 {
+		return nil, nil, fmt.Errorf("unsupported proxy protocol version: %d", version)
+	}
+
+	// Адреса и TLV читаем целиком, даже если они не нужны
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, nil, fmt.Errorf("read proxy v2 addresses: %w", err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported proxy v2 command: %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC и AF_UNIX: адреса нет, оставляем адрес сокета
+		return nil, nil, nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, fmt.Errorf("proxy v2 addresses truncated")
+	}
+	srcIP := net.IP(append([]byte(nil), payload[:ipLen]...))
+	dstIP := net.IP(append([]byte(nil), payload[ipLen:2*ipLen]...))
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+
+	if transport == 0x2 { // DGRAM
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
+
+// WriteProxyHeader пишет заголовок PROXY protocol версии 1 или 2 для TCP соединения
+// от src к dst. Если адрес клиента неизвестен (src = nil), пишется UNKNOWN (v1) или LOCAL (v2)
+func WriteProxyHeader(w io.Writer, version int, src, dst net.Addr) error {
+	srcIP, srcPort := addrIPPort(src)
+	dstIP, dstPort := addrIPPort(dst)
+	known := srcIP != nil && dstIP != nil
+
+	// Адреса разных семейств передаем как IPv6, IPv4 - в виде ::ffff:a.b.c.d
+	ipv4 := known && srcIP.To4() != nil && dstIP.To4() != nil
+	if ipv4 {
+		srcIP, dstIP = srcIP.To4(), dstIP.To4()
+	} else if known {
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	}
+
+	var header []byte
+	switch version {
+	case 1:
+		switch {
+		case !known:
+			header = []byte("PROXY UNKNOWN\r\n")
+		case ipv4:
+			header = []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", srcIP, dstIP, srcPort, dstPort))
+		default:
+			header = []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", ipv6String(srcIP), ipv6String(dstIP), srcPort, dstPort))
+		}
+
+	case 2:
+		header = append(header, proxyV2Signature...)
+		if !known {
+			header = append(header, 0x20, 0x00, 0x00, 0x00) // LOCAL, AF_UNSPEC
+			break
+		}
+
+		family := byte(0x21) // AF_INET6, STREAM
+		if ipv4 {
+			family = 0x11 // AF_INET, STREAM
+		}
+		header = append(header, 0x21, family) // версия 2, PROXY
+		header = binary.BigEndian.AppendUint16(header, uint16(2*len(srcIP)+4))
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		header = binary.BigEndian.AppendUint16(header, uint16(srcPort))
+		header = binary.BigEndian.AppendUint16(header, uint16(dstPort))
+
+	default:
+		return fmt.Errorf("unsupported proxy protocol version: %d", version)
+	}
+
+	_, err := w.Write(header)
+	return err
+}
+
+// ipv6String записывает адрес в форме IPv6, IPv4 - как ::ffff:a.b.c.d
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// addrIPPort извлекает IP и порт из адреса, nil - адрес не IP
+func addrIPPort(addr net.Addr) (net.IP, int) {
+	switch a := addr.(type) {
+	case nil:
+		return nil, 0
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	}
+
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, 0
+	}
+	return net.ParseIP(host), port
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// RecordingConn запоминает все прочитанные из соединения байты, пока запись включена
+// Нужен, чтобы после неудачного разбора передать уже прочитанные данные другому серверу
+type RecordingConn struct {
+	net.Conn
+
+	buf       bytes.Buffer
+	recording bool
+	mu        sync.Mutex
+}
+
+// NewRecordingConn оборачивает соединение и сразу включает запись
+func NewRecordingConn(conn net.Conn) *RecordingConn {
+	return &RecordingConn{
+		Conn:      conn,
+		recording: true,
+	}
+}
+
+// Read читает из соединения и сохраняет прочитанное
+func (c *RecordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		if c.recording {
+			c.buf.Write(b[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// Recorded возвращает копию прочитанных байт
+func (c *RecordingConn) Recorded() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf.Bytes()...)
+}
+
+// StopRecording выключает запись и освобождает буфер
+func (c *RecordingConn) StopRecording() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recording = false
+	c.buf = bytes.Buffer{}
+}
@@ -0,0 +1,30 @@
+package net
+
+import (
+	commio "koria-core/common/io"
+	"net"
+	"sync"
+)
+
+// Relay копирует данные между a и b в обе стороны, пока оба направления не закончатся
+// Конец данных в одну сторону закрывает получателя, это прерывает и встречное копирование
+func Relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// a -> b
+	go func() {
+		defer wg.Done()
+		commio.Copy(b, a)
+		b.Close()
+	}()
+
+	// b -> a
+	go func() {
+		defer wg.Done()
+		commio.Copy(a, b)
+		a.Close()
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package net
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// udpSessionTimeout сессия закрывается после такого простоя в обе стороны
+	udpSessionTimeout = 2 * time.Minute
+
+	// udpQueueSize датаграмм в очереди на отправку в назначение, сверх нее - отбрасываются
+	udpQueueSize = 64
+)
+
+// UDPSession датаграммы клиента к одному назначению через соединение из dispatcher
+type UDPSession struct {
+	queue  chan []byte
+	active chan struct{} // сигнал о принятой из назначения датаграмме
+}
+
+// UDPSessionTable сессии inbound по ключу (клиент, назначение или оба)
+type UDPSessionTable struct {
+	mu       sync.Mutex
+	sessions map[string]*UDPSession
+}
+
+// NewUDPSessionTable создает пустую таблицу сессий
+func NewUDPSessionTable() *UDPSessionTable {
+	return &UDPSessionTable{
+		sessions: make(map[string]*UDPSession),
+	}
+}
+
+// Send ставит датаграмму в очередь сессии key. Для новой сессии в отдельной горутине
+// запускается start, сессия удаляется из таблицы, когда он вернется
+func (t *UDPSessionTable) Send(key string, payload []byte, start func(sess *UDPSession)) {
+	t.mu.Lock()
+	sess, exists := t.sessions[key]
+	if !exists {
+		sess = &UDPSession{
+			queue:  make(chan []byte, udpQueueSize),
+			active: make(chan struct{}, 1),
+		}
+		t.sessions[key] = sess
+		go func() {
+			start(sess)
+			t.mu.Lock()
+			delete(t.sessions, key)
+			t.mu.Unlock()
+		}()
+	}
+	t.mu.Unlock()
+
+	select {
+	case sess.queue <- payload:
+	default:
+		// Назначение не успевает, как и в UDP датаграмма теряется
+	}
+}
+
+// Relay пересылает датаграммы очереди в outConn, а датаграммы назначения отдает reply,
+// до простоя в обе стороны или отмены ctx. outConn закрывает вызывающий после возврата
+func (sess *UDPSession) Relay(ctx context.Context, outConn net.Conn, reply func(payload []byte) error) {
+	go sess.readReplies(outConn, reply)
+
+	timer := time.NewTimer(udpSessionTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case payload := <-sess.queue:
+			if _, err := outConn.Write(payload); err != nil {
+				return
+			}
+		case <-sess.active:
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(udpSessionTimeout)
+	}
+}
+
+// readReplies возвращает клиенту датаграммы назначения
+func (sess *UDPSession) readReplies(outConn net.Conn, reply func(payload []byte) error) {
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, err := outConn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		if err := reply(buf[:n]); err != nil {
+			return
+		}
+
+		select {
+		case sess.active <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package session
+
+import (
+	"context"
+	"net"
+)
+
+// Inbound сведения о входящем соединении, которые нужны маршрутизации и outbound
+type Inbound struct {
+	// Tag тег inbound, принявшего соединение
+	Tag string
+	// Source адрес клиента. За балансировщиком с PROXY protocol - адрес из заголовка
+	Source net.Addr
+	// User имя, под которым клиент прошел аутентификацию inbound (пусто - без нее)
+	User string
+}
+
+type inboundKey struct{}
+
+// ContextWithInbound возвращает контекст со сведениями о входящем соединении
+func ContextWithInbound(ctx context.Context, inbound *Inbound) context.Context {
+	return context.WithValue(ctx, inboundKey{}, inbound)
+}
+
+// InboundFromContext возвращает сведения о входящем соединении или nil
+func InboundFromContext(ctx context.Context) *Inbound {
+	inbound, _ := ctx.Value(inboundKey{}).(*Inbound)
+	return inbound
+}
+
+// SourceIP возвращает IP клиента или nil
+func (inbound *Inbound) SourceIP() net.IP {
+	if inbound == nil || inbound.Source == nil {
+		return nil
+	}
+
+	switch addr := inbound.Source.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+
+	host, _, err := net.SplitHostPort(inbound.Source.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
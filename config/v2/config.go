@@ -45,6 +45,8 @@ type RoutingRule struct {
 	Type        string   `json:"type,omitempty"`        // "field"
 	Domain      []string `json:"domain,omitempty"`      // Domain matching
 	IP          []string `json:"ip,omitempty"`          // IP CIDR matching
+	Source      []string `json:"source,omitempty"`      // Client IP CIDR matching
+	User        []string `json:"user,omitempty"`        // Inbound user matching
 	Port        string   `json:"port,omitempty"`        // Port matching
 	Network     string   `json:"network,omitempty"`     // "tcp", "udp"
 	Protocol    []string `json:"protocol,omitempty"`    // Protocol matching
@@ -53,14 +55,145 @@ type RoutingRule struct {
 
 // KoriaInboundSettings настройки Koria inbound
 type KoriaInboundSettings struct {
-	Clients []ClientConfig `json:"clients"`
+	Clients         []ClientConfig   `json:"clients"`
+	Channels        []string         `json:"channels,omitempty"`        // Пул plugin-каналов для CustomPayload
+	CarrierMode     string           `json:"carrierMode,omitempty"`     // "adaptive", "tiny", "mixed"
+	Fallback        string           `json:"fallback,omitempty"`        // host:port настоящего Minecraft сервера
+	Status          *StatusSettings  `json:"status,omitempty"`          // Ответ на Server List Ping
+	Query           bool             `json:"query,omitempty"`           // GameSpy4 Query по UDP, как enable-query
+	QueryPort       int              `json:"queryPort,omitempty"`       // UDP порт Query (0 = порт inbound)
+	Hardened        bool             `json:"hardened,omitempty"`        // Отказы и таймауты как у vanilla 1.20.4
+	Timeouts        *TimeoutSettings `json:"timeouts,omitempty"`        // Дедлайны фаз до начала трафика
+	MaxPendingPerIP int              `json:"maxPendingPerIP,omitempty"` // Соединений без аутентификации с одного IP
+	Access          *AccessSettings  `json:"access,omitempty"`          // Лимит частоты, баны, списки сетей
+
+	AcceptProxyProtocol bool `json:"acceptProxyProtocol,omitempty"` // Заголовок PROXY protocol от балансировщика
+}
+
+// SocksInboundSettings настройки SOCKS5 inbound
+type SocksInboundSettings struct {
+	Accounts []AccountConfig `json:"accounts,omitempty"` // Логины и пароли (RFC 1929), пусто = без аутентификации
+
+	AcceptProxyProtocol bool `json:"acceptProxyProtocol,omitempty"` // Заголовок PROXY protocol от балансировщика
+}
+
+// AccountConfig учетная запись прокси inbound
+type AccountConfig struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// HTTPInboundSettings настройки HTTP inbound
+type HTTPInboundSettings struct {
+	Accounts []AccountConfig `json:"accounts,omitempty"` // Логины и пароли (Proxy-Authorization: Basic), пусто = без аутентификации
+
+	AcceptProxyProtocol bool `json:"acceptProxyProtocol,omitempty"` // Заголовок PROXY protocol от балансировщика
+}
+
+// MixedInboundSettings настройки mixed inbound (SOCKS4/4a, SOCKS5 и HTTP на одном порту)
+type MixedInboundSettings struct {
+	Accounts []AccountConfig `json:"accounts,omitempty"` // Логины и пароли для SOCKS5 и HTTP, пусто = без аутентификации
+
+	AcceptProxyProtocol bool `json:"acceptProxyProtocol,omitempty"` // Заголовок PROXY protocol от балансировщика
+}
+
+// TProxyInboundSettings настройки прозрачного прокси (redirect и tproxy inbound)
+type TProxyInboundSettings struct {
+	Network string `json:"network,omitempty"` // "tcp", "udp" или "tcp,udp" (пусто = "tcp"), UDP только для tproxy
+}
+
+// ForwardInboundSettings настройки проброса порта (forward inbound)
+type ForwardInboundSettings struct {
+	Address string `json:"address"`           // Адрес назначения: домен или IP
+	Port    uint16 `json:"port"`              // Порт назначения
+	Network string `json:"network,omitempty"` // "tcp", "udp" или "tcp,udp" (пусто = "tcp")
+}
+
+// DNSInboundSettings настройки DNS inbound
+type DNSInboundSettings struct {
+	Servers      []DNSServerConfig `json:"servers"`                // Upstream DNS серверы
+	CacheSize    int               `json:"cacheSize,omitempty"`    // Записей в кэше (0 = 1024)
+	DisableCache bool              `json:"disableCache,omitempty"` // Не кэшировать ответы
+}
+
+// DNSServerConfig upstream DNS сервер, запросы к нему идут по TCP через outbound
+type DNSServerConfig struct {
+	Address     string   `json:"address"`               // IP или домен DNS сервера
+	Port        uint16   `json:"port,omitempty"`        // Порт (0 = 53)
+	Domains     []string `json:"domains,omitempty"`     // Домены этого сервера (синтаксис routing), пусто = остальные
+	OutboundTag string   `json:"outboundTag,omitempty"` // Outbound для запросов, пусто = по правилам routing
+}
+
+// FreedomOutboundSettings настройки Freedom outbound
+type FreedomOutboundSettings struct {
+	ProxyProtocol int `json:"proxyProtocol,omitempty"` // Версия заголовка PROXY protocol к цели: 1, 2 (0 = нет)
+}
+
+// AccessSettings ограничения доступа к Koria inbound по адресу источника
+type AccessSettings struct {
+	Allow       []string `json:"allow,omitempty"`       // Разрешенные сети (пусто = все)
+	Deny        []string `json:"deny,omitempty"`        // Запрещенные сети
+	Rate        float64  `json:"rate,omitempty"`        // Новых соединений в секунду с адреса
+	Burst       int      `json:"burst,omitempty"`       // Запас соединений сверх rate
+	BanAfter    int      `json:"banAfter,omitempty"`    // Неудачных входов до временного бана
+	BanDuration string   `json:"banDuration,omitempty"` // Длительность бана, например "10m"
+}
+
+// TimeoutSettings дедлайны фаз соединения Koria inbound ("15s", "1m")
+type TimeoutSettings struct {
+	Handshake  string `json:"handshake,omitempty"`  // Handshake и Status запрос
+	Login      string `json:"login,omitempty"`      // Вход до начала трафика мультиплексора
+	FirstFrame string `json:"firstFrame,omitempty"` // Первый пакет мультиплексора
+}
+
+// StatusSettings ответ Koria inbound на Server List Ping
+type StatusSettings struct {
+	MOTD           json.RawMessage `json:"motd,omitempty"`           // Строка или JSON chat component
+	Version        string          `json:"version,omitempty"`        // Название версии, например "Paper 1.20.4"
+	Protocol       int32           `json:"protocol,omitempty"`       // Номер протокола (0 = 765, 1.20.4)
+	EchoProtocol   bool            `json:"echoProtocol,omitempty"`   // Отвечать протоколом клиента
+	Favicon        string          `json:"favicon,omitempty"`        // Путь к PNG 64x64
+	MaxPlayers     int             `json:"maxPlayers,omitempty"`     // Число слотов
+	OnlineMin      int             `json:"onlineMin,omitempty"`      // Онлайн ночью
+	OnlineMax      int             `json:"onlineMax,omitempty"`      // Онлайн в пик вечером
+	Sample         []string        `json:"sample,omitempty"`         // Ники для списка игроков
+	Mirror         string          `json:"mirror,omitempty"`         // host:port сервера, чей статус копируется
+	MirrorInterval string          `json:"mirrorInterval,omitempty"` // Период копирования, например "5m"
 }
 
 // KoriaOutboundSettings настройки Koria outbound
 type KoriaOutboundSettings struct {
-	Address string       `json:"address"`
-	Port    int          `json:"port"`
-	UserID  string       `json:"userId"`
+	Address     string   `json:"address"`
+	Port        int      `json:"port"`
+	UserID      string   `json:"userId"`
+	Channels    []string `json:"channels,omitempty"`    // Пул plugin-каналов для CustomPayload
+	CarrierMode string   `json:"carrierMode,omitempty"` // "adaptive", "tiny", "mixed"
+	Version     string   `json:"version,omitempty"`     // Версия Minecraft: "1.19.4", "1.20.1", "1.20.4", "1.21"
+	Dialer      string   `json:"dialer,omitempty"`      // Тег outbound для TCP соединения с сервером
+
+	Timeouts *DialTimeoutSettings `json:"timeouts,omitempty"` // Дедлайны подключения к серверу
+}
+
+// DialTimeoutSettings дедлайны подключения Koria outbound к серверу ("10s", "1m")
+type DialTimeoutSettings struct {
+	Dial  string `json:"dial,omitempty"`  // TCP соединение (через dialer - вместе с ним)
+	Login string `json:"login,omitempty"` // От Handshake до начала трафика мультиплексора
+}
+
+// SocksOutboundSettings настройки SOCKS5 outbound (upstream SOCKS5 сервер)
+type SocksOutboundSettings struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	User    string `json:"user,omitempty"` // Логин (RFC 1929), пусто = без аутентификации
+	Pass    string `json:"pass,omitempty"`
+}
+
+// HTTPOutboundSettings настройки HTTP outbound (upstream HTTP прокси с CONNECT)
+type HTTPOutboundSettings struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	User    string `json:"user,omitempty"` // Логин Basic аутентификации, пусто = без нее
+	Pass    string `json:"pass,omitempty"`
 }
 
 // ClientConfig конфигурация клиента для inbound
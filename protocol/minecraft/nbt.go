@@ -0,0 +1,184 @@
+package minecraft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Типы NBT тегов
+const (
+	TagEnd       byte = 0
+	TagByte      byte = 1
+	TagShort     byte = 2
+	TagInt       byte = 3
+	TagLong      byte = 4
+	TagFloat     byte = 5
+	TagDouble    byte = 6
+	TagByteArray byte = 7
+	TagString    byte = 8
+	TagList      byte = 9
+	TagCompound  byte = 10
+	TagIntArray  byte = 11
+	TagLongArray byte = 12
+)
+
+// NBTCompound составной тег с сохранением порядка полей
+// Поддерживаемые значения: bool, int8, int16, int32, int64, float32, float64,
+// []byte, string, NBTList, NBTCompound, []int32, []int64
+type NBTCompound []NBTField
+
+// NBTField именованное поле составного тега
+type NBTField struct {
+	Name  string
+	Value interface{}
+}
+
+// NBTList список тегов одного типа
+type NBTList struct {
+	ElemType byte
+	Elems    []interface{}
+}
+
+// WriteNBT записывает составной тег в сетевом формате (корень без имени, 1.20.2+)
+func WriteNBT(w io.Writer, c NBTCompound) error {
+	if _, err := w.Write([]byte{TagCompound}); err != nil {
+		return err
+	}
+	return writeNBTPayload(w, c)
+}
+
+// WriteNamedNBT записывает составной тег с именем корня (формат до 1.20.2)
+func WriteNamedNBT(w io.Writer, name string, c NBTCompound) error {
+	if _, err := w.Write([]byte{TagCompound}); err != nil {
+		return err
+	}
+	if err := writeNBTString(w, name); err != nil {
+		return err
+	}
+	return writeNBTPayload(w, c)
+}
+
+// nbtTagType возвращает тип тега для значения
+func nbtTagType(v interface{}) (byte, error) {
+	switch v.(type) {
+	case bool, int8:
+		return TagByte, nil
+	case int16:
+		return TagShort, nil
+	case int32:
+		return TagInt, nil
+	case int64:
+		return TagLong, nil
+	case float32:
+		return TagFloat, nil
+	case float64:
+		return TagDouble, nil
+	case []byte:
+		return TagByteArray, nil
+	case string:
+		return TagString, nil
+	case NBTList:
+		return TagList, nil
+	case NBTCompound:
+		return TagCompound, nil
+	case []int32:
+		return TagIntArray, nil
+	case []int64:
+		return TagLongArray, nil
+	default:
+		return TagEnd, fmt.Errorf("unsupported NBT value type: %T", v)
+	}
+}
+
+// writeNBTString записывает строку NBT (длина uint16 + modified UTF-8)
+func writeNBTString(w io.Writer, s string) error {
+	if len(s) > 0xFFFF {
+		return fmt.Errorf("NBT string too long: %d", len(s))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// writeNBTPayload записывает значение тега без типа и имени
+func writeNBTPayload(w io.Writer, v interface{}) error {
+	switch val := v.(type) {
+	case bool:
+		var b int8
+		if val {
+			b = 1
+		}
+		return binary.Write(w, binary.BigEndian, b)
+
+	case int8, int16, int32, int64, float32, float64:
+		return binary.Write(w, binary.BigEndian, val)
+
+	case []byte:
+		if err := binary.Write(w, binary.BigEndian, int32(len(val))); err != nil {
+			return err
+		}
+		_, err := w.Write(val)
+		return err
+
+	case string:
+		return writeNBTString(w, val)
+
+	case NBTList:
+		elemType := val.ElemType
+		if len(val.Elems) == 0 {
+			elemType = TagEnd
+		}
+		if _, err := w.Write([]byte{elemType}); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, int32(len(val.Elems))); err != nil {
+			return err
+		}
+		for _, elem := range val.Elems {
+			if t, err := nbtTagType(elem); err != nil || t != val.ElemType {
+				return fmt.Errorf("NBT list element %T does not match type %d", elem, val.ElemType)
+			}
+			if err := writeNBTPayload(w, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case NBTCompound:
+		for _, field := range val {
+			tagType, err := nbtTagType(field.Value)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			if _, err := w.Write([]byte{tagType}); err != nil {
+				return err
+			}
+			if err := writeNBTString(w, field.Name); err != nil {
+				return err
+			}
+			if err := writeNBTPayload(w, field.Value); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		_, err := w.Write([]byte{TagEnd})
+		return err
+
+	case []int32:
+		if err := binary.Write(w, binary.BigEndian, int32(len(val))); err != nil {
+			return err
+		}
+		return binary.Write(w, binary.BigEndian, val)
+
+	case []int64:
+		if err := binary.Write(w, binary.BigEndian, int32(len(val))); err != nil {
+			return err
+		}
+		return binary.Write(w, binary.BigEndian, val)
+
+	default:
+		return fmt.Errorf("unsupported NBT value type: %T", v)
+	}
+}
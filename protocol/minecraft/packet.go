@@ -9,25 +9,74 @@ import (
 )
 
 // PacketType определяет тип пакета
+// Константы ниже - ID пакетов Minecraft 1.20.4 (протокол 765). Они же служат
+// каноническими ID: для других версий Profile переводит их в ID версии и обратно
 type PacketType int32
 
+// PacketTypeUnknown пакет, которого нет среди канонических ID
+const PacketTypeUnknown PacketType = -1
+
 const (
 	// Handshake packets
 	PacketTypeHandshake PacketType = 0x00
 
 	// Login packets
-	PacketTypeLoginStart   PacketType = 0x00
-	PacketTypeLoginSuccess PacketType = 0x02
-
-	// Play packets (C2S)
-	PacketTypePlayerMove      PacketType = 0x1A // MOVE_PLAYER_POS_ROT
-	PacketTypePlayerPosition  PacketType = 0x17 // MOVE_PLAYER_POS
-	PacketTypePlayerRotation  PacketType = 0x19 // MOVE_PLAYER_ROT
-	PacketTypePlayerAction    PacketType = 0x24 // PLAYER_ACTION
-	PacketTypeHandSwing       PacketType = 0x36 // SWING
-	PacketTypeChatMessage     PacketType = 0x07 // CHAT
-	PacketTypeCustomPayload   PacketType = 0x12 // CUSTOM_PAYLOAD
-	PacketTypeUpdateSelectedSlot PacketType = 0x2E // SET_CARRIED_ITEM
+	PacketTypeLoginStart      PacketType = 0x00
+	PacketTypeLoginDisconnect PacketType = 0x00 // LOGIN_DISCONNECT (S2C)
+	PacketTypeLoginSuccess    PacketType = 0x02
+
+	// Login packets (C2S), 1.20.2+
+	PacketTypeLoginAcknowledged PacketType = 0x03 // LOGIN_ACKNOWLEDGED
+
+	// Configuration packets (S2C), Minecraft 1.20.4
+	PacketTypeConfigPluginMessageS2C PacketType = 0x00 // CUSTOM_PAYLOAD
+	PacketTypeConfigDisconnect       PacketType = 0x01 // DISCONNECT
+	PacketTypeFinishConfiguration    PacketType = 0x02 // FINISH_CONFIGURATION
+	PacketTypeConfigKeepAliveS2C     PacketType = 0x03 // KEEP_ALIVE
+	PacketTypeConfigPing             PacketType = 0x04 // PING
+	PacketTypeRegistryData           PacketType = 0x05 // REGISTRY_DATA
+	PacketTypeFeatureFlags           PacketType = 0x08 // UPDATE_ENABLED_FEATURES
+	PacketTypeUpdateTags             PacketType = 0x09 // UPDATE_TAGS
+	PacketTypeKnownPacksS2C          PacketType = 0x0E // SELECT_KNOWN_PACKS, 1.20.5+ (ID из 1.21)
+
+	// Configuration packets (C2S), Minecraft 1.20.4
+	PacketTypeConfigClientInformation PacketType = 0x00 // CLIENT_INFORMATION
+	PacketTypeConfigPluginMessageC2S  PacketType = 0x01 // CUSTOM_PAYLOAD
+	PacketTypeAcknowledgeFinishConfig PacketType = 0x02 // FINISH_CONFIGURATION
+	PacketTypeConfigKeepAliveC2S      PacketType = 0x03 // KEEP_ALIVE
+	PacketTypeConfigPong              PacketType = 0x04 // PONG
+	PacketTypeKnownPacksC2S           PacketType = 0x07 // SELECT_KNOWN_PACKS, 1.20.5+ (ID из 1.21)
+
+	// Play packets (C2S), Minecraft 1.20.4
+	PacketTypePlayerMove         PacketType = 0x18 // MOVE_PLAYER_POS_ROT
+	PacketTypePlayerPosition     PacketType = 0x17 // MOVE_PLAYER_POS
+	PacketTypePlayerRotation     PacketType = 0x19 // MOVE_PLAYER_ROT
+	PacketTypePlayerAction       PacketType = 0x21 // PLAYER_ACTION
+	PacketTypeHandSwing          PacketType = 0x33 // SWING
+	PacketTypeChatMessage        PacketType = 0x05 // CHAT
+	PacketTypeCustomPayload      PacketType = 0x10 // CUSTOM_PAYLOAD
+	PacketTypeUpdateSelectedSlot PacketType = 0x2C // SET_CARRIED_ITEM
+
+	// Play packets вход в мир (S2C), Minecraft 1.20.4
+	PacketTypeChangeDifficulty   PacketType = 0x0B // CHANGE_DIFFICULTY
+	PacketTypeChunkBatchFinished PacketType = 0x0C // CHUNK_BATCH_FINISHED
+	PacketTypeChunkBatchStart    PacketType = 0x0D // CHUNK_BATCH_START
+	PacketTypeCustomPayloadS2C   PacketType = 0x18 // CUSTOM_PAYLOAD
+	PacketTypeGameEvent          PacketType = 0x20 // GAME_EVENT
+	PacketTypeKeepAliveS2C       PacketType = 0x24 // KEEP_ALIVE
+	PacketTypeChunkData          PacketType = 0x25 // LEVEL_CHUNK_WITH_LIGHT
+	PacketTypeLoginPlay          PacketType = 0x29 // LOGIN
+	PacketTypePlayerAbilities    PacketType = 0x36 // PLAYER_ABILITIES
+	PacketTypeSyncPlayerPosition PacketType = 0x3E // PLAYER_POSITION
+	PacketTypeSetHeldItem        PacketType = 0x51 // SET_CARRIED_ITEM
+	PacketTypeSetCenterChunk     PacketType = 0x52 // SET_CHUNK_CACHE_CENTER
+	PacketTypeSetDefaultSpawn    PacketType = 0x54 // SET_DEFAULT_SPAWN_POSITION
+
+	// Play packets вход в мир (C2S), Minecraft 1.20.4
+	PacketTypeConfirmTeleport    PacketType = 0x00 // ACCEPT_TELEPORTATION
+	PacketTypeChunkBatchReceived PacketType = 0x07 // CHUNK_BATCH_RECEIVED
+	PacketTypeClientInformation  PacketType = 0x09 // CLIENT_INFORMATION
+	PacketTypeKeepAliveC2S       PacketType = 0x15 // KEEP_ALIVE
 )
 
 // NetworkPhase определяет фазу протокола
@@ -37,9 +86,28 @@ const (
 	PhaseHandshaking NetworkPhase = iota
 	PhaseStatus
 	PhaseLogin
+	PhaseConfiguration // 1.20.2+: между Login Acknowledged и Finish Configuration
 	PhasePlay
 )
 
+// String возвращает название фазы
+func (p NetworkPhase) String() string {
+	switch p {
+	case PhaseHandshaking:
+		return "handshaking"
+	case PhaseStatus:
+		return "status"
+	case PhaseLogin:
+		return "login"
+	case PhaseConfiguration:
+		return "configuration"
+	case PhasePlay:
+		return "play"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(p))
+	}
+}
+
 // Packet базовый интерфейс для всех пакетов
 type Packet interface {
 	// PacketID возвращает ID пакета
@@ -115,16 +183,21 @@ func ReadPacket(r io.Reader, packet Packet) error {
 
 // WritePacket записывает пакет в соединение
 func WritePacket(w io.Writer, packet Packet) error {
+	return writePacket(w, packet.PacketID(), packet.Encode)
+}
+
+// writePacket записывает пакет с заданным ID, данные кодирует encode
+func writePacket(w io.Writer, packetID PacketType, encode func(w io.Writer) error) error {
 	// Кодируем пакет в буфер
 	var buf bytes.Buffer
 
 	// Записываем packet ID
-	if err := WriteVarInt(&buf, int32(packet.PacketID())); err != nil {
+	if err := WriteVarInt(&buf, int32(packetID)); err != nil {
 		return fmt.Errorf("write packet ID: %w", err)
 	}
 
 	// Записываем данные пакета
-	if err := packet.Encode(&buf); err != nil {
+	if err := encode(&buf); err != nil {
 		return fmt.Errorf("encode packet: %w", err)
 	}
 
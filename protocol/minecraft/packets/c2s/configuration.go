@@ -0,0 +1,134 @@
+package c2s
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"koria-core/protocol/minecraft"
+)
+
+// ConfigClientInformationPacket - настройки клиента в фазе Configuration
+// Packet ID: 0x00
+// Формат совпадает с Play версией пакета, отличается только ID
+type ConfigClientInformationPacket struct {
+	ClientInformationPacket
+}
+
+func (p *ConfigClientInformationPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigClientInformation
+}
+
+// ConfigPluginMessagePacket - сообщение plugin-канала в фазе Configuration
+// Packet ID: 0x01
+// Клиент 1.20.2+ отправляет в нем minecraft:brand и minecraft:register до начала игры
+type ConfigPluginMessagePacket struct {
+	CustomPayloadPacket
+}
+
+func (p *ConfigPluginMessagePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigPluginMessageC2S
+}
+
+// AcknowledgeFinishConfigurationPacket - подтверждение конца Configuration
+// Packet ID: 0x02
+// После него обе стороны переходят в фазу Play
+type AcknowledgeFinishConfigurationPacket struct{}
+
+func (p *AcknowledgeFinishConfigurationPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeAcknowledgeFinishConfig
+}
+
+func (p *AcknowledgeFinishConfigurationPacket) Encode(w io.Writer) error {
+	return nil
+}
+
+func (p *AcknowledgeFinishConfigurationPacket) Decode(r io.Reader) error {
+	return nil
+}
+
+// ConfigKeepAlivePacket - ответ на Keep Alive в фазе Configuration
+// Packet ID: 0x03
+type ConfigKeepAlivePacket struct {
+	ID int64
+}
+
+func (p *ConfigKeepAlivePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigKeepAliveC2S
+}
+
+func (p *ConfigKeepAlivePacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+func (p *ConfigKeepAlivePacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
+
+// ConfigPongPacket - ответ на Ping в фазе Configuration
+// Packet ID: 0x04
+type ConfigPongPacket struct {
+	ID int32
+}
+
+func (p *ConfigPongPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigPong
+}
+
+func (p *ConfigPongPacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+func (p *ConfigPongPacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
+
+// KnownPack пакет данных, который есть у клиента
+type KnownPack struct {
+	Namespace string
+	ID        string
+	Version   string
+}
+
+// KnownPacksPacket - ответ на список пакетов данных сервера (1.20.5+)
+// Packet ID: 0x07 (1.21)
+type KnownPacksPacket struct {
+	Packs []KnownPack
+}
+
+func (p *KnownPacksPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeKnownPacksC2S
+}
+
+func (p *KnownPacksPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteVarInt(w, int32(len(p.Packs))); err != nil {
+		return err
+	}
+	for _, pack := range p.Packs {
+		for _, s := range []string{pack.Namespace, pack.ID, pack.Version} {
+			if err := minecraft.WriteString(w, s, 32767); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *KnownPacksPacket) Decode(r io.Reader) error {
+	count, err := minecraft.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count < 0 || count > 64 {
+		return fmt.Errorf("invalid known pack count: %d", count)
+	}
+
+	p.Packs = make([]KnownPack, count)
+	for i := range p.Packs {
+		for _, s := range []*string{&p.Packs[i].Namespace, &p.Packs[i].ID, &p.Packs[i].Version} {
+			if *s, err = minecraft.ReadString(r, 32767); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package c2s
 
 import (
+	"fmt"
 	"github.com/google/uuid"
 	"io"
 	"koria-core/protocol/minecraft"
@@ -51,3 +52,70 @@ func (p *LoginStartPacket) Decode(r io.Reader) error {
 	p.UUID, err = uuid.FromBytes(uuidBytes)
 	return err
 }
+
+// EncodeVersion кодирует пакет в формате версии
+// До 1.20.2 перед UUID идет флаг его наличия
+func (p *LoginStartPacket) EncodeVersion(w io.Writer, v *minecraft.Profile) error {
+	if !v.OptionalLoginUUID {
+		return p.Encode(w)
+	}
+
+	if err := minecraft.WriteString(w, p.Username, 16); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{1}); err != nil {
+		return err
+	}
+
+	uuidBytes, err := p.UUID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(uuidBytes)
+	return err
+}
+
+// DecodeVersion декодирует пакет в формате версии
+func (p *LoginStartPacket) DecodeVersion(r io.Reader, v *minecraft.Profile) error {
+	if !v.OptionalLoginUUID {
+		return p.Decode(r)
+	}
+
+	var err error
+	p.Username, err = minecraft.ReadString(r, 16)
+	if err != nil {
+		return err
+	}
+
+	hasUUID := make([]byte, 1)
+	if _, err := io.ReadFull(r, hasUUID); err != nil {
+		return err
+	}
+	if hasUUID[0] == 0 {
+		return fmt.Errorf("login start without UUID")
+	}
+
+	uuidBytes := make([]byte, 16)
+	if _, err := io.ReadFull(r, uuidBytes); err != nil {
+		return err
+	}
+
+	p.UUID, err = uuid.FromBytes(uuidBytes)
+	return err
+}
+
+// LoginAcknowledgedPacket - подтверждение LoginSuccess (1.20.2+)
+// После него клиент и сервер переходят в фазу Configuration
+type LoginAcknowledgedPacket struct{}
+
+func (p *LoginAcknowledgedPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeLoginAcknowledged
+}
+
+func (p *LoginAcknowledgedPacket) Encode(w io.Writer) error {
+	return nil
+}
+
+func (p *LoginAcknowledgedPacket) Decode(r io.Reader) error {
+	return nil
+}
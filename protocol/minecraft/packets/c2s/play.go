@@ -0,0 +1,142 @@
+package c2s
+
+import (
+	"encoding/binary"
+	"io"
+	"koria-core/protocol/minecraft"
+)
+
+// ConfirmTeleportPacket - подтверждение телепорта от сервера
+// Packet ID: 0x00
+type ConfirmTeleportPacket struct {
+	TeleportID int32
+}
+
+func (p *ConfirmTeleportPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfirmTeleport
+}
+
+func (p *ConfirmTeleportPacket) Encode(w io.Writer) error {
+	return minecraft.WriteVarInt(w, p.TeleportID)
+}
+
+func (p *ConfirmTeleportPacket) Decode(r io.Reader) error {
+	var err error
+	p.TeleportID, err = minecraft.ReadVarInt(r)
+	return err
+}
+
+// ChunkBatchReceivedPacket - ответ на конец пачки чанков
+// Packet ID: 0x07
+type ChunkBatchReceivedPacket struct {
+	ChunksPerTick float32 // Желаемая скорость отправки чанков
+}
+
+func (p *ChunkBatchReceivedPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeChunkBatchReceived
+}
+
+func (p *ChunkBatchReceivedPacket) Encode(w io.Writer) error {
+	return minecraft.WriteFloat(w, p.ChunksPerTick)
+}
+
+func (p *ChunkBatchReceivedPacket) Decode(r io.Reader) error {
+	var err error
+	p.ChunksPerTick, err = minecraft.ReadFloat(r)
+	return err
+}
+
+// ClientInformationPacket - настройки клиента (язык, дальность прорисовки и т.д.)
+// Packet ID: 0x09
+type ClientInformationPacket struct {
+	Locale              string // Например, "en_us"
+	ViewDistance        int8
+	ChatMode            int32 // 0 = enabled, 1 = commands only, 2 = hidden
+	ChatColors          bool
+	DisplayedSkinParts  uint8
+	MainHand            int32 // 0 = left, 1 = right
+	EnableTextFiltering bool
+	AllowServerListings bool
+}
+
+func (p *ClientInformationPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeClientInformation
+}
+
+func (p *ClientInformationPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteString(w, p.Locale, 16); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{byte(p.ViewDistance)}); err != nil {
+		return err
+	}
+	if err := minecraft.WriteVarInt(w, p.ChatMode); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{byte(boolToInt(p.ChatColors)), p.DisplayedSkinParts}); err != nil {
+		return err
+	}
+	if err := minecraft.WriteVarInt(w, p.MainHand); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{byte(boolToInt(p.EnableTextFiltering)), byte(boolToInt(p.AllowServerListings))})
+	return err
+}
+
+func (p *ClientInformationPacket) Decode(r io.Reader) error {
+	var err error
+
+	p.Locale, err = minecraft.ReadString(r, 16)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	p.ViewDistance = int8(buf[0])
+
+	p.ChatMode, err = minecraft.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	flags := make([]byte, 2)
+	if _, err := io.ReadFull(r, flags); err != nil {
+		return err
+	}
+	p.ChatColors = flags[0] != 0
+	p.DisplayedSkinParts = flags[1]
+
+	p.MainHand, err = minecraft.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(r, flags); err != nil {
+		return err
+	}
+	p.EnableTextFiltering = flags[0] != 0
+	p.AllowServerListings = flags[1] != 0
+
+	return nil
+}
+
+// KeepAlivePacket - ответ на Keep Alive сервера (тот же ID)
+// Packet ID: 0x15
+type KeepAlivePacket struct {
+	ID int64
+}
+
+func (p *KeepAlivePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeKeepAliveC2S
+}
+
+func (p *KeepAlivePacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+func (p *KeepAlivePacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
@@ -0,0 +1,327 @@
+package s2c
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"koria-core/protocol/minecraft"
+)
+
+// ConfigPluginMessagePacket - сообщение plugin-канала в фазе Configuration
+// Packet ID: 0x00
+// Сервер отправляет в нем minecraft:brand до начала игры
+type ConfigPluginMessagePacket struct {
+	Channel string
+	Data    []byte
+}
+
+// PacketID возвращает ID пакета
+func (p *ConfigPluginMessagePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigPluginMessageS2C
+}
+
+// Encode кодирует пакет
+func (p *ConfigPluginMessagePacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteString(w, p.Channel, 32767); err != nil {
+		return err
+	}
+	_, err := w.Write(p.Data)
+	return err
+}
+
+// Decode декодирует пакет
+func (p *ConfigPluginMessagePacket) Decode(r io.Reader) error {
+	var err error
+	p.Channel, err = minecraft.ReadString(r, 32767)
+	if err != nil {
+		return err
+	}
+	p.Data, err = io.ReadAll(r)
+	return err
+}
+
+// FinishConfigurationPacket - конец фазы Configuration, клиент должен подтвердить
+// Packet ID: 0x02
+type FinishConfigurationPacket struct{}
+
+// PacketID возвращает ID пакета
+func (p *FinishConfigurationPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeFinishConfiguration
+}
+
+// Encode кодирует пакет (пакет без полей)
+func (p *FinishConfigurationPacket) Encode(w io.Writer) error {
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *FinishConfigurationPacket) Decode(r io.Reader) error {
+	return nil
+}
+
+// ConfigKeepAlivePacket - проверка соединения в фазе Configuration
+// Packet ID: 0x03
+type ConfigKeepAlivePacket struct {
+	ID int64
+}
+
+// PacketID возвращает ID пакета
+func (p *ConfigKeepAlivePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigKeepAliveS2C
+}
+
+// Encode кодирует пакет
+func (p *ConfigKeepAlivePacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+// Decode декодирует пакет
+func (p *ConfigKeepAlivePacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
+
+// ConfigPingPacket - ping в фазе Configuration, клиент отвечает Pong с тем же ID
+// Packet ID: 0x04
+type ConfigPingPacket struct {
+	ID int32
+}
+
+// PacketID возвращает ID пакета
+func (p *ConfigPingPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeConfigPing
+}
+
+// Encode кодирует пакет
+func (p *ConfigPingPacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+// Decode декодирует пакет
+func (p *ConfigPingPacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
+
+// RegistryDataPacket - реестры сервера (типы измерений, биомы, чат, урон)
+// Packet ID: 0x05
+// В 1.20.2-1.20.4 все реестры передаются одним NBT тегом
+type RegistryDataPacket struct {
+	Codec minecraft.NBTCompound
+}
+
+// PacketID возвращает ID пакета
+func (p *RegistryDataPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeRegistryData
+}
+
+// Encode кодирует пакет
+func (p *RegistryDataPacket) Encode(w io.Writer) error {
+	return minecraft.WriteNBT(w, p.Codec)
+}
+
+// Decode декодирует пакет
+func (p *RegistryDataPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// RegistryEntry элемент реестра в Registry Data 1.20.5+
+type RegistryEntry struct {
+	ID   string
+	Data minecraft.NBTCompound // nil - клиент берет данные из известного пакета данных
+}
+
+// RegistryEntriesPacket - один реестр сервера (1.20.5+)
+// Packet ID: 0x07 (1.21)
+// С 1.20.5 каждый реестр передается отдельным пакетом со списком элементов
+type RegistryEntriesPacket struct {
+	Registry string
+	Entries  []RegistryEntry
+}
+
+// PacketID возвращает ID пакета
+func (p *RegistryEntriesPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeRegistryData
+}
+
+// Encode кодирует пакет
+func (p *RegistryEntriesPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteString(w, p.Registry, 32767); err != nil {
+		return err
+	}
+	if err := minecraft.WriteVarInt(w, int32(len(p.Entries))); err != nil {
+		return err
+	}
+	for _, entry := range p.Entries {
+		if err := minecraft.WriteString(w, entry.ID, 32767); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{boolToByte(entry.Data != nil)}); err != nil {
+			return err
+		}
+		if entry.Data != nil {
+			if err := minecraft.WriteNBT(w, entry.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *RegistryEntriesPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// KnownPack пакет данных, который есть у обеих сторон
+type KnownPack struct {
+	Namespace string
+	ID        string
+	Version   string
+}
+
+// KnownPacksPacket - пакеты данных сервера (1.20.5+)
+// Packet ID: 0x0E (1.21)
+// Клиент отвечает списком тех, что у него есть; их реестры не передаются
+type KnownPacksPacket struct {
+	Packs []KnownPack
+}
+
+// PacketID возвращает ID пакета
+func (p *KnownPacksPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeKnownPacksS2C
+}
+
+// Encode кодирует пакет
+func (p *KnownPacksPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteVarInt(w, int32(len(p.Packs))); err != nil {
+		return err
+	}
+	for _, pack := range p.Packs {
+		for _, s := range []string{pack.Namespace, pack.ID, pack.Version} {
+			if err := minecraft.WriteString(w, s, 32767); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *KnownPacksPacket) Decode(r io.Reader) error {
+	count, err := minecraft.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count < 0 || count > 64 {
+		return fmt.Errorf("invalid known pack count: %d", count)
+	}
+
+	p.Packs = make([]KnownPack, count)
+	for i := range p.Packs {
+		for _, s := range []*string{&p.Packs[i].Namespace, &p.Packs[i].ID, &p.Packs[i].Version} {
+			if *s, err = minecraft.ReadString(r, 32767); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FeatureFlagsPacket - включенные наборы возможностей ("minecraft:vanilla")
+// Packet ID: 0x08
+type FeatureFlagsPacket struct {
+	Flags []string
+}
+
+// PacketID возвращает ID пакета
+func (p *FeatureFlagsPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeFeatureFlags
+}
+
+// Encode кодирует пакет
+func (p *FeatureFlagsPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteVarInt(w, int32(len(p.Flags))); err != nil {
+		return err
+	}
+	for _, flag := range p.Flags {
+		if err := minecraft.WriteString(w, flag, 32767); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *FeatureFlagsPacket) Decode(r io.Reader) error {
+	count, err := minecraft.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count < 0 || count > 64 {
+		return fmt.Errorf("invalid feature flag count: %d", count)
+	}
+
+	p.Flags = make([]string, count)
+	for i := range p.Flags {
+		if p.Flags[i], err = minecraft.ReadString(r, 32767); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TagGroup теги одного реестра ("minecraft:fluid", "minecraft:block", ...)
+type TagGroup struct {
+	Registry string
+	Tags     []Tag
+}
+
+// Tag именованный набор ID элементов реестра
+type Tag struct {
+	Name    string
+	Entries []int32
+}
+
+// UpdateTagsPacket - теги реестров
+// Packet ID: 0x09
+type UpdateTagsPacket struct {
+	Groups []TagGroup
+}
+
+// PacketID возвращает ID пакета
+func (p *UpdateTagsPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeUpdateTags
+}
+
+// Encode кодирует пакет
+func (p *UpdateTagsPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteVarInt(w, int32(len(p.Groups))); err != nil {
+		return err
+	}
+	for _, group := range p.Groups {
+		if err := minecraft.WriteString(w, group.Registry, 32767); err != nil {
+			return err
+		}
+		if err := minecraft.WriteVarInt(w, int32(len(group.Tags))); err != nil {
+			return err
+		}
+		for _, tag := range group.Tags {
+			if err := minecraft.WriteString(w, tag.Name, 32767); err != nil {
+				return err
+			}
+			if err := minecraft.WriteVarInt(w, int32(len(tag.Entries))); err != nil {
+				return err
+			}
+			for _, entry := range tag.Entries {
+				if err := minecraft.WriteVarInt(w, entry); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *UpdateTagsPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
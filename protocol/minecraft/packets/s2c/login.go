@@ -11,6 +11,8 @@ type LoginSuccessPacket struct {
 	UUID       uuid.UUID // UUID игрока
 	Username   string    // Username игрока
 	Properties []Property // Дополнительные свойства (текстуры и т.д.)
+
+	StrictErrorHandling bool // Отключаться при ошибке обработки пакета (1.20.5+)
 }
 
 type Property struct {
@@ -126,13 +128,41 @@ func (p *LoginSuccessPacket) Decode(r io.Reader) error {
 	return nil
 }
 
+// EncodeVersion кодирует пакет в формате версии
+func (p *LoginSuccessPacket) EncodeVersion(w io.Writer, v *minecraft.Profile) error {
+	if err := p.Encode(w); err != nil {
+		return err
+	}
+	if !v.StrictErrorHandling {
+		return nil
+	}
+	_, err := w.Write([]byte{boolToByte(p.StrictErrorHandling)})
+	return err
+}
+
+// DecodeVersion декодирует пакет в формате версии
+func (p *LoginSuccessPacket) DecodeVersion(r io.Reader, v *minecraft.Profile) error {
+	if err := p.Decode(r); err != nil {
+		return err
+	}
+	if !v.StrictErrorHandling {
+		return nil
+	}
+	flag := make([]byte, 1)
+	if _, err := io.ReadFull(r, flag); err != nil {
+		return err
+	}
+	p.StrictErrorHandling = flag[0] != 0
+	return nil
+}
+
 // LoginDisconnectPacket - отключение во время логина
 type LoginDisconnectPacket struct {
 	Reason string // JSON формат (Chat component)
 }
 
 func (p *LoginDisconnectPacket) PacketID() minecraft.PacketType {
-	return 0x00 // LOGIN_DISCONNECT
+	return minecraft.PacketTypeLoginDisconnect
 }
 
 func (p *LoginDisconnectPacket) Encode(w io.Writer) error {
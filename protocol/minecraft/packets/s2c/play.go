@@ -0,0 +1,629 @@
+package s2c
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"koria-core/protocol/minecraft"
+)
+
+// LoginPlayPacket - первый пакет Play фазы, описывает мир и игрока
+// Packet ID: 0x29
+type LoginPlayPacket struct {
+	EntityID            int32
+	IsHardcore          bool
+	DimensionNames      []string // Измерения сервера ("minecraft:overworld", ...)
+	MaxPlayers          int32
+	ViewDistance        int32
+	SimulationDistance  int32
+	ReducedDebugInfo    bool
+	EnableRespawnScreen bool
+	DoLimitedCrafting   bool
+	RegistryCodec       minecraft.NBTCompound // Реестры (только до 1.20.2)
+	DimensionType       string                // Тип измерения, в котором появляется игрок
+	DimensionTypeID     int32                 // ID типа измерения в реестре (1.20.5+)
+	DimensionName       string                // Имя измерения, в котором появляется игрок
+	HashedSeed          int64
+	GameMode            uint8
+	PreviousGameMode    int8 // -1 = нет предыдущего режима
+	IsDebug             bool
+	IsFlat              bool
+	PortalCooldown      int32
+	EnforcesSecureChat  bool // 1.20.5+
+}
+
+// PacketID возвращает ID пакета
+func (p *LoginPlayPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeLoginPlay
+}
+
+// Encode кодирует пакет в формате 1.20.4
+func (p *LoginPlayPacket) Encode(w io.Writer) error {
+	return p.EncodeVersion(w, minecraft.Version1_20_4)
+}
+
+// EncodeVersion кодирует пакет в формате версии
+// До 1.20.2 пакет несет реестры и режим игры в начале, с 1.20.5 тип измерения - ID
+func (p *LoginPlayPacket) EncodeVersion(w io.Writer, v *minecraft.Profile) error {
+	if err := binary.Write(w, binary.BigEndian, p.EntityID); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{boolToByte(p.IsHardcore)}); err != nil {
+		return err
+	}
+
+	if !v.Configuration {
+		if _, err := w.Write([]byte{p.GameMode, byte(p.PreviousGameMode)}); err != nil {
+			return err
+		}
+	}
+
+	// Dimension names
+	if err := minecraft.WriteVarInt(w, int32(len(p.DimensionNames))); err != nil {
+		return err
+	}
+	for _, name := range p.DimensionNames {
+		if err := minecraft.WriteString(w, name, 32767); err != nil {
+			return err
+		}
+	}
+
+	if !v.Configuration {
+		// Реестры до 1.20.2 передаются здесь, а не в Registry Data
+		if err := v.WriteNBT(w, p.RegistryCodec); err != nil {
+			return err
+		}
+		if err := p.writeSpawnDimension(w, v); err != nil {
+			return err
+		}
+	}
+
+	for _, val := range []int32{p.MaxPlayers, p.ViewDistance, p.SimulationDistance} {
+		if err := minecraft.WriteVarInt(w, val); err != nil {
+			return err
+		}
+	}
+
+	flags := []byte{
+		boolToByte(p.ReducedDebugInfo),
+		boolToByte(p.EnableRespawnScreen),
+	}
+	if v.Configuration {
+		flags = append(flags, boolToByte(p.DoLimitedCrafting))
+	}
+	if _, err := w.Write(flags); err != nil {
+		return err
+	}
+
+	var tail []byte
+	if v.Configuration {
+		if err := p.writeSpawnDimension(w, v); err != nil {
+			return err
+		}
+		tail = append(tail, p.GameMode, byte(p.PreviousGameMode))
+	}
+
+	// Is debug, is flat, has death location
+	tail = append(tail,
+		boolToByte(p.IsDebug),
+		boolToByte(p.IsFlat),
+		0, // Нет точки смерти
+	)
+	if _, err := w.Write(tail); err != nil {
+		return err
+	}
+
+	if v.PortalCooldown {
+		if err := minecraft.WriteVarInt(w, p.PortalCooldown); err != nil {
+			return err
+		}
+	}
+	if v.EnforcesSecureChat {
+		if _, err := w.Write([]byte{boolToByte(p.EnforcesSecureChat)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSpawnDimension записывает тип и имя измерения и hashed seed
+func (p *LoginPlayPacket) writeSpawnDimension(w io.Writer, v *minecraft.Profile) error {
+	if v.DimensionTypeByID {
+		if err := minecraft.WriteVarInt(w, p.DimensionTypeID); err != nil {
+			return err
+		}
+	} else if err := minecraft.WriteString(w, p.DimensionType, 32767); err != nil {
+		return err
+	}
+	if err := minecraft.WriteString(w, p.DimensionName, 32767); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, p.HashedSeed)
+}
+
+// Decode декодирует пакет
+func (p *LoginPlayPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// DecodeVersion декодирует пакет в формате версии
+func (p *LoginPlayPacket) DecodeVersion(r io.Reader, v *minecraft.Profile) error {
+	return p.Decode(r)
+}
+
+// ChangeDifficultyPacket - сложность мира
+// Packet ID: 0x0B
+type ChangeDifficultyPacket struct {
+	Difficulty uint8 // 0 = peaceful, 1 = easy, 2 = normal, 3 = hard
+	Locked     bool
+}
+
+// PacketID возвращает ID пакета
+func (p *ChangeDifficultyPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeChangeDifficulty
+}
+
+// Encode кодирует пакет
+func (p *ChangeDifficultyPacket) Encode(w io.Writer) error {
+	_, err := w.Write([]byte{p.Difficulty, boolToByte(p.Locked)})
+	return err
+}
+
+// Decode декодирует пакет
+func (p *ChangeDifficultyPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// PlayerAbilitiesPacket - способности игрока (полет, неуязвимость)
+// Packet ID: 0x36
+type PlayerAbilitiesPacket struct {
+	Flags       uint8
+	FlyingSpeed float32 // 0.05 по умолчанию
+	FOVModifier float32 // 0.1 по умолчанию
+}
+
+// PacketID возвращает ID пакета
+func (p *PlayerAbilitiesPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypePlayerAbilities
+}
+
+// Encode кодирует пакет
+func (p *PlayerAbilitiesPacket) Encode(w io.Writer) error {
+	if _, err := w.Write([]byte{p.Flags}); err != nil {
+		return err
+	}
+	if err := minecraft.WriteFloat(w, p.FlyingSpeed); err != nil {
+		return err
+	}
+	return minecraft.WriteFloat(w, p.FOVModifier)
+}
+
+// Decode декодирует пакет
+func (p *PlayerAbilitiesPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// SetHeldItemPacket - выбранный слот хотбара
+// Packet ID: 0x51
+type SetHeldItemPacket struct {
+	Slot int8 // 0-8
+}
+
+// PacketID возвращает ID пакета
+func (p *SetHeldItemPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeSetHeldItem
+}
+
+// Encode кодирует пакет
+func (p *SetHeldItemPacket) Encode(w io.Writer) error {
+	_, err := w.Write([]byte{byte(p.Slot)})
+	return err
+}
+
+// Decode декодирует пакет
+func (p *SetHeldItemPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// SyncPlayerPositionPacket - телепорт игрока, клиент подтверждает его TeleportID
+// Packet ID: 0x3E
+type SyncPlayerPositionPacket struct {
+	X, Y, Z    float64
+	Yaw, Pitch float32
+	Flags      uint8 // Битовая маска относительных координат
+	TeleportID int32
+}
+
+// PacketID возвращает ID пакета
+func (p *SyncPlayerPositionPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeSyncPlayerPosition
+}
+
+// Encode кодирует пакет
+func (p *SyncPlayerPositionPacket) Encode(w io.Writer) error {
+	for _, v := range []float64{p.X, p.Y, p.Z} {
+		if err := minecraft.WriteDouble(w, v); err != nil {
+			return err
+		}
+	}
+	if err := minecraft.WriteFloat(w, p.Yaw); err != nil {
+		return err
+	}
+	if err := minecraft.WriteFloat(w, p.Pitch); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{p.Flags}); err != nil {
+		return err
+	}
+	return minecraft.WriteVarInt(w, p.TeleportID)
+}
+
+// Decode декодирует пакет
+func (p *SyncPlayerPositionPacket) Decode(r io.Reader) error {
+	var err error
+	if p.X, err = minecraft.ReadDouble(r); err != nil {
+		return err
+	}
+	if p.Y, err = minecraft.ReadDouble(r); err != nil {
+		return err
+	}
+	if p.Z, err = minecraft.ReadDouble(r); err != nil {
+		return err
+	}
+	if p.Yaw, err = minecraft.ReadFloat(r); err != nil {
+		return err
+	}
+	if p.Pitch, err = minecraft.ReadFloat(r); err != nil {
+		return err
+	}
+
+	flags := make([]byte, 1)
+	if _, err := io.ReadFull(r, flags); err != nil {
+		return err
+	}
+	p.Flags = flags[0]
+
+	p.TeleportID, err = minecraft.ReadVarInt(r)
+	return err
+}
+
+// CustomPayloadPacket - сообщение plugin-канала в фазе Play
+// Packet ID: 0x18
+type CustomPayloadPacket struct {
+	Channel string
+	Data    []byte
+}
+
+// PacketID возвращает ID пакета
+func (p *CustomPayloadPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeCustomPayloadS2C
+}
+
+// Encode кодирует пакет
+func (p *CustomPayloadPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteString(w, p.Channel, 32767); err != nil {
+		return err
+	}
+	_, err := w.Write(p.Data)
+	return err
+}
+
+// Decode декодирует пакет
+func (p *CustomPayloadPacket) Decode(r io.Reader) error {
+	var err error
+	p.Channel, err = minecraft.ReadString(r, 32767)
+	if err != nil {
+		return err
+	}
+	p.Data, err = io.ReadAll(r)
+	return err
+}
+
+// SetDefaultSpawnPacket - точка спавна мира (на нее указывает компас)
+// Packet ID: 0x54
+type SetDefaultSpawnPacket struct {
+	X, Y, Z int32
+	Angle   float32
+}
+
+// PacketID возвращает ID пакета
+func (p *SetDefaultSpawnPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeSetDefaultSpawn
+}
+
+// Encode кодирует пакет
+func (p *SetDefaultSpawnPacket) Encode(w io.Writer) error {
+	// Position: ((x & 0x3FFFFFF) << 38) | ((z & 0x3FFFFFF) << 12) | (y & 0xFFF)
+	pos := ((int64(p.X) & 0x3FFFFFF) << 38) | ((int64(p.Z) & 0x3FFFFFF) << 12) | (int64(p.Y) & 0xFFF)
+	if err := binary.Write(w, binary.BigEndian, pos); err != nil {
+		return err
+	}
+	return minecraft.WriteFloat(w, p.Angle)
+}
+
+// Decode декодирует пакет
+func (p *SetDefaultSpawnPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// Игровые события GameEventPacket
+const (
+	GameEventChangeGameMode        uint8 = 3
+	GameEventStartWaitingForChunks uint8 = 13
+)
+
+// GameEventPacket - игровое событие (смена режима, ожидание чанков и т.д.)
+// Packet ID: 0x20
+type GameEventPacket struct {
+	Event uint8
+	Value float32
+}
+
+// PacketID возвращает ID пакета
+func (p *GameEventPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeGameEvent
+}
+
+// Encode кодирует пакет
+func (p *GameEventPacket) Encode(w io.Writer) error {
+	if _, err := w.Write([]byte{p.Event}); err != nil {
+		return err
+	}
+	return minecraft.WriteFloat(w, p.Value)
+}
+
+// Decode декодирует пакет
+func (p *GameEventPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// SetCenterChunkPacket - чанк, вокруг которого клиент держит загруженную область
+// Packet ID: 0x52
+type SetCenterChunkPacket struct {
+	ChunkX, ChunkZ int32
+}
+
+// PacketID возвращает ID пакета
+func (p *SetCenterChunkPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeSetCenterChunk
+}
+
+// Encode кодирует пакет
+func (p *SetCenterChunkPacket) Encode(w io.Writer) error {
+	if err := minecraft.WriteVarInt(w, p.ChunkX); err != nil {
+		return err
+	}
+	return minecraft.WriteVarInt(w, p.ChunkZ)
+}
+
+// Decode декодирует пакет
+func (p *SetCenterChunkPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// ChunkBatchStartPacket - начало пачки чанков (пустой пакет)
+// Packet ID: 0x0D
+type ChunkBatchStartPacket struct{}
+
+// PacketID возвращает ID пакета
+func (p *ChunkBatchStartPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeChunkBatchStart
+}
+
+// Encode кодирует пакет
+func (p *ChunkBatchStartPacket) Encode(w io.Writer) error {
+	return nil
+}
+
+// Decode декодирует пакет
+func (p *ChunkBatchStartPacket) Decode(r io.Reader) error {
+	return nil
+}
+
+// ChunkBatchFinishedPacket - конец пачки чанков, клиент отвечает ChunkBatchReceived
+// Packet ID: 0x0C
+type ChunkBatchFinishedPacket struct {
+	BatchSize int32
+}
+
+// PacketID возвращает ID пакета
+func (p *ChunkBatchFinishedPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeChunkBatchFinished
+}
+
+// Encode кодирует пакет
+func (p *ChunkBatchFinishedPacket) Encode(w io.Writer) error {
+	return minecraft.WriteVarInt(w, p.BatchSize)
+}
+
+// Decode декодирует пакет
+func (p *ChunkBatchFinishedPacket) Decode(r io.Reader) error {
+	var err error
+	p.BatchSize, err = minecraft.ReadVarInt(r)
+	return err
+}
+
+// KeepAlivePacket - проверка соединения, клиент должен вернуть тот же ID
+// Packet ID: 0x24
+type KeepAlivePacket struct {
+	ID int64
+}
+
+// PacketID возвращает ID пакета
+func (p *KeepAlivePacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeKeepAliveS2C
+}
+
+// Encode кодирует пакет
+func (p *KeepAlivePacket) Encode(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, p.ID)
+}
+
+// Decode декодирует пакет
+func (p *KeepAlivePacket) Decode(r io.Reader) error {
+	return binary.Read(r, binary.BigEndian, &p.ID)
+}
+
+const (
+	// ChunkSections количество секций в чанке обычного мира (Y от -64 до 320)
+	ChunkSections = 24
+	// chunkMinY нижняя граница мира
+	chunkMinY = -64
+)
+
+// ChunkDataPacket - чанк с блоками и освещением
+// Packet ID: 0x25
+// Каждая секция заполнена одним блоком (палитра из одного значения), как
+// в плоском мире: GroundSections нижних секций из GroundBlock, выше воздух
+type ChunkDataPacket struct {
+	ChunkX, ChunkZ int32
+	GroundSections int   // Количество заполненных секций снизу
+	GroundBlock    int32 // ID состояния блока земли (1 = stone)
+	Biome          int32 // ID биома в реестре
+}
+
+// NewFlatChunk создает чанк плоского мира с поверхностью на высоте Y=0
+func NewFlatChunk(chunkX, chunkZ int32) *ChunkDataPacket {
+	return &ChunkDataPacket{
+		ChunkX:         chunkX,
+		ChunkZ:         chunkZ,
+		GroundSections: 4, // Y от -64 до -1
+		GroundBlock:    1,
+		Biome:          0,
+	}
+}
+
+// SurfaceY возвращает высоту, на которой стоит игрок
+func (p *ChunkDataPacket) SurfaceY() int32 {
+	return chunkMinY + int32(p.GroundSections)*16
+}
+
+// PacketID возвращает ID пакета
+func (p *ChunkDataPacket) PacketID() minecraft.PacketType {
+	return minecraft.PacketTypeChunkData
+}
+
+// Encode кодирует пакет в формате 1.20.4
+func (p *ChunkDataPacket) Encode(w io.Writer) error {
+	return p.EncodeVersion(w, minecraft.Version1_20_4)
+}
+
+// EncodeVersion кодирует пакет в формате версии
+func (p *ChunkDataPacket) EncodeVersion(w io.Writer, v *minecraft.Profile) error {
+	if err := binary.Write(w, binary.BigEndian, p.ChunkX); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, p.ChunkZ); err != nil {
+		return err
+	}
+
+	// Heightmaps: 256 значений по 9 бит, по 7 значений в long
+	height := int64(p.GroundSections * 16)
+	heightmap := make([]int64, 37)
+	for i := 0; i < 256; i++ {
+		heightmap[i/7] |= height << (uint(i%7) * 9)
+	}
+	heightmaps := minecraft.NBTCompound{
+		{Name: "MOTION_BLOCKING", Value: heightmap},
+		{Name: "WORLD_SURFACE", Value: heightmap},
+	}
+	if err := v.WriteNBT(w, heightmaps); err != nil {
+		return err
+	}
+
+	// Секции
+	var sections bytes.Buffer
+	for i := 0; i < ChunkSections; i++ {
+		block, count := int32(0), int16(0)
+		if i < p.GroundSections {
+			block, count = p.GroundBlock, 4096
+		}
+
+		binary.Write(&sections, binary.BigEndian, count)
+		// Блоки: 0 бит на значение, палитра из одного блока, пустой массив данных
+		sections.WriteByte(0)
+		minecraft.WriteVarInt(&sections, block)
+		minecraft.WriteVarInt(&sections, 0)
+		// Биомы: аналогично, один биом на секцию
+		sections.WriteByte(0)
+		minecraft.WriteVarInt(&sections, p.Biome)
+		minecraft.WriteVarInt(&sections, 0)
+	}
+
+	if err := minecraft.WriteVarInt(w, int32(sections.Len())); err != nil {
+		return err
+	}
+	if _, err := w.Write(sections.Bytes()); err != nil {
+		return err
+	}
+
+	// Block entities
+	if err := minecraft.WriteVarInt(w, 0); err != nil {
+		return err
+	}
+
+	// Освещение: секции от -1 до ChunkSections (на одну больше с каждой стороны)
+	// Небо освещено полностью над землей, под землей света нет
+	var skyMask, emptySkyMask int64
+	for i := 0; i < ChunkSections+2; i++ {
+		if i > p.GroundSections {
+			skyMask |= 1 << uint(i)
+		} else {
+			emptySkyMask |= 1 << uint(i)
+		}
+	}
+	emptyBlockMask := int64(1)<<uint(ChunkSections+2) - 1
+
+	if v.LightTrustEdges {
+		if _, err := w.Write([]byte{1}); err != nil {
+			return err
+		}
+	}
+
+	for _, mask := range []int64{skyMask, 0, emptySkyMask, emptyBlockMask} {
+		if err := writeBitSet(w, mask); err != nil {
+			return err
+		}
+	}
+
+	// Sky light arrays
+	fullLight := bytes.Repeat([]byte{0xFF}, 2048)
+	skyArrays := ChunkSections + 1 - p.GroundSections
+	if err := minecraft.WriteVarInt(w, int32(skyArrays)); err != nil {
+		return err
+	}
+	for i := 0; i < skyArrays; i++ {
+		if err := minecraft.WriteVarInt(w, int32(len(fullLight))); err != nil {
+			return err
+		}
+		if _, err := w.Write(fullLight); err != nil {
+			return err
+		}
+	}
+
+	// Block light arrays
+	return minecraft.WriteVarInt(w, 0)
+}
+
+// Decode декодирует пакет
+func (p *ChunkDataPacket) Decode(r io.Reader) error {
+	return fmt.Errorf("decode not implemented for server packet")
+}
+
+// DecodeVersion декодирует пакет в формате версии
+func (p *ChunkDataPacket) DecodeVersion(r io.Reader, v *minecraft.Profile) error {
+	return p.Decode(r)
+}
+
+// writeBitSet записывает BitSet из одного long (пустой BitSet - нулевая длина)
+func writeBitSet(w io.Writer, bits int64) error {
+	if bits == 0 {
+		return minecraft.WriteVarInt(w, 0)
+	}
+	if err := minecraft.WriteVarInt(w, 1); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, bits)
+}
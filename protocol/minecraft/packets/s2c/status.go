@@ -16,10 +16,10 @@ type StatusResponsePacket struct {
 
 // StatusResponse структура JSON ответа
 type StatusResponse struct {
-	Version     StatusVersion     `json:"version"`
-	Players     StatusPlayers     `json:"players"`
-	Description StatusDescription `json:"description"`
-	Favicon     string            `json:"favicon,omitempty"`
+	Version     StatusVersion   `json:"version"`
+	Players     StatusPlayers   `json:"players"`
+	Description json.RawMessage `json:"description"` // Chat component: {"text": ...} или сложнее
+	Favicon     string          `json:"favicon,omitempty"`
 }
 
 type StatusVersion struct {
@@ -53,10 +53,11 @@ func (p *StatusResponsePacket) Encode(w io.Writer) error {
 	return minecraft.WriteString(w, p.JSONResponse, 32767)
 }
 
-// Decode декодирует пакет
+// Decode декодирует пакет (нужен для зеркалирования статуса настоящего сервера)
 func (p *StatusResponsePacket) Decode(reader io.Reader) error {
-	// Для Status Response обычно не нужен decode на сервере
-	return fmt.Errorf("decode not implemented for server packet")
+	var err error
+	p.JSONResponse, err = minecraft.ReadString(reader, 32767)
+	return err
 }
 
 // PongResponsePacket - ответ на Ping Request
@@ -94,10 +95,8 @@ func NewStatusResponse(serverName string, maxPlayers, onlinePlayers int) *Status
 			Online: onlinePlayers,
 			Sample: []StatusPlayerSample{},
 		},
-		Description: StatusDescription{
-			Text: serverName,
-		},
 	}
+	response.Description, _ = json.Marshal(StatusDescription{Text: serverName})
 
 	jsonBytes, _ := json.Marshal(response)
 
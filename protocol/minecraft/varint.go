@@ -49,17 +49,19 @@ func ReadVarInt(r io.Reader) (int32, error) {
 // WriteVarInt записывает VarInt в writer
 func WriteVarInt(w io.Writer, value int32) error {
 	buf := make([]byte, 0, MaxVarIntLength)
+	// Отрицательные числа кодируются как uint32 (всегда 5 байт)
+	uvalue := uint32(value)
 
 	for {
 		// Если остались только данные без продолжения
-		if value&^0x7F == 0 {
-			buf = append(buf, byte(value))
+		if uvalue&^0x7F == 0 {
+			buf = append(buf, byte(uvalue))
 			break
 		}
 
 		// Записываем 7 бит данных + устанавливаем бит продолжения
-		buf = append(buf, byte(value&0x7F|0x80))
-		value >>= 7
+		buf = append(buf, byte(uvalue&0x7F|0x80))
+		uvalue >>= 7
 	}
 
 	_, err := w.Write(buf)
@@ -69,13 +71,14 @@ func WriteVarInt(w io.Writer, value int32) error {
 // VarIntSize возвращает размер VarInt в байтах
 func VarIntSize(value int32) int {
 	size := 0
+	uvalue := uint32(value)
 	for {
-		if value&^0x7F == 0 {
+		if uvalue&^0x7F == 0 {
 			size++
 			break
 		}
 		size++
-		value >>= 7
+		uvalue >>= 7
 	}
 	return size
 }
@@ -113,15 +116,16 @@ func ReadVarLong(r io.Reader) (int64, error) {
 // WriteVarLong записывает VarLong в writer
 func WriteVarLong(w io.Writer, value int64) error {
 	buf := make([]byte, 0, MaxVarLongLength)
+	uvalue := uint64(value)
 
 	for {
-		if value&^0x7F == 0 {
-			buf = append(buf, byte(value))
+		if uvalue&^0x7F == 0 {
+			buf = append(buf, byte(uvalue))
 			break
 		}
 
-		buf = append(buf, byte(value&0x7F|0x80))
-		value >>= 7
+		buf = append(buf, byte(uvalue&0x7F|0x80))
+		uvalue >>= 7
 	}
 
 	_, err := w.Write(buf)
@@ -131,13 +135,14 @@ func WriteVarLong(w io.Writer, value int64) error {
 // VarLongSize возвращает размер VarLong в байтах
 func VarLongSize(value int64) int {
 	size := 0
+	uvalue := uint64(value)
 	for {
-		if value&^0x7F == 0 {
+		if uvalue&^0x7F == 0 {
 			size++
 			break
 		}
 		size++
-		value >>= 7
+		uvalue >>= 7
 	}
 	return size
 }
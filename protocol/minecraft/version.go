@@ -0,0 +1,282 @@
+package minecraft
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Direction направление пакета
+type Direction int
+
+const (
+	Serverbound Direction = iota // Клиент -> сервер (C2S)
+	Clientbound                  // Сервер -> клиент (S2C)
+)
+
+// Profile описывает версию протокола: ID пакетов и отличия в формате полей
+// Канонические ID (константы PacketType) соответствуют 1.20.4, профиль переводит
+// их в ID своей версии. Пакеты, которых нет в таблице, имеют тот же ID, что в 1.20.4
+type Profile struct {
+	Name     string // Версия игры, например "1.20.4"
+	Protocol int32  // Номер протокола в Handshake
+
+	OptionalLoginUUID   bool // до 1.20.2: UUID в Login Start передается с флагом наличия
+	Configuration       bool // 1.20.2+: фаза Configuration и Login Acknowledged
+	ChunkBatches        bool // 1.20.2+: Chunk Batch Start/Finished
+	NamelessNBT         bool // 1.20.2+: корневой NBT тег передается без имени
+	WaitForChunksEvent  bool // 1.20.3+: Game Event "start waiting for level chunks"
+	LightTrustEdges     bool // до 1.20: поле Trust Edges в Chunk Data
+	PortalCooldown      bool // 1.20+: поле Portal Cooldown в Login (Play)
+	KnownPacks          bool // 1.20.5+: Known Packs и Registry Data по одному реестру
+	DimensionTypeByID   bool // 1.20.5+: тип измерения в Login (Play) передается ID реестра
+	EnforcesSecureChat  bool // 1.20.5+: поле Enforces Secure Chat в Login (Play)
+	StrictErrorHandling bool // 1.20.5+: поле Strict Error Handling в Login Success
+
+	ids       map[packetKey]PacketType // Канонический ID -> ID версии
+	canonical map[packetKey]PacketType // ID версии -> канонический ID
+}
+
+// packetKey идентифицирует пакет: один ID означает разные пакеты в разных фазах
+type packetKey struct {
+	phase NetworkPhase
+	dir   Direction
+	id    PacketType
+}
+
+// VersionedPacket пакет, формат полей которого зависит от версии протокола
+type VersionedPacket interface {
+	Packet
+
+	// EncodeVersion кодирует пакет в формате версии
+	EncodeVersion(w io.Writer, v *Profile) error
+
+	// DecodeVersion декодирует пакет в формате версии
+	DecodeVersion(r io.Reader, v *Profile) error
+}
+
+// newProfile создает профиль и обратную таблицу ID
+func newProfile(profile Profile, ids map[packetKey]PacketType) *Profile {
+	profile.ids = ids
+	profile.canonical = make(map[packetKey]PacketType, len(ids))
+	for key, id := range ids {
+		profile.canonical[packetKey{key.phase, key.dir, id}] = key.id
+	}
+	return &profile
+}
+
+// PacketID возвращает ID пакета в этой версии по каноническому ID
+func (v *Profile) PacketID(phase NetworkPhase, dir Direction, id PacketType) PacketType {
+	if mapped, ok := v.ids[packetKey{phase, dir, id}]; ok {
+		return mapped
+	}
+	return id
+}
+
+// CanonicalID возвращает канонический ID по ID этой версии
+// Возвращает PacketTypeUnknown, если ID занят в 1.20.4 другим пакетом
+func (v *Profile) CanonicalID(phase NetworkPhase, dir Direction, id PacketType) PacketType {
+	key := packetKey{phase, dir, id}
+	if canonical, ok := v.canonical[key]; ok {
+		return canonical
+	}
+	if _, remapped := v.ids[key]; remapped {
+		return PacketTypeUnknown
+	}
+	return id
+}
+
+// WritePacket записывает пакет с ID и форматом этой версии
+func (v *Profile) WritePacket(w io.Writer, phase NetworkPhase, dir Direction, packet Packet) error {
+	encode := packet.Encode
+	if versioned, ok := packet.(VersionedPacket); ok {
+		encode = func(w io.Writer) error {
+			return versioned.EncodeVersion(w, v)
+		}
+	}
+	return writePacket(w, v.PacketID(phase, dir, packet.PacketID()), encode)
+}
+
+// ReadPacketRaw читает пакет и возвращает его канонический ID
+func (v *Profile) ReadPacketRaw(r io.Reader, phase NetworkPhase, dir Direction) (PacketType, []byte, error) {
+	packetID, data, err := ReadPacketRaw(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return v.CanonicalID(phase, dir, packetID), data, nil
+}
+
+// DecodePacket декодирует пакет в формате этой версии
+func (v *Profile) DecodePacket(packet Packet, data []byte) error {
+	if versioned, ok := packet.(VersionedPacket); ok {
+		return versioned.DecodeVersion(bytes.NewReader(data), v)
+	}
+	return DecodePacket(packet, data)
+}
+
+// WriteNBT записывает составной тег с корнем в формате этой версии
+// До 1.20.2 у корневого тега есть (пустое) имя
+func (v *Profile) WriteNBT(w io.Writer, c NBTCompound) error {
+	if v.NamelessNBT {
+		return WriteNBT(w, c)
+	}
+	return WriteNamedNBT(w, "", c)
+}
+
+// String возвращает версию игры
+func (v *Profile) String() string {
+	return v.Name
+}
+
+// Таблица ID 1.19.4 и 1.20.1 (ID пакетов в этих версиях совпадают)
+var ids1_19_4 = map[packetKey]PacketType{
+	// Play (S2C)
+	{PhasePlay, Clientbound, PacketTypeChangeDifficulty}:   0x0C,
+	{PhasePlay, Clientbound, PacketTypeCustomPayloadS2C}:   0x17,
+	{PhasePlay, Clientbound, PacketTypeGameEvent}:          0x1F,
+	{PhasePlay, Clientbound, PacketTypeKeepAliveS2C}:       0x23,
+	{PhasePlay, Clientbound, PacketTypeChunkData}:          0x24,
+	{PhasePlay, Clientbound, PacketTypeLoginPlay}:          0x28,
+	{PhasePlay, Clientbound, PacketTypePlayerAbilities}:    0x34,
+	{PhasePlay, Clientbound, PacketTypeSyncPlayerPosition}: 0x3C,
+	{PhasePlay, Clientbound, PacketTypeSetHeldItem}:        0x4D,
+	{PhasePlay, Clientbound, PacketTypeSetCenterChunk}:     0x4E,
+	{PhasePlay, Clientbound, PacketTypeSetDefaultSpawn}:    0x50,
+
+	// Play (C2S)
+	{PhasePlay, Serverbound, PacketTypeChatMessage}:        0x05,
+	{PhasePlay, Serverbound, PacketTypeClientInformation}:  0x08,
+	{PhasePlay, Serverbound, PacketTypeCustomPayload}:      0x0D,
+	{PhasePlay, Serverbound, PacketTypeKeepAliveC2S}:       0x12,
+	{PhasePlay, Serverbound, PacketTypePlayerPosition}:     0x14,
+	{PhasePlay, Serverbound, PacketTypePlayerMove}:         0x15,
+	{PhasePlay, Serverbound, PacketTypePlayerRotation}:     0x16,
+	{PhasePlay, Serverbound, PacketTypePlayerAction}:       0x1D,
+	{PhasePlay, Serverbound, PacketTypeUpdateSelectedSlot}: 0x28,
+	{PhasePlay, Serverbound, PacketTypeHandSwing}:          0x2F,
+}
+
+// Таблица ID 1.21
+var ids1_21 = map[packetKey]PacketType{
+	// Configuration (S2C)
+	{PhaseConfiguration, Clientbound, PacketTypeConfigPluginMessageS2C}: 0x01,
+	{PhaseConfiguration, Clientbound, PacketTypeConfigDisconnect}:       0x02,
+	{PhaseConfiguration, Clientbound, PacketTypeFinishConfiguration}:    0x03,
+	{PhaseConfiguration, Clientbound, PacketTypeConfigKeepAliveS2C}:     0x04,
+	{PhaseConfiguration, Clientbound, PacketTypeConfigPing}:             0x05,
+	{PhaseConfiguration, Clientbound, PacketTypeRegistryData}:           0x07,
+	{PhaseConfiguration, Clientbound, PacketTypeFeatureFlags}:           0x0C,
+	{PhaseConfiguration, Clientbound, PacketTypeUpdateTags}:             0x0D,
+
+	// Configuration (C2S)
+	{PhaseConfiguration, Serverbound, PacketTypeConfigPluginMessageC2S}:  0x02,
+	{PhaseConfiguration, Serverbound, PacketTypeAcknowledgeFinishConfig}: 0x03,
+	{PhaseConfiguration, Serverbound, PacketTypeConfigKeepAliveC2S}:      0x04,
+	{PhaseConfiguration, Serverbound, PacketTypeConfigPong}:              0x05,
+
+	// Play (S2C)
+	{PhasePlay, Clientbound, PacketTypeCustomPayloadS2C}:   0x19,
+	{PhasePlay, Clientbound, PacketTypeGameEvent}:          0x22,
+	{PhasePlay, Clientbound, PacketTypeKeepAliveS2C}:       0x26,
+	{PhasePlay, Clientbound, PacketTypeChunkData}:          0x27,
+	{PhasePlay, Clientbound, PacketTypeLoginPlay}:          0x2B,
+	{PhasePlay, Clientbound, PacketTypePlayerAbilities}:    0x38,
+	{PhasePlay, Clientbound, PacketTypeSyncPlayerPosition}: 0x40,
+	{PhasePlay, Clientbound, PacketTypeSetHeldItem}:        0x53,
+	{PhasePlay, Clientbound, PacketTypeSetCenterChunk}:     0x54,
+	{PhasePlay, Clientbound, PacketTypeSetDefaultSpawn}:    0x56,
+
+	// Play (C2S)
+	{PhasePlay, Serverbound, PacketTypeChatMessage}:        0x06,
+	{PhasePlay, Serverbound, PacketTypeChunkBatchReceived}: 0x08,
+	{PhasePlay, Serverbound, PacketTypeClientInformation}:  0x0A,
+	{PhasePlay, Serverbound, PacketTypeCustomPayload}:      0x12,
+	{PhasePlay, Serverbound, PacketTypeKeepAliveC2S}:       0x18,
+	{PhasePlay, Serverbound, PacketTypePlayerPosition}:     0x1A,
+	{PhasePlay, Serverbound, PacketTypePlayerMove}:         0x1B,
+	{PhasePlay, Serverbound, PacketTypePlayerRotation}:     0x1C,
+	{PhasePlay, Serverbound, PacketTypePlayerAction}:       0x24,
+	{PhasePlay, Serverbound, PacketTypeUpdateSelectedSlot}: 0x2F,
+	{PhasePlay, Serverbound, PacketTypeHandSwing}:          0x36,
+}
+
+// Поддерживаемые версии протокола
+var (
+	Version1_19_4 = newProfile(Profile{
+		Name:     "1.19.4",
+		Protocol: 762,
+
+		OptionalLoginUUID: true,
+		LightTrustEdges:   true,
+	}, ids1_19_4)
+
+	Version1_20_1 = newProfile(Profile{
+		Name:     "1.20.1",
+		Protocol: 763,
+
+		OptionalLoginUUID: true,
+		PortalCooldown:    true,
+	}, ids1_19_4)
+
+	Version1_20_4 = newProfile(Profile{
+		Name:     "1.20.4",
+		Protocol: 765,
+
+		Configuration:      true,
+		ChunkBatches:       true,
+		NamelessNBT:        true,
+		WaitForChunksEvent: true,
+		PortalCooldown:     true,
+	}, nil)
+
+	Version1_21 = newProfile(Profile{
+		Name:     "1.21",
+		Protocol: 767,
+
+		Configuration:       true,
+		ChunkBatches:        true,
+		NamelessNBT:         true,
+		WaitForChunksEvent:  true,
+		PortalCooldown:      true,
+		KnownPacks:          true,
+		DimensionTypeByID:   true,
+		EnforcesSecureChat:  true,
+		StrictErrorHandling: true,
+	}, ids1_21)
+)
+
+// DefaultProfile версия, которую клиент использует, если она не задана
+var DefaultProfile = Version1_20_4
+
+// Profiles все поддерживаемые версии от старой к новой
+var Profiles = []*Profile{Version1_19_4, Version1_20_1, Version1_20_4, Version1_21}
+
+// ProfileByName возвращает профиль по версии игры ("1.20.4")
+// Пустая строка означает DefaultProfile
+func ProfileByName(name string) (*Profile, error) {
+	if name == "" {
+		return DefaultProfile, nil
+	}
+	for _, profile := range Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+
+	names := make([]string, len(Profiles))
+	for i, profile := range Profiles {
+		names[i] = profile.Name
+	}
+	return nil, fmt.Errorf("unsupported version %q (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// ProfileByProtocol возвращает профиль по номеру протокола из Handshake
+func ProfileByProtocol(protocol int32) (*Profile, bool) {
+	for _, profile := range Profiles {
+		if profile.Protocol == protocol {
+			return profile, true
+		}
+	}
+	return nil, false
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	commnet "koria-core/common/net"
 	"koria-core/protocol/minecraft"
 	c2s "koria-core/protocol/minecraft/packets/c2s"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
 	"koria-core/protocol/steganography"
 	"koria-core/stats"
 	"log"
@@ -14,6 +16,10 @@ import (
 	"time"
 )
 
+// keepAliveInterval как часто сервер отправляет Keep Alive. Vanilla сервер делает это раз
+// в 15 секунд всю игру, и соединение без них отличается от настоящего
+const keepAliveInterval = 15 * time.Second
+
 // Multiplexer управляет множественными виртуальными потоками через одно TCP соединение
 // Это ключевой компонент для решения проблемы блокировки ТСПУ
 type Multiplexer struct {
@@ -23,9 +29,11 @@ type Multiplexer struct {
 	streams   map[uint16]*Stream
 	streamsMu sync.RWMutex
 
-	// Следующий доступный ID потока
-	nextStreamID uint16
-	nextIDMu     sync.Mutex
+	// Следующий доступный ID потока и диапазон ID, которые открывает эта сторона
+	nextStreamID  uint16
+	firstStreamID uint16
+	lastStreamID  uint16
+	nextIDMu      sync.Mutex
 
 	// Каналы для новых входящих потоков и закрытия
 	acceptCh chan *Stream
@@ -35,6 +43,19 @@ type Multiplexer struct {
 	encoder  *steganography.Encoder
 	decoder  *steganography.Decoder
 	selector *steganography.PacketSelector
+	channels *steganography.ChannelRegistry
+
+	// Версия протокола, ID пакетов-носителей берутся из нее
+	version *minecraft.Profile
+
+	// Сторона соединения: сервер отправляет пакеты сервера (Clientbound) и читает
+	// пакеты клиента (Serverbound), клиент - наоборот
+	server bool
+
+	// Сборка фрагментированных фреймов
+	reassembler *steganography.Reassembler
+
+	firstFrameTimeout time.Duration
 
 	// Мьютекс для защиты записи в TCP соединение
 	// КРИТИЧНО: без этого пакеты от разных горутин перемешиваются!
@@ -45,25 +66,122 @@ type Multiplexer struct {
 	closedMu sync.RWMutex
 }
 
-// NewMultiplexer создает новый мультиплексор
+// Config настройки мультиплексора
+type Config struct {
+	// Channels пул plugin-каналов для CustomPayload (пусто = steganography.DefaultChannels)
+	Channels []string
+
+	// ChannelRegistry набор каналов, уже объявленный при входе (nil = выбрать из Channels)
+	ChannelRegistry *steganography.ChannelRegistry
+
+	// CarrierMode стратегия выбора пакетов-носителей для отправки (пусто = adaptive)
+	CarrierMode steganography.SelectorMode
+
+	// Version версия протокола, согласованная при входе (nil = minecraft.DefaultProfile)
+	Version *minecraft.Profile
+
+	// FirstFrameTimeout сколько ждать первый пакет от другой стороны (0 = без ограничения).
+	// Клиент объявляет каналы сразу после входа, молчание означает зависшее соединение
+	FirstFrameTimeout time.Duration
+
+	// Server мультиплексор серверной стороны. Сервер открывает обратные потоки (BIND)
+	// с ID из верхней половины диапазона, клиент - из нижней, поэтому ID не пересекаются
+	Server bool
+}
+
+// NewMultiplexer создает новый мультиплексор с настройками по умолчанию
 func NewMultiplexer(conn net.Conn) *Multiplexer {
+	return NewMultiplexerWithConfig(conn, nil)
+}
+
+// NewMultiplexerWithConfig создает новый мультиплексор с заданными настройками
+func NewMultiplexerWithConfig(conn net.Conn, config *Config) *Multiplexer {
+	if config == nil {
+		config = &Config{}
+	}
+
+	// Набор каналов выбирается один раз на сессию
+	channels := config.ChannelRegistry
+	if channels == nil {
+		channels = steganography.NewChannelRegistry(config.Channels)
+	}
+
+	version := config.Version
+	if version == nil {
+		version = minecraft.DefaultProfile
+	}
+
+	// 0 зарезервирован для control frames
+	firstStreamID, lastStreamID := uint16(1), uint16(0x7FFF)
+	if config.Server {
+		firstStreamID, lastStreamID = 0x8000, 0xFFFF
+	}
+
 	mux := &Multiplexer{
 		conn:     conn,
 		streams:  make(map[uint16]*Stream),
 		acceptCh: make(chan *Stream, 256),
 		closeCh:  make(chan struct{}),
-		encoder:  steganography.NewEncoder(),
+		encoder:  steganography.NewEncoder(channels),
 		decoder:  steganography.NewDecoder(),
-		selector: steganography.NewPacketSelector(),
+		selector: steganography.NewPacketSelector(config.CarrierMode),
+		channels: channels,
+		version:  version,
+		server:   config.Server,
+
+		reassembler: steganography.NewReassembler(),
+
+		nextStreamID:  firstStreamID,
+		firstStreamID: firstStreamID,
+		lastStreamID:  lastStreamID,
+
+		firstFrameTimeout: config.FirstFrameTimeout,
+	}
+
+	// Клиент до 1.20.2 объявляет каналы в Play до первого фрейма, более новый уже
+	// объявил их в Configuration. Сервер каналы не объявляет: его brand - vanilla
+	if !config.Server {
+		if err := mux.announceChannels(); err != nil {
+			log.Printf("[Multiplexer] Error announcing channels: %v", err)
+		}
 	}
 
 	// Запускаем горутину для чтения пакетов
 	go mux.readLoop()
 
+	if config.Server {
+		go mux.keepAliveLoop()
+	}
+
 	return mux
 }
 
-// OpenStream открывает новый виртуальный поток (используется клиентом)
+// announceChannels отправляет minecraft:brand и minecraft:register в фазе Play (до 1.20.2)
+// Начиная с 1.20.2 каналы объявлены в Configuration, и клиент отправляет обычный пакет
+// движения: сервер ждет первый пакет сразу после входа
+func (m *Multiplexer) announceChannels() error {
+	if m.version.Configuration {
+		return m.sendFrame(&steganography.Frame{})
+	}
+
+	if err := m.sendPacket(&c2s.CustomPayloadPacket{
+		Channel: steganography.ChannelBrand,
+		Data:    m.channels.BrandPayload(),
+	}); err != nil {
+		return fmt.Errorf("send brand: %w", err)
+	}
+
+	if err := m.sendPacket(&c2s.CustomPayloadPacket{
+		Channel: steganography.ChannelRegister,
+		Data:    m.channels.RegisterPayload(),
+	}); err != nil {
+		return fmt.Errorf("send register: %w", err)
+	}
+
+	return nil
+}
+
+// OpenStream открывает новый виртуальный поток (клиентом, а сервером - обратный для BIND)
 func (m *Multiplexer) OpenStream(ctx context.Context) (*Stream, error) {
 	m.closedMu.RLock()
 	if m.closed {
@@ -75,9 +193,10 @@ func (m *Multiplexer) OpenStream(ctx context.Context) (*Stream, error) {
 	// Получаем следующий доступный ID
 	m.nextIDMu.Lock()
 	streamID := m.nextStreamID
-	m.nextStreamID++
-	if m.nextStreamID == 0 {
-		m.nextStreamID = 1 // 0 зарезервирован для control frames
+	if m.nextStreamID == m.lastStreamID {
+		m.nextStreamID = m.firstStreamID
+	} else {
+		m.nextStreamID++
 	}
 	m.nextIDMu.Unlock()
 
@@ -120,7 +239,7 @@ func (m *Multiplexer) OpenStream(ctx context.Context) (*Stream, error) {
 	}
 }
 
-// AcceptStream ждет входящий виртуальный поток (используется сервером)
+// AcceptStream ждет входящий виртуальный поток (сервером, а клиентом - обратный для BIND)
 func (m *Multiplexer) AcceptStream() (*Stream, error) {
 	select {
 	case stream := <-m.acceptCh:
@@ -137,6 +256,12 @@ func (m *Multiplexer) readLoop() {
 		m.Close()
 	}()
 
+	// До первого пакета соединение ограничено дедлайном, потом живет сколько угодно
+	waitingFirst := m.firstFrameTimeout > 0
+	if waitingFirst {
+		commnet.SetTCPDeadlines(m.conn, m.firstFrameTimeout, 0)
+	}
+
 	for {
 		select {
 		case <-m.closeCh:
@@ -145,8 +270,12 @@ func (m *Multiplexer) readLoop() {
 		default:
 		}
 
-		// Читаем Minecraft пакет
-		packetID, data, err := minecraft.ReadPacketRaw(m.conn)
+		// Читаем Minecraft пакет другой стороны
+		packetID, data, err := m.version.ReadPacketRaw(m.conn, minecraft.PhasePlay, m.receiveDirection())
+		if err == nil && waitingFirst {
+			m.conn.SetReadDeadline(time.Time{})
+			waitingFirst = false
+		}
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("[Multiplexer] Error reading packet: %v", err)
@@ -158,30 +287,28 @@ func (m *Multiplexer) readLoop() {
 
 		// Декодируем фрейм из пакета в зависимости от типа
 		var frame *steganography.Frame
-
-		switch packetID {
-		case minecraft.PacketTypePlayerMove:
-			var pkt c2s.PlayerMovePacket
-			if err := minecraft.DecodePacket(&pkt, data); err != nil {
-				log.Printf("[Multiplexer] Error decoding PlayerMove packet: %v", err)
-				continue
-			}
-			frame, err = m.decoder.DecodeFrame(&pkt)
-		case minecraft.PacketTypeCustomPayload:
-			var pkt c2s.CustomPayloadPacket
-			if err := minecraft.DecodePacket(&pkt, data); err != nil {
-				log.Printf("[Multiplexer] Error decoding CustomPayload packet: %v", err)
-				continue
-			}
-			frame, err = m.decoder.DecodeFrameFromCustomPayload(&pkt)
-		default:
-			// Неизвестный тип пакета, пропускаем
-			log.Printf("[Multiplexer] Unknown packet type: 0x%02X, skipping", packetID)
+		if m.server {
+			frame, err = m.decodeServerbound(packetID, data)
+		} else {
+			frame, err = m.decodeClientbound(packetID, data)
+		}
+		if err != nil {
+			log.Printf("[Multiplexer] Error decoding frame: %v", err)
+			continue
+		}
+		if frame == nil {
+			// Пакет без фрейма
 			continue
 		}
 
+		// Собираем фрагменты в исходный фрейм
+		frame, err = m.reassembler.Add(frame)
 		if err != nil {
-			log.Printf("[Multiplexer] Error decoding frame: %v", err)
+			log.Printf("[Multiplexer] Error reassembling frame: %v", err)
+			continue
+		}
+		if frame == nil {
+			// Ждем остальные фрагменты
 			continue
 		}
 
@@ -190,6 +317,101 @@ func (m *Multiplexer) readLoop() {
 	}
 }
 
+// keepAliveLoop отправляет Keep Alive клиенту до закрытия мультиплексора
+// ID - время в миллисекундах, как у vanilla сервера
+func (m *Multiplexer) keepAliveLoop() {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.sendPacket(&s2c.KeepAlivePacket{ID: time.Now().UnixMilli()}); err != nil {
+			log.Printf("[Multiplexer] Error sending keep alive: %v", err)
+			return
+		}
+	}
+}
+
+// decodeServerbound извлекает фрейм из пакета клиента
+// Возвращает nil без ошибки для пакетов, которые не несут фреймов
+func (m *Multiplexer) decodeServerbound(packetID minecraft.PacketType, data []byte) (*steganography.Frame, error) {
+	switch packetID {
+	case minecraft.PacketTypePlayerMove:
+		var pkt c2s.PlayerMovePacket
+		if err := m.version.DecodePacket(&pkt, data); err != nil {
+			return nil, fmt.Errorf("decode PlayerMove packet: %w", err)
+		}
+		return m.decoder.DecodeFrame(&pkt)
+
+	case minecraft.PacketTypeCustomPayload:
+		var pkt c2s.CustomPayloadPacket
+		if err := m.version.DecodePacket(&pkt, data); err != nil {
+			return nil, fmt.Errorf("decode CustomPayload packet: %w", err)
+		}
+		// Служебные каналы (brand, register) не несут фреймов
+		if steganography.IsServiceChannel(pkt.Channel) {
+			if pkt.Channel == steganography.ChannelRegister {
+				log.Printf("[Multiplexer] Peer registered channels: %v",
+					steganography.ParseRegisterPayload(pkt.Data))
+			}
+			return nil, nil
+		}
+		return m.decoder.DecodeFrameFromCustomPayload(&pkt)
+
+	case minecraft.PacketTypeKeepAliveC2S:
+		// Ответ клиента на наш Keep Alive, фрейма не несет
+		return nil, nil
+
+	default:
+		// Неизвестный тип пакета, пропускаем
+		log.Printf("[Multiplexer] Unknown packet type: 0x%02X, skipping", packetID)
+		return nil, nil
+	}
+}
+
+// decodeClientbound извлекает фрейм из пакета сервера
+// Возвращает nil без ошибки для пакетов, которые не несут фреймов
+func (m *Multiplexer) decodeClientbound(packetID minecraft.PacketType, data []byte) (*steganography.Frame, error) {
+	switch packetID {
+	case minecraft.PacketTypeSyncPlayerPosition:
+		var pkt s2c.SyncPlayerPositionPacket
+		if err := m.version.DecodePacket(&pkt, data); err != nil {
+			return nil, fmt.Errorf("decode SyncPlayerPosition packet: %w", err)
+		}
+		return m.decoder.DecodeFrameFromPosition(&pkt)
+
+	case minecraft.PacketTypeCustomPayloadS2C:
+		var pkt s2c.CustomPayloadPacket
+		if err := m.version.DecodePacket(&pkt, data); err != nil {
+			return nil, fmt.Errorf("decode CustomPayload packet: %w", err)
+		}
+		if steganography.IsServiceChannel(pkt.Channel) {
+			return nil, nil
+		}
+		return m.decoder.DecodeFrameFromServerPayload(&pkt)
+
+	case minecraft.PacketTypeKeepAliveS2C:
+		// Настоящий клиент отвечает на каждый Keep Alive тем же ID
+		var pkt s2c.KeepAlivePacket
+		if err := m.version.DecodePacket(&pkt, data); err != nil {
+			return nil, fmt.Errorf("decode KeepAlive packet: %w", err)
+		}
+		if err := m.sendPacket(&c2s.KeepAlivePacket{ID: pkt.ID}); err != nil {
+			return nil, fmt.Errorf("reply keep alive: %w", err)
+		}
+		return nil, nil
+
+	default:
+		log.Printf("[Multiplexer] Unknown packet type: 0x%02X, skipping", packetID)
+		return nil, nil
+	}
+}
+
 // handleFrame обрабатывает входящий фрейм
 func (m *Multiplexer) handleFrame(frame *steganography.Frame) {
 	m.streamsMu.RLock()
@@ -245,6 +467,7 @@ func (m *Multiplexer) handleNewStream(frame *steganography.Frame) {
 }
 
 // sendFrame отправляет фрейм через TCP соединение
+// Если фрейм не помещается в выбранный носитель, он разбивается на фрагменты
 func (m *Multiplexer) sendFrame(frame *steganography.Frame) error {
 	m.closedMu.RLock()
 	if m.closed {
@@ -257,14 +480,38 @@ func (m *Multiplexer) sendFrame(frame *steganography.Frame) error {
 	// Выбираем тип пакета на основе размера данных
 	packetType := m.selector.SelectPacketType(len(frame.Data))
 
+	if !m.selector.ShouldFragmentData(len(frame.Data), packetType) {
+		return m.sendFrameAs(frame, packetType)
+	}
+
+	fragments, err := m.selector.Fragment(frame)
+	if err != nil {
+		log.Printf("[Multiplexer] Error fragmenting frame (StreamID: %d): %v", frame.StreamID, err)
+		return fmt.Errorf("fragment frame: %w", err)
+	}
+
+	for _, fragment := range fragments {
+		if err := m.sendFrameAs(fragment.Frame, fragment.Carrier); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendFrameAs кодирует фрейм в пакет заданного типа и отправляет его
+func (m *Multiplexer) sendFrameAs(frame *steganography.Frame, packetType minecraft.PacketType) error {
 	var packet minecraft.Packet
 	var err error
 
-	// Кодируем фрейм в выбранный тип пакета
-	switch packetType {
-	case minecraft.PacketTypePlayerMove:
-		packet, err = m.encoder.EncodeFrame(frame)
-	case minecraft.PacketTypeCustomPayload:
+	// Кодируем фрейм в выбранный тип пакета. Selector выбирает носитель в терминах
+	// пакетов клиента, сервер отправляет их аналоги: телепорт и свой CustomPayload
+	switch {
+	case m.server && packetType == minecraft.PacketTypeCustomPayload:
+		packet, err = m.encoder.EncodeFrameInServerPayload(frame)
+	case m.server:
+		packet, err = m.encoder.EncodeFrameInPosition(frame)
+	case packetType == minecraft.PacketTypeCustomPayload:
 		packet, err = m.encoder.EncodeFrameInCustomPayload(frame)
 	default:
 		packet, err = m.encoder.EncodeFrame(frame)
@@ -275,21 +522,46 @@ func (m *Multiplexer) sendFrame(frame *steganography.Frame) error {
 		return fmt.Errorf("encode frame: %w", err)
 	}
 
+	// Отправляем пакет
+	if err := m.sendPacket(packet); err != nil {
+		log.Printf("[Multiplexer] Error writing packet (StreamID: %d): %v", frame.StreamID, err)
+		return err
+	}
+
+	return nil
+}
+
+// sendPacket записывает пакет в TCP соединение
+func (m *Multiplexer) sendPacket(packet minecraft.Packet) error {
 	// КРИТИЧНО: Блокируем запись чтобы пакеты не перемешивались!
 	// Без этого при параллельной отправке из разных горутин
 	// пакеты могут перемешаться в TCP stream
 	m.writeMu.Lock()
 	defer m.writeMu.Unlock()
 
-	// Отправляем пакет
-	if err := minecraft.WritePacket(m.conn, packet); err != nil {
-		log.Printf("[Multiplexer] Error writing packet (StreamID: %d): %v", frame.StreamID, err)
+	if err := m.version.WritePacket(m.conn, minecraft.PhasePlay, m.sendDirection(), packet); err != nil {
 		return fmt.Errorf("write packet: %w", err)
 	}
 
 	return nil
 }
 
+// sendDirection направление пакетов, которые отправляет эта сторона
+func (m *Multiplexer) sendDirection() minecraft.Direction {
+	if m.server {
+		return minecraft.Clientbound
+	}
+	return minecraft.Serverbound
+}
+
+// receiveDirection направление пакетов, которые отправляет другая сторона
+func (m *Multiplexer) receiveDirection() minecraft.Direction {
+	if m.server {
+		return minecraft.Serverbound
+	}
+	return minecraft.Clientbound
+}
+
 // closeStream удаляет поток из карты
 func (m *Multiplexer) closeStream(streamID uint16) {
 	m.streamsMu.Lock()
@@ -302,6 +574,8 @@ func (m *Multiplexer) closeStream(streamID uint16) {
 		}
 	}
 	m.streamsMu.Unlock()
+
+	m.reassembler.Reset(streamID)
 }
 
 // Close закрывает мультиплексор и все потоки
@@ -20,6 +20,10 @@ type Stream struct {
 	readBuf  chan []byte
 	writeCh  chan *steganography.Frame
 
+	// Остаток фрейма, не поместившийся в буфер прошлого Read
+	pending []byte
+	readMu  sync.Mutex
+
 	// Канал для ожидания SYN-ACK при открытии потока
 	synAckCh chan struct{}
 
@@ -64,28 +68,38 @@ func newStream(id uint16, mux *Multiplexer) *Stream {
 
 // Read читает данные из потока (реализация io.Reader)
 func (s *Stream) Read(p []byte) (int, error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	// Сначала отдаем остаток прошлого фрейма, иначе данные перепутаются
+	if len(s.pending) > 0 {
+		return s.consume(p, s.pending), nil
+	}
+
 	select {
 	case data := <-s.readBuf:
-		n := copy(p, data)
-		// TODO: если data больше p, нужно буферизовать остаток
-		if n < len(data) {
-			// Возвращаем остаток обратно в буфер
-			remainder := data[n:]
-			select {
-			case s.readBuf <- remainder:
-			default:
-				// Буфер полон, теряем данные (не должно происходить при правильном использовании)
-			}
-		}
-		stats.Global().AddBytesReceived(uint64(n))
-		return n, nil
+		return s.consume(p, data), nil
 	case <-s.closeCh:
-		return 0, io.EOF
+		// Данные, пришедшие до FIN, отдаем до EOF
+		select {
+		case data := <-s.readBuf:
+			return s.consume(p, data), nil
+		default:
+			return 0, io.EOF
+		}
 	case <-s.getReadDeadline():
 		return 0, &timeoutError{}
 	}
 }
 
+// consume копирует data в p и запоминает то, что не поместилось
+func (s *Stream) consume(p, data []byte) int {
+	n := copy(p, data)
+	s.pending = data[n:]
+	stats.Global().AddBytesReceived(uint64(n))
+	return n
+}
+
 // Write записывает данные в поток (реализация io.Writer)
 func (s *Stream) Write(p []byte) (int, error) {
 	s.mu.Lock()
@@ -101,11 +115,14 @@ func (s *Stream) Write(p []byte) (int, error) {
 
 	written := 0
 
-	// Разбиваем данные на chunks по размеру, который может вместить выбранный тип пакета
+	// Разбиваем данные на логические фреймы
+	// Фрейм, который не помещается в пакет-носитель, мультиплексор отправит фрагментами
+	maxFrameData := s.mux.selector.MaxFrameData()
+
 	for written < len(p) {
 		// Определяем размер следующего chunk
 		remaining := len(p) - written
-		chunkSize := s.mux.selector.GetMaxPayload(s.mux.selector.SelectPacketType(remaining))
+		chunkSize := maxFrameData
 
 		if chunkSize > remaining {
 			chunkSize = remaining
@@ -144,7 +161,9 @@ func (s *Stream) Close() error {
 		s.state = StreamStateClosing
 		s.stateMu.Unlock()
 
-		// Отправляем FIN фрейм
+		// Отправляем FIN фрейм под s.mu: иначе он попадет между фрагментами фрейма
+		// идущего Write, и получатель отбросит недособранный фрейм
+		s.mu.Lock()
 		finFrame := &steganography.Frame{
 			StreamID: s.id,
 			Sequence: s.sequence,
@@ -152,7 +171,9 @@ func (s *Stream) Close() error {
 			Length:   0,
 			Data:     nil,
 		}
+		s.sequence++
 		s.mux.sendFrame(finFrame)
+		s.mu.Unlock()
 
 		// Закрываем канал
 		close(s.closeCh)
@@ -258,6 +279,11 @@ func (s *Stream) getReadDeadline() <-chan time.Time {
 	return time.After(time.Until(s.readDeadline))
 }
 
+// Multiplexer возвращает мультиплексор, которому принадлежит поток
+func (s *Stream) Multiplexer() *Multiplexer {
+	return s.mux
+}
+
 // ID возвращает идентификатор потока
 func (s *Stream) ID() uint16 {
 	return s.id
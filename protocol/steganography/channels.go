@@ -0,0 +1,122 @@
+package steganography
+
+import (
+	"bytes"
+	"koria-core/protocol/minecraft"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// Служебные каналы, которые клиент отправляет один раз при входе на сервер
+const (
+	ChannelRegister = "minecraft:register" // Объявление поддерживаемых каналов
+	ChannelBrand    = "minecraft:brand"    // Название клиента (fabric, forge)
+)
+
+// clientBrand brand модлоадера, для которого составлен DefaultChannels
+const clientBrand = "fabric"
+
+// DefaultChannels набор правдоподобных каналов популярных модов для Fabric
+// Используется, если набор каналов не задан в настройках
+var DefaultChannels = []string{
+	"fabric:registry/sync/direct",
+	"fabric-screen-handler-api-v1:open_screen",
+	"fabric-networking-api-v1:early_registration",
+	"voicechat:request_secret",
+	"voicechat:player_state",
+	"voicechat:update_state",
+	"worldedit:cui",
+	"xaerominimap:main",
+	"appleskin:exhaustion_sync",
+}
+
+const (
+	minSessionChannels = 3 // Минимум каналов на сессию
+	maxSessionChannels = 6 // Максимум каналов на сессию
+)
+
+// ChannelRegistry хранит набор plugin-каналов, выбранный для одной сессии
+// Реальный клиент с модами использует небольшое фиксированное множество каналов,
+// поэтому набор выбирается один раз и не меняется до конца соединения
+type ChannelRegistry struct {
+	channels []string
+
+	rand *rand.Rand
+	mu   sync.Mutex
+}
+
+// NewChannelRegistry выбирает каналы для новой сессии из пула
+// Пустой пул заменяется на DefaultChannels
+func NewChannelRegistry(pool []string) *ChannelRegistry {
+	if len(pool) == 0 {
+		pool = DefaultChannels
+	}
+
+	r := &ChannelRegistry{
+		rand: rand.New(rand.NewSource(rand.Int63())),
+	}
+
+	// Выбираем случайное подмножество каналов
+	count := len(pool)
+	if count > minSessionChannels {
+		upper := count
+		if upper > maxSessionChannels {
+			upper = maxSessionChannels
+		}
+		count = minSessionChannels + r.rand.Intn(upper-minSessionChannels+1)
+	}
+
+	shuffled := make([]string, len(pool))
+	copy(shuffled, pool)
+	r.rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	r.channels = shuffled[:count]
+
+	return r
+}
+
+// Channels возвращает каналы сессии
+func (r *ChannelRegistry) Channels() []string {
+	channels := make([]string, len(r.channels))
+	copy(channels, r.channels)
+	return channels
+}
+
+// BrandPayload возвращает данные для minecraft:brand: название клиента строкой протокола
+func (r *ChannelRegistry) BrandPayload() []byte {
+	var buf bytes.Buffer
+	minecraft.WriteString(&buf, clientBrand, 32767)
+	return buf.Bytes()
+}
+
+// Next возвращает канал для следующего CustomPayload пакета
+func (r *ChannelRegistry) Next() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.channels[r.rand.Intn(len(r.channels))]
+}
+
+// RegisterPayload возвращает данные для minecraft:register
+// Формат: идентификаторы каналов, разделенные нулевым байтом
+func (r *ChannelRegistry) RegisterPayload() []byte {
+	return []byte(strings.Join(r.channels, "\x00"))
+}
+
+// ParseRegisterPayload разбирает данные minecraft:register
+func ParseRegisterPayload(data []byte) []string {
+	var channels []string
+	for _, part := range bytes.Split(data, []byte{0}) {
+		if len(part) > 0 {
+			channels = append(channels, string(part))
+		}
+	}
+	return channels
+}
+
+// IsServiceChannel проверяет, является ли канал служебным (не несет фреймы)
+func IsServiceChannel(channel string) bool {
+	return channel == ChannelRegister || channel == ChannelBrand
+}
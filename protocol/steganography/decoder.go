@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	c2s "koria-core/protocol/minecraft/packets/c2s"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
 	"math"
 )
 
@@ -15,8 +16,18 @@ func NewDecoder() *Decoder {
 	return &Decoder{}
 }
 
-// DecodeFrame декодирует фрейм из PlayerMovePacket
+// DecodeFrame декодирует фрейм из PlayerMovePacket (клиент -> сервер)
 func (d *Decoder) DecodeFrame(pkt *c2s.PlayerMovePacket) (*Frame, error) {
+	return d.decodePosition(&position{X: pkt.X, Y: pkt.Y, Z: pkt.Z, Yaw: pkt.Yaw, Pitch: pkt.Pitch}, pkt.Flags)
+}
+
+// DecodeFrameFromPosition декодирует фрейм из SyncPlayerPositionPacket (сервер -> клиент)
+func (d *Decoder) DecodeFrameFromPosition(pkt *s2c.SyncPlayerPositionPacket) (*Frame, error) {
+	return d.decodePosition(&position{X: pkt.X, Y: pkt.Y, Z: pkt.Z, Yaw: pkt.Yaw, Pitch: pkt.Pitch}, pkt.Flags)
+}
+
+// decodePosition извлекает фрейм из младших битов координат
+func (d *Decoder) decodePosition(pkt *position, flags uint8) (*Frame, error) {
 	// Извлекаем данные из координат
 	encodedData := make([]byte, 17)
 
@@ -41,7 +52,7 @@ func (d *Decoder) DecodeFrame(pkt *c2s.PlayerMovePacket) (*Frame, error) {
 	binary.BigEndian.PutUint16(encodedData[14:16], pitchData)
 
 	// Flags -> последний байт
-	encodedData[16] = pkt.Flags
+	encodedData[16] = flags
 
 	// Парсим заголовок фрейма
 	if len(encodedData) < HeaderSize {
@@ -90,29 +101,39 @@ func (d *Decoder) decodeDataFromFloat(value float32) uint16 {
 	return uint16(bits & 0x0000FFFF)
 }
 
-// DecodeFrameFromCustomPayload декодирует фрейм из CustomPayloadPacket
+// DecodeFrameFromCustomPayload декодирует фрейм из CustomPayloadPacket (клиент -> сервер)
 func (d *Decoder) DecodeFrameFromCustomPayload(pkt *c2s.CustomPayloadPacket) (*Frame, error) {
-	if len(pkt.Data) < HeaderSize {
+	return decodePayload(pkt.Data)
+}
+
+// DecodeFrameFromServerPayload декодирует фрейм из CustomPayloadPacket сервера (сервер -> клиент)
+func (d *Decoder) DecodeFrameFromServerPayload(pkt *s2c.CustomPayloadPacket) (*Frame, error) {
+	return decodePayload(pkt.Data)
+}
+
+// decodePayload разбирает заголовок и данные фрейма, записанные подряд
+func decodePayload(payload []byte) (*Frame, error) {
+	if len(payload) < HeaderSize {
 		return nil, fmt.Errorf("payload too small for frame header")
 	}
 
 	frame := &Frame{
-		StreamID: binary.BigEndian.Uint16(pkt.Data[0:2]),
-		Sequence: binary.BigEndian.Uint16(pkt.Data[2:4]),
-		Flags:    pkt.Data[4],
+		StreamID: binary.BigEndian.Uint16(payload[0:2]),
+		Sequence: binary.BigEndian.Uint16(payload[2:4]),
+		Flags:    payload[4],
 	}
 
-	dataLen := binary.BigEndian.Uint16(pkt.Data[5:7])
+	dataLen := binary.BigEndian.Uint16(payload[5:7])
 	frame.Length = dataLen
 
 	if dataLen > 0 {
-		if HeaderSize+int(dataLen) > len(pkt.Data) {
+		if HeaderSize+int(dataLen) > len(payload) {
 			return nil, fmt.Errorf("frame data length exceeds payload: %d > %d",
-				HeaderSize+int(dataLen), len(pkt.Data))
+				HeaderSize+int(dataLen), len(payload))
 		}
 
 		frame.Data = make([]byte, dataLen)
-		copy(frame.Data, pkt.Data[HeaderSize:HeaderSize+int(dataLen)])
+		copy(frame.Data, payload[HeaderSize:HeaderSize+int(dataLen)])
 	}
 
 	return frame, nil
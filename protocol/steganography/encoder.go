@@ -4,25 +4,75 @@ import (
 	"encoding/binary"
 	"fmt"
 	c2s "koria-core/protocol/minecraft/packets/c2s"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
 	"math"
 	"math/rand"
 )
 
 // Encoder кодирует фреймы в Minecraft пакеты
 type Encoder struct {
-	rand *rand.Rand
+	rand     *rand.Rand
+	channels *ChannelRegistry
 }
 
 // NewEncoder создает новый энкодер
-func NewEncoder() *Encoder {
+// channels определяет каналы для CustomPayload (nil = случайный набор из DefaultChannels)
+func NewEncoder(channels *ChannelRegistry) *Encoder {
+	if channels == nil {
+		channels = NewChannelRegistry(nil)
+	}
+
 	return &Encoder{
-		rand: rand.New(rand.NewSource(rand.Int63())),
+		rand:     rand.New(rand.NewSource(rand.Int63())),
+		channels: channels,
 	}
 }
 
-// EncodeFrame кодирует фрейм в PlayerMovePacket
+// position координаты и поворот игрока - общая часть пакетов движения обоих направлений
+type position struct {
+	X, Y, Z    float64
+	Yaw, Pitch float32
+}
+
+// EncodeFrame кодирует фрейм в PlayerMovePacket (клиент -> сервер)
 // Использует стеганографию - прячет данные в младших битах координат
 func (e *Encoder) EncodeFrame(frame *Frame) (*c2s.PlayerMovePacket, error) {
+	pos, err := e.encodePosition(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c2s.PlayerMovePacket{
+		X:     pos.X,
+		Y:     pos.Y,
+		Z:     pos.Z,
+		Yaw:   pos.Yaw,
+		Pitch: pos.Pitch,
+		Flags: uint8(e.rand.Intn(4)), // Случайные MC флаги (onGround и т.п.)
+	}, nil
+}
+
+// EncodeFrameInPosition кодирует фрейм в SyncPlayerPositionPacket (сервер -> клиент)
+// Данные прячутся в координатах так же, как в PlayerMovePacket
+func (e *Encoder) EncodeFrameInPosition(frame *Frame) (*s2c.SyncPlayerPositionPacket, error) {
+	pos, err := e.encodePosition(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s2c.SyncPlayerPositionPacket{
+		X:          pos.X,
+		Y:          pos.Y,
+		Z:          pos.Z,
+		Yaw:        pos.Yaw,
+		Pitch:      pos.Pitch,
+		Flags:      0, // Абсолютные координаты
+		TeleportID: e.rand.Int31n(1 << 16),
+	}, nil
+}
+
+// encodePosition прячет заголовок и данные фрейма в младших битах координат
+func (e *Encoder) encodePosition(frame *Frame) (*position, error) {
 	if len(frame.Data) > MaxDataPerPlayerMove {
 		return nil, fmt.Errorf("frame data too large: %d > %d", len(frame.Data), MaxDataPerPlayerMove)
 	}
@@ -48,8 +98,7 @@ func (e *Encoder) EncodeFrame(frame *Frame) (*c2s.PlayerMovePacket, error) {
 	// Данные (остальное заполнено нулями автоматически при make)
 	copy(encodedData[7:], frame.Data)
 
-	// Создаем пакет
-	pkt := &c2s.PlayerMovePacket{}
+	pkt := &position{}
 
 	// Кодируем данные в координаты (используем младшие 32 бита мантиссы double)
 	// X: первые 4 байта
@@ -103,13 +152,6 @@ func (e *Encoder) EncodeFrame(frame *Frame) (*c2s.PlayerMovePacket, error) {
 		pkt.Pitch = basePitch
 	}
 
-	// Flags: последний байт (младшие 2 бита для Minecraft, остальное - наши данные)
-	if len(encodedData) >= 17 {
-		pkt.Flags = encodedData[16] & 0x03 // Только младшие 2 бита для MC флагов
-	} else {
-		pkt.Flags = uint8(e.rand.Intn(4)) // Случайные MC флаги
-	}
-
 	return pkt, nil
 }
 
@@ -178,10 +220,25 @@ func (e *Encoder) generateRealisticY() float64 {
 	return 60.0 + e.rand.Float64()*20.0 + e.rand.Float64()*5.0
 }
 
-// EncodeFrameInCustomPayload кодирует фрейм в CustomPayloadPacket
+// EncodeFrameInCustomPayload кодирует фрейм в CustomPayloadPacket (клиент -> сервер)
 // Для больших блоков данных - просто записываем напрямую
 func (e *Encoder) EncodeFrameInCustomPayload(frame *Frame) (*c2s.CustomPayloadPacket, error) {
-	// Подготавливаем данные (заголовок + данные)
+	return &c2s.CustomPayloadPacket{
+		Channel: e.channels.Next(), // Один из зарегистрированных каналов сессии
+		Data:    encodePayload(frame),
+	}, nil
+}
+
+// EncodeFrameInServerPayload кодирует фрейм в CustomPayloadPacket сервера (сервер -> клиент)
+func (e *Encoder) EncodeFrameInServerPayload(frame *Frame) (*s2c.CustomPayloadPacket, error) {
+	return &s2c.CustomPayloadPacket{
+		Channel: e.channels.Next(),
+		Data:    encodePayload(frame),
+	}, nil
+}
+
+// encodePayload записывает заголовок и данные фрейма подряд
+func encodePayload(frame *Frame) []byte {
 	payload := make([]byte, HeaderSize+len(frame.Data))
 
 	binary.BigEndian.PutUint16(payload[0:2], frame.StreamID)
@@ -190,8 +247,5 @@ func (e *Encoder) EncodeFrameInCustomPayload(frame *Frame) (*c2s.CustomPayloadPa
 	binary.BigEndian.PutUint16(payload[5:7], uint16(len(frame.Data)))
 	copy(payload[7:], frame.Data)
 
-	return &c2s.CustomPayloadPacket{
-		Channel: "minecraft:brand", // Легитимный канал
-		Data:    payload,
-	}, nil
+	return payload
 }
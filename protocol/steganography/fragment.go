@@ -0,0 +1,149 @@
+package steganography
+
+import (
+	"fmt"
+	"koria-core/protocol/minecraft"
+	"sync"
+)
+
+const (
+	// FragmentHeaderSize размер заголовка фрагмента в начале Data (индекс фрагмента)
+	FragmentHeaderSize = 1
+	// MaxFragments максимум фрагментов одного фрейма (индекс занимает один байт)
+	MaxFragments = 256
+)
+
+// Fragment фрагмент фрейма вместе с выбранным для него пакетом-носителем
+type Fragment struct {
+	Frame   *Frame
+	Carrier minecraft.PacketType
+}
+
+// Fragment разбивает фрейм на фрагменты, выбирая носитель для каждого фрагмента отдельно
+// Фрагменты наследуют StreamID, Sequence и флаги исходного фрейма, получают FlagFragment,
+// последний фрагмент помечается FlagLastFragment. Первый байт Data - индекс фрагмента
+func (ps *PacketSelector) Fragment(frame *Frame) ([]Fragment, error) {
+	minFragments := ps.CalculateFragments(len(frame.Data), minecraft.PacketTypeCustomPayload)
+	if minFragments > MaxFragments {
+		return nil, fmt.Errorf("frame too large to fragment: %d bytes", len(frame.Data))
+	}
+
+	fragments := make([]Fragment, 0, minFragments)
+	offset := 0
+
+	for offset < len(frame.Data) {
+		if len(fragments) == MaxFragments {
+			return nil, fmt.Errorf("frame needs more than %d fragments", MaxFragments)
+		}
+
+		remaining := len(frame.Data) - offset
+		carrier := ps.SelectPacketType(remaining + FragmentHeaderSize)
+		size := ps.fragmentSize(remaining, carrier)
+
+		data := make([]byte, FragmentHeaderSize+size)
+		data[0] = byte(len(fragments))
+		copy(data[FragmentHeaderSize:], frame.Data[offset:offset+size])
+		offset += size
+
+		flags := frame.Flags | FlagFragment
+		if offset == len(frame.Data) {
+			flags |= FlagLastFragment
+		}
+
+		fragments = append(fragments, Fragment{
+			Frame: &Frame{
+				StreamID: frame.StreamID,
+				Sequence: frame.Sequence,
+				Flags:    flags,
+				Length:   uint16(len(data)),
+				Data:     data,
+			},
+			Carrier: carrier,
+		})
+	}
+
+	return fragments, nil
+}
+
+// partialFrame собираемый фрейм
+type partialFrame struct {
+	sequence uint16
+	flags    uint8
+	next     int
+	data     []byte
+}
+
+// Reassembler собирает фрагментированные фреймы обратно
+// Фрагменты одного фрейма приходят по порядку (TCP сохраняет порядок, а поток
+// не отправляет следующий фрейм, пока не отправит все фрагменты предыдущего)
+type Reassembler struct {
+	pending map[uint16]*partialFrame
+	mu      sync.Mutex
+}
+
+// NewReassembler создает новый сборщик фрагментов
+func NewReassembler() *Reassembler {
+	return &Reassembler{
+		pending: make(map[uint16]*partialFrame),
+	}
+}
+
+// Add добавляет фрейм и возвращает собранный фрейм, когда он готов
+// Нефрагментированные фреймы возвращаются без изменений; nil означает, что фрейм еще не собран
+func (r *Reassembler) Add(frame *Frame) (*Frame, error) {
+	if !frame.HasFlag(FlagFragment) {
+		return frame, nil
+	}
+
+	if len(frame.Data) < FragmentHeaderSize {
+		return nil, fmt.Errorf("fragment without header (StreamID: %d)", frame.StreamID)
+	}
+
+	index := int(frame.Data[0])
+	payload := frame.Data[FragmentHeaderSize:]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	partial, exists := r.pending[frame.StreamID]
+
+	if index == 0 {
+		if exists {
+			// Предыдущий фрейм не был собран до конца - отбрасываем его
+			delete(r.pending, frame.StreamID)
+		}
+		partial = &partialFrame{
+			sequence: frame.Sequence,
+			flags:    frame.Flags &^ (FlagFragment | FlagLastFragment),
+		}
+		r.pending[frame.StreamID] = partial
+	} else if !exists || partial.sequence != frame.Sequence || partial.next != index {
+		delete(r.pending, frame.StreamID)
+		return nil, fmt.Errorf("out of order fragment %d (StreamID: %d, Seq: %d)",
+			index, frame.StreamID, frame.Sequence)
+	}
+
+	partial.data = append(partial.data, payload...)
+	partial.next++
+
+	if !frame.HasFlag(FlagLastFragment) {
+		return nil, nil
+	}
+
+	delete(r.pending, frame.StreamID)
+
+	return &Frame{
+		StreamID: frame.StreamID,
+		Sequence: partial.sequence,
+		Flags:    partial.flags,
+		Length:   uint16(len(partial.data)),
+		Data:     partial.data,
+	}, nil
+}
+
+// Reset отбрасывает несобранный фрейм потока (при закрытии потока)
+func (r *Reassembler) Reset(streamID uint16) {
+	r.mu.Lock()
+	delete(r.pending, streamID)
+	r.mu.Unlock()
+}
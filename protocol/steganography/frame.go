@@ -16,6 +16,9 @@ const (
 	FlagFIN uint8 = 1 << 2 // 0x04 - закрытие потока
 	FlagRST uint8 = 1 << 3 // 0x08 - сброс потока
 	FlagPSH uint8 = 1 << 4 // 0x10 - push data immediately
+
+	FlagFragment     uint8 = 1 << 5 // 0x20 - фрейм является фрагментом (индекс в первом байте Data)
+	FlagLastFragment uint8 = 1 << 6 // 0x40 - последний фрагмент фрейма
 )
 
 // HeaderSize размер заголовка фрейма
@@ -1,15 +1,59 @@
 package steganography
 
 import (
+	"fmt"
 	"koria-core/protocol/minecraft"
+	"math/rand"
+	"sync"
 )
 
+// SelectorMode определяет стратегию выбора пакетов-носителей
+type SelectorMode string
+
+const (
+	// ModeAdaptive выбирает носитель по размеру данных (по умолчанию)
+	ModeAdaptive SelectorMode = "adaptive"
+	// ModeTiny использует только маленькие пакеты движения, фреймы фрагментируются
+	ModeTiny SelectorMode = "tiny"
+	// ModeMixed чередует типы носителей, фрейм разбивается на фрагменты разного типа
+	ModeMixed SelectorMode = "mixed"
+)
+
+// ParseSelectorMode разбирает режим из настроек (пустая строка = ModeAdaptive)
+func ParseSelectorMode(s string) (SelectorMode, error) {
+	switch SelectorMode(s) {
+	case "", ModeAdaptive:
+		return ModeAdaptive, nil
+	case ModeTiny, ModeMixed:
+		return SelectorMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown carrier mode: %s", s)
+	}
+}
+
 // PacketSelector выбирает оптимальный тип пакета для передачи данных
-type PacketSelector struct{}
+type PacketSelector struct {
+	mode SelectorMode
+
+	rand *rand.Rand
+	mu   sync.Mutex
+}
 
 // NewPacketSelector создает новый selector
-func NewPacketSelector() *PacketSelector {
-	return &PacketSelector{}
+func NewPacketSelector(mode SelectorMode) *PacketSelector {
+	if mode == "" {
+		mode = ModeAdaptive
+	}
+
+	return &PacketSelector{
+		mode: mode,
+		rand: rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// Mode возвращает режим выбора носителей
+func (ps *PacketSelector) Mode() SelectorMode {
+	return ps.mode
 }
 
 // SelectPacketType выбирает тип пакета на основе размера данных
@@ -17,13 +61,21 @@ func (ps *PacketSelector) SelectPacketType(dataSize int) minecraft.PacketType {
 	// ВАЖНО: На данный момент реализованы только PlayerMove и CustomPayload
 	// ChatMessage, PlayerAction, HandSwing пока не реализованы
 	switch {
-	case dataSize > MaxDataPerPlayerMove:
-		// Данные больше 9 байт - используем CustomPayload (до 32KB)
-		return minecraft.PacketTypeCustomPayload
+	case ps.mode == ModeTiny:
+		// Только маленькие пакеты, большие данные уходят фрагментами
+		return minecraft.PacketTypePlayerMove
 
-	default:
+	case dataSize <= MaxDataPerPlayerMove:
 		// Данные <= 9 байт - используем PlayerMove
 		return minecraft.PacketTypePlayerMove
+
+	case ps.mode == ModeMixed && ps.chance(0.6):
+		// Часть больших данных тоже отправляем пакетами движения
+		return minecraft.PacketTypePlayerMove
+
+	default:
+		// Данные больше 9 байт - используем CustomPayload (до 32KB)
+		return minecraft.PacketTypeCustomPayload
 	}
 }
 
@@ -41,6 +93,15 @@ func (ps *PacketSelector) GetMaxPayload(packetType minecraft.PacketType) int {
 	}
 }
 
+// MaxFrameData возвращает максимальный размер данных одного логического фрейма
+// В режимах с фрагментацией фрейм должен уместиться в MaxFragments пакетов движения
+func (ps *PacketSelector) MaxFrameData() int {
+	if ps.mode == ModeAdaptive {
+		return ps.GetMaxPayload(minecraft.PacketTypeCustomPayload)
+	}
+	return MaxFragments * (MaxDataPerPlayerMove - FragmentHeaderSize)
+}
+
 // ShouldFragmentData проверяет, нужно ли фрагментировать данные
 func (ps *PacketSelector) ShouldFragmentData(dataSize int, packetType minecraft.PacketType) bool {
 	maxPayload := ps.GetMaxPayload(packetType)
@@ -48,11 +109,36 @@ func (ps *PacketSelector) ShouldFragmentData(dataSize int, packetType minecraft.
 }
 
 // CalculateFragments вычисляет количество фрагментов для данных
+// Учитывает заголовок фрагмента, который занимает часть полезной нагрузки
 func (ps *PacketSelector) CalculateFragments(dataSize int, packetType minecraft.PacketType) int {
-	maxPayload := ps.GetMaxPayload(packetType)
+	maxPayload := ps.GetMaxPayload(packetType) - FragmentHeaderSize
 	fragments := dataSize / maxPayload
 	if dataSize%maxPayload != 0 {
 		fragments++
 	}
 	return fragments
 }
+
+// fragmentSize выбирает размер данных следующего фрагмента для носителя
+func (ps *PacketSelector) fragmentSize(remaining int, packetType minecraft.PacketType) int {
+	size := ps.GetMaxPayload(packetType) - FragmentHeaderSize
+
+	// В смешанном режиме размеры CustomPayload фрагментов тоже варьируются
+	if ps.mode == ModeMixed && packetType == minecraft.PacketTypeCustomPayload && size > MaxDataPerPlayerMove {
+		ps.mu.Lock()
+		size = MaxDataPerPlayerMove + ps.rand.Intn(size-MaxDataPerPlayerMove+1)
+		ps.mu.Unlock()
+	}
+
+	if size > remaining {
+		size = remaining
+	}
+	return size
+}
+
+// chance возвращает true с вероятностью p
+func (ps *PacketSelector) chance(p float64) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.rand.Float64() < p
+}
@@ -0,0 +1,46 @@
+package blackhole
+
+import (
+	"context"
+	"fmt"
+	commnet "koria-core/common/net"
+	"log"
+	"net"
+)
+
+// Handler представляет Blackhole outbound: отклоняет все соединения
+// Правило routing с его тегом запрещает назначение, клиент SOCKS5 получает ответ 0x02
+type Handler struct {
+	tag string
+}
+
+// NewHandler создает новый Blackhole handler
+func NewHandler(tag string) *Handler {
+	return &Handler{
+		tag: tag,
+	}
+}
+
+// Tag возвращает тег обработчика
+func (h *Handler) Tag() string {
+	return h.tag
+}
+
+// Dial отклоняет соединение к назначению
+func (h *Handler) Dial(ctx context.Context, dest commnet.Destination) (net.Conn, error) {
+	log.Printf("[Blackhole Outbound:%s] Blocked %s", h.tag, dest.String())
+	return nil, blocked(dest)
+}
+
+// Bind отклоняет прием соединения от назначения (SOCKS BIND)
+func (h *Handler) Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error) {
+	log.Printf("[Blackhole Outbound:%s] Blocked BIND for %s", h.tag, dest.String())
+	return nil, blocked(dest)
+}
+
+func blocked(dest commnet.Destination) error {
+	return &commnet.ClassError{
+		Class: commnet.ErrorNotAllowed,
+		Err:   fmt.Errorf("%s blocked by routing", dest.String()),
+	}
+}
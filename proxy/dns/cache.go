@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize записей в кэше по умолчанию
+const defaultCacheSize = 1024
+
+// cacheEntry ответ upstream и положение TTL его записей
+type cacheEntry struct {
+	msg        []byte
+	ttlOffsets []int
+	stored     time.Time
+	expires    time.Time
+}
+
+// cache ответы по вопросу (имя, тип, класс) и флагу DO на время наименьшего TTL записей
+// ответа. OPT в кэш не попадает: ответ из кэша получает OPT, построенную по запросу клиента
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*cacheEntry
+}
+
+// newCache создает кэш на size записей
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		entries: make(map[string]*cacheEntry, size),
+	}
+}
+
+// cacheKey ключ кэша для вопроса. С флагом DO upstream добавляет DNSSEC записи,
+// поэтому такие ответы хранятся отдельно
+func cacheKey(q question) string {
+	return fmt.Sprintf("%s/%d/%d/%t", q.name, q.qtype, q.qclass, q.do)
+}
+
+// get возвращает ответ из кэша для запроса: с ID и вопросом запроса, уменьшенными TTL
+// и OPT, если она была в запросе
+func (c *cache) get(query []byte, q question) []byte {
+	key := cacheKey(q)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry := c.entries[key]
+	if entry != nil && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		entry = nil
+	}
+	c.mu.Unlock()
+	if entry == nil {
+		return nil
+	}
+
+	resp := append([]byte(nil), entry.msg...)
+	copy(resp[:2], query[:2])
+
+	// Регистр имени в вопросе повторяет запрос: клиенты проверяют его (DNS 0x20)
+	if q.end <= len(resp) && bytes.EqualFold(resp[headerSize:q.end], query[headerSize:q.end]) {
+		copy(resp[headerSize:q.end], query[headerSize:q.end])
+	}
+
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, off := range entry.ttlOffsets {
+		ttl := binary.BigEndian.Uint32(resp[off:])
+		if ttl > elapsed {
+			ttl -= elapsed
+		} else {
+			ttl = 0
+		}
+		binary.BigEndian.PutUint32(resp[off:], ttl)
+	}
+
+	if q.edns {
+		resp = appendOPT(resp, q)
+	}
+	return resp
+}
+
+// put сохраняет ответ, если его можно кэшировать: успешный или NXDOMAIN, не обрезанный
+// и с записями, из TTL которых понятно время жизни
+func (c *cache) put(q question, resp []byte) {
+	if code := rcode(resp); code != rcodeSuccess && code != rcodeNXDomain {
+		return
+	}
+	if binary.BigEndian.Uint16(resp[2:])&flagTC != 0 {
+		return
+	}
+	msg, ok := stripOPT(resp)
+	if !ok {
+		return
+	}
+	respQ, err := parseQuestion(msg)
+	if err != nil {
+		return
+	}
+
+	var offsets []int
+	minTTL := uint32(0)
+	err = walkRecords(msg, respQ.end, func(rtype, rclass uint16, ttlOffset int) {
+		ttl := binary.BigEndian.Uint32(msg[ttlOffset:])
+		if len(offsets) == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+		offsets = append(offsets, ttlOffset)
+	})
+	if err != nil || len(offsets) == 0 || minTTL == 0 {
+		return
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		msg:        msg,
+		ttlOffsets: offsets,
+		stored:     now,
+		expires:    now.Add(time.Duration(minTTL) * time.Second),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[cacheKey(q)] = entry
+}
+
+// evict освобождает место: удаляет устаревшие записи, а если таких нет - любую
+func (c *cache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			return
+		}
+		delete(c.entries, key)
+	}
+}
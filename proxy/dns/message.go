@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Минимальный разбор DNS сообщений (RFC 1035): только то, что нужно прокси -
+// вопрос, размер UDP ответа из EDNS и положение TTL записей ответа для кэша
+
+const (
+	headerSize = 12
+
+	// udpMinSize размер UDP ответа без EDNS (RFC 1035, 4.2.1)
+	udpMinSize = 512
+
+	typeOPT = 41
+
+	// ednsSize размер UDP ответа, который сервер объявляет в OPT своих ответов
+	ednsSize = 1232
+
+	// ednsDO флаг DNSSEC OK в поле TTL записи OPT (RFC 3225)
+	ednsDO = 0x8000
+
+	flagQR = 0x8000
+	flagTC = 0x0200
+	flagRD = 0x0100
+	flagRA = 0x0080
+
+	rcodeSuccess  = 0
+	rcodeFormErr  = 1
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+)
+
+var errMalformed = errors.New("malformed dns message")
+
+// question вопрос запроса
+type question struct {
+	name   string // в нижнем регистре, без завершающей точки
+	qtype  uint16
+	qclass uint16
+	end    int // смещение конца вопроса в сообщении
+
+	edns bool // в запросе есть OPT
+	do   bool // клиент запросил DNSSEC записи
+}
+
+// parseQuery разбирает запрос: единственный вопрос, флаги и размер UDP ответа из OPT записи
+func parseQuery(msg []byte) (question, int, error) {
+	if len(msg) < headerSize {
+		return question{}, 0, errMalformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&flagQR != 0 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		return question{}, 0, errMalformed
+	}
+
+	q, err := parseQuestion(msg)
+	if err != nil {
+		return question{}, 0, err
+	}
+
+	udpSize := udpMinSize
+	err = walkRecords(msg, q.end, func(rtype, rclass uint16, ttlOffset int) {
+		if rtype != typeOPT {
+			return
+		}
+		q.edns = true
+		q.do = binary.BigEndian.Uint16(msg[ttlOffset+2:])&ednsDO != 0
+		if int(rclass) > udpSize {
+			udpSize = int(rclass)
+		}
+	})
+	if err != nil {
+		return question{}, 0, err
+	}
+	return q, udpSize, nil
+}
+
+// parseQuestion разбирает первый вопрос сообщения
+func parseQuestion(msg []byte) (question, error) {
+	name, off, err := readName(msg, headerSize)
+	if err != nil {
+		return question{}, err
+	}
+	if off+4 > len(msg) {
+		return question{}, errMalformed
+	}
+	return question{
+		name:   name,
+		qtype:  binary.BigEndian.Uint16(msg[off:]),
+		qclass: binary.BigEndian.Uint16(msg[off+2:]),
+		end:    off + 4,
+	}, nil
+}
+
+// walkRecords обходит записи секций answer, authority и additional, начиная с off
+func walkRecords(msg []byte, off int, fn func(rtype, rclass uint16, ttlOffset int)) error {
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	for i := 0; i < count; i++ {
+		next, err := skipName(msg, off)
+		if err != nil {
+			return err
+		}
+		if next+10 > len(msg) {
+			return errMalformed
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		rclass := binary.BigEndian.Uint16(msg[next+2:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		fn(rtype, rclass, next+4)
+
+		off = next + 10 + length
+		if off > len(msg) {
+			return errMalformed
+		}
+	}
+	return nil
+}
+
+// stripOPT возвращает копию сообщения без записи OPT. ok = false, если OPT несет
+// расширенный код ответа или за ней идут другие записи: их сжатые имена могут
+// ссылаться на смещения за ней
+func stripOPT(msg []byte) ([]byte, bool) {
+	q, err := parseQuestion(msg)
+	if err != nil {
+		return nil, false
+	}
+
+	off := q.end
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	for i := 0; i < count; i++ {
+		start := off
+		next, err := skipName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return nil, false
+		}
+		off = next + 10 + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if off > len(msg) {
+			return nil, false
+		}
+		if binary.BigEndian.Uint16(msg[next:]) != typeOPT {
+			continue
+		}
+		if i != count-1 || msg[next+4] != 0 {
+			return nil, false
+		}
+
+		stripped := append([]byte(nil), msg[:start]...)
+		binary.BigEndian.PutUint16(stripped[10:], binary.BigEndian.Uint16(msg[10:])-1)
+		return stripped, true
+	}
+	return append([]byte(nil), msg...), true
+}
+
+// appendOPT добавляет к ответу без OPT запись OPT (RFC 6891) для запроса q:
+// размер UDP ответа сервера и флаг DO из запроса
+func appendOPT(msg []byte, q question) []byte {
+	var flags uint16
+	if q.do {
+		flags = ednsDO
+	}
+	msg = append(msg, 0) // Корневое имя
+	msg = binary.BigEndian.AppendUint16(msg, typeOPT)
+	msg = binary.BigEndian.AppendUint16(msg, ednsSize)
+	msg = append(msg, 0, 0) // Расширенный код ответа и версия EDNS
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = binary.BigEndian.AppendUint16(msg, 0) // Без опций
+	binary.BigEndian.PutUint16(msg[10:], binary.BigEndian.Uint16(msg[10:])+1)
+	return msg
+}
+
+// readName читает имя с учетом сжатия и возвращает смещение сразу за ним
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), end, nil
+		case length&0xC0 == 0xC0:
+			if off+2 > len(msg) || jumps > 64 {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		case length&0xC0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// skipName возвращает смещение за именем, не разбирая его
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			return off + 1, nil
+		case length&0xC0 == 0xC0:
+			if off+2 > len(msg) {
+				return 0, errMalformed
+			}
+			return off + 2, nil
+		case length&0xC0 != 0:
+			return 0, errMalformed
+		default:
+			off += 1 + length
+		}
+	}
+}
+
+// rcode возвращает код ответа
+func rcode(msg []byte) int {
+	return int(binary.BigEndian.Uint16(msg[2:]) & 0x000F)
+}
+
+// errorResponse строит ответ с кодом ошибки на запрос: заголовок и вопрос без записей
+func errorResponse(query []byte, q question, code int) []byte {
+	resp := make([]byte, q.end)
+	copy(resp, query[:q.end])
+	flags := binary.BigEndian.Uint16(query[2:])&flagRD | flagQR | flagRA | uint16(code)
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], 0)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	return resp
+}
+
+// formatError строит FORMERR на запрос, вопрос которого не разобрать
+func formatError(query []byte) []byte {
+	resp := make([]byte, headerSize)
+	copy(resp, query[:2])
+	binary.BigEndian.PutUint16(resp[2:], flagQR|flagRA|rcodeFormErr)
+	return resp
+}
+
+// truncate обрезает ответ до заголовка и вопроса с флагом TC: клиент повторит запрос по TCP
+func truncate(resp []byte) []byte {
+	end, qdcount := headerSize, uint16(0)
+	if q, err := parseQuestion(resp); err == nil {
+		end, qdcount = q.end, 1
+	}
+
+	short := make([]byte, end)
+	copy(short, resp[:end])
+	binary.BigEndian.PutUint16(short[2:], binary.BigEndian.Uint16(resp[2:])|flagTC)
+	binary.BigEndian.PutUint16(short[4:], qdcount)
+	binary.BigEndian.PutUint16(short[6:], 0)
+	binary.BigEndian.PutUint16(short[8:], 0)
+	binary.BigEndian.PutUint16(short[10:], 0)
+	return short
+}
@@ -0,0 +1,385 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"koria-core/app/dispatcher"
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// queryTimeout сколько ждать ответ upstream
+	queryTimeout = 5 * time.Second
+
+	// tcpIdleTimeout TCP соединение клиента закрывается после такого простоя
+	tcpIdleTimeout = 2 * time.Minute
+
+	// maxConcurrentQueries запросов в обработке одновременно. Лишние UDP запросы
+	// отбрасываются, TCP соединения ждут очереди
+	maxConcurrentQueries = 256
+)
+
+// Server DNS сервер: отвечает из кэша, а остальные запросы отправляет upstream по
+// DNS-over-TCP через outbound, так что запросы клиентов не уходят мимо туннеля
+type Server struct {
+	tag        string
+	listen     string
+	upstreams  []*upstream
+	fallback   *upstream // upstream без доменов, для всех остальных запросов
+	cache      *cache    // nil - кэш отключен
+	listener   net.Listener
+	packetConn *net.UDPConn
+	dispatcher dispatcher.Interface
+	queries    chan struct{} // семафор запросов в обработке
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// Upstream DNS сервер, которому пересылаются запросы
+type Upstream struct {
+	Address string // Адрес DNS сервера: IP или домен
+	Port    uint16 // Порт DNS сервера (0 = 53)
+
+	// Domains шаблоны доменов в синтаксисе правил routing. Запрос уходит первому upstream,
+	// шаблон которого совпал; upstream без шаблонов получает все остальные
+	Domains []string
+
+	// OutboundTag outbound для запросов к этому upstream. Пусто - выбирает routing
+	OutboundTag string
+}
+
+// Config конфигурация DNS сервера
+type Config struct {
+	Listen    string // Адрес для прослушивания UDP и TCP (например, "127.0.0.1:53")
+	Upstreams []Upstream
+
+	CacheSize    int  // Записей в кэше (0 = 1024)
+	DisableCache bool // Всегда спрашивать upstream
+}
+
+// upstream разобранный Upstream
+type upstream struct {
+	dest        commnet.Destination
+	domains     *dispatcher.DomainMatcher
+	outboundTag string
+
+	mu   sync.Mutex
+	conn *upstreamConn // общее соединение для всех запросов, nil - еще не открыто
+}
+
+// NewServer создает новый DNS сервер
+func NewServer(tag string, cfg *Config, d dispatcher.Interface) (*Server, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		tag:        tag,
+		listen:     cfg.Listen,
+		dispatcher: d,
+		queries:    make(chan struct{}, maxConcurrentQueries),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	for _, u := range cfg.Upstreams {
+		port := u.Port
+		if port == 0 {
+			port = 53
+		}
+		parsed := &upstream{
+			dest:        commnet.TCPDestination(u.Address, port),
+			outboundTag: u.OutboundTag,
+		}
+		if len(u.Domains) > 0 {
+			domains, err := dispatcher.NewDomainMatcher(u.Domains)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			parsed.domains = domains
+		} else if s.fallback == nil {
+			s.fallback = parsed
+		}
+		s.upstreams = append(s.upstreams, parsed)
+	}
+	if s.fallback == nil {
+		cancel()
+		return nil, fmt.Errorf("no upstream without domains")
+	}
+
+	if !cfg.DisableCache {
+		size := cfg.CacheSize
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		s.cache = newCache(size)
+	}
+
+	return s, nil
+}
+
+// Tag возвращает тег сервера
+func (s *Server) Tag() string {
+	return s.tag
+}
+
+// Start запускает сервер
+func (s *Server) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", s.listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", s.listen, err)
+	}
+	packetConn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", s.listen, err)
+	}
+
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		packetConn.Close()
+		return fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+	}
+
+	s.packetConn = packetConn
+	s.listener = listener
+
+	log.Printf("[DNS Inbound:%s] Listening on %s (udp, tcp)", s.tag, s.listen)
+
+	go s.readPackets()
+	go s.acceptLoop()
+	return nil
+}
+
+// Close закрывает сервер
+func (s *Server) Close() error {
+	s.cancel()
+	for _, u := range s.upstreams {
+		u.mu.Lock()
+		if u.conn != nil {
+			u.conn.close(errUpstreamClosed)
+		}
+		u.mu.Unlock()
+	}
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// GetRandomInboundProxy возвращает адрес прокси (не используется для DNS)
+func (s *Server) GetRandomInboundProxy() (*net.TCPAddr, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// readPackets принимает запросы по UDP
+func (s *Server) readPackets() {
+	buf := make([]byte, commnet.MaxPacketSize)
+	for {
+		n, client, err := s.packetConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		select {
+		case s.queries <- struct{}{}:
+		default:
+			// Сервер перегружен, как и в UDP запрос теряется, клиент повторит
+			continue
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-s.queries }()
+			resp, udpSize := s.handleQuery(query)
+			if resp == nil {
+				return
+			}
+			if len(resp) > udpSize {
+				resp = truncate(resp)
+			}
+			s.packetConn.WriteToUDP(resp, client)
+		}()
+	}
+}
+
+// acceptLoop принимает TCP соединения
+func (s *Server) acceptLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+				log.Printf("[DNS Inbound:%s] Accept error: %v", s.tag, err)
+				continue
+			}
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection отвечает на запросы TCP соединения, в том числе идущие подряд без ожидания
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		select {
+		case s.queries <- struct{}{}:
+		case <-s.ctx.Done():
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-s.queries }()
+			resp, _ := s.handleQuery(query)
+			if resp == nil {
+				return
+			}
+			writeMu.Lock()
+			writeFrame(conn, resp)
+			writeMu.Unlock()
+		}()
+	}
+}
+
+// handleQuery возвращает ответ на запрос (nil - не отвечать) и допустимый размер UDP ответа
+func (s *Server) handleQuery(query []byte) ([]byte, int) {
+	if len(query) < headerSize {
+		return nil, 0
+	}
+	q, udpSize, err := parseQuery(query)
+	if err != nil {
+		return formatError(query), udpMinSize
+	}
+
+	if s.cache != nil {
+		if resp := s.cache.get(query, q); resp != nil {
+			return resp, udpSize
+		}
+	}
+
+	u := s.selectUpstream(q.name)
+	resp, err := s.exchange(u, query)
+	if err != nil {
+		log.Printf("[DNS Inbound:%s] Query %s via %s failed: %v", s.tag, q.name, u.dest.NetAddr(), err)
+		return errorResponse(query, q, rcodeServFail), udpSize
+	}
+
+	if s.cache != nil {
+		s.cache.put(q, resp)
+	}
+	return resp, udpSize
+}
+
+// selectUpstream выбирает upstream по домену запроса
+func (s *Server) selectUpstream(name string) *upstream {
+	for _, u := range s.upstreams {
+		if u.domains != nil && u.domains.Match(name) {
+			return u
+		}
+	}
+	return s.fallback
+}
+
+// exchange отправляет запрос upstream по DNS-over-TCP (RFC 7766) через outbound
+func (s *Server) exchange(u *upstream, query []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, queryTimeout)
+	defer cancel()
+
+	for {
+		conn, fresh, err := s.upstreamConn(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := conn.exchange(ctx, query)
+		if err == nil {
+			return resp, nil
+		}
+		// Upstream мог закрыть простаивавшее соединение до запроса - повторяем на новом
+		if fresh || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+// upstreamConn возвращает открытое соединение с upstream или открывает новое
+// fresh - соединение открыто для этого запроса
+func (s *Server) upstreamConn(ctx context.Context, u *upstream) (conn *upstreamConn, fresh bool, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil && !u.conn.closed() {
+		return u.conn, false, nil
+	}
+
+	// Соединение общее для всех клиентов, поэтому в сведениях о входящем нет адреса клиента
+	ctx = session.ContextWithInbound(ctx, &session.Inbound{Tag: s.tag})
+
+	var raw net.Conn
+	if u.outboundTag != "" {
+		tagged, ok := s.dispatcher.(dispatcher.TagDispatcher)
+		if !ok {
+			return nil, false, fmt.Errorf("dispatcher does not support outbound tags")
+		}
+		raw, err = tagged.DispatchWithTag(ctx, u.dest, u.outboundTag)
+	} else {
+		raw, err = s.dispatcher.Dispatch(ctx, u.dest)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	u.conn = newUpstreamConn(raw)
+	return u.conn, true, nil
+}
+
+// readFrame читает сообщение DNS-over-TCP: 2-байтовая длина и сообщение
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeFrame пишет сообщение DNS-over-TCP одним вызовом
+func writeFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	_, err := w.Write(frame)
+	return err
+}
@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// upstreamIdleTimeout соединение с upstream закрывается после такого простоя
+const upstreamIdleTimeout = 30 * time.Second
+
+// errUpstreamClosed соединение закрылось до ответа
+var errUpstreamClosed = errors.New("upstream connection closed")
+
+// upstreamConn DNS-over-TCP соединение с upstream, по которому запросы идут конвейером
+// (RFC 7766): ответы приходят в любом порядке и находят свой запрос по ID. Запросы разных
+// клиентов могут иметь одинаковый ID, поэтому upstream получает собственный
+type upstreamConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan []byte // ID upstream -> ожидающий запрос
+	err     error                  // причина закрытия, nil - соединение открыто
+}
+
+func newUpstreamConn(conn net.Conn) *upstreamConn {
+	c := &upstreamConn{
+		conn:    conn,
+		nextID:  uint16(rand.Uint32()),
+		pending: make(map[uint16]chan []byte),
+	}
+	go c.readLoop()
+	return c
+}
+
+// exchange отправляет запрос и ждет ответ на него, в ответе восстанавливается ID клиента
+func (c *upstreamConn) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	id := c.nextID
+	for c.pending[id] != nil {
+		id++
+	}
+	c.nextID = id + 1
+	ch := make(chan []byte, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	msg := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(msg, id)
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(queryTimeout))
+	err := writeFrame(c.conn, msg)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.close(err)
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, errUpstreamClosed
+		}
+		binary.BigEndian.PutUint16(resp, binary.BigEndian.Uint16(query))
+		return resp, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop раздает ответы ожидающим запросам до ошибки или простоя
+func (c *upstreamConn) readLoop() {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(upstreamIdleTimeout))
+		resp, err := readFrame(c.conn)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if len(resp) < headerSize {
+			continue
+		}
+
+		id := binary.BigEndian.Uint16(resp)
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		if ch != nil {
+			ch <- resp
+		}
+	}
+}
+
+// closed сообщает, что соединение больше не принимает запросы
+func (c *upstreamConn) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// close закрывает соединение, ожидающие запросы получают errUpstreamClosed
+func (c *upstreamConn) close(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+		for _, ch := range c.pending {
+			close(ch)
+		}
+		c.pending = nil
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
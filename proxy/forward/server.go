@@ -0,0 +1,155 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"koria-core/app/dispatcher"
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+	"strconv"
+)
+
+// Server проброс порта: каждое соединение и каждая UDP сессия на локальном порту
+// уходят через routing к одному фиксированному назначению
+type Server struct {
+	tag        string
+	listen     string
+	address    string
+	port       uint16
+	tcp        bool
+	udp        bool
+	listener   net.Listener
+	packetConn *net.UDPConn
+	dispatcher dispatcher.Interface
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// Config конфигурация проброса порта
+type Config struct {
+	Listen  string // Адрес для прослушивания (например, "127.0.0.1:5432")
+	Address string // Адрес назначения: домен или IP
+	Port    uint16 // Порт назначения
+
+	// Network пробрасываемый трафик: "tcp", "udp" или "tcp,udp" (пусто = "tcp")
+	Network string
+}
+
+// NewServer создает новый проброс порта
+func NewServer(tag string, cfg *Config, d dispatcher.Interface) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	tcp, udp := commnet.ParseNetworkList(cfg.Network)
+	return &Server{
+		tag:        tag,
+		listen:     cfg.Listen,
+		address:    cfg.Address,
+		port:       cfg.Port,
+		tcp:        tcp,
+		udp:        udp,
+		dispatcher: d,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Tag возвращает тег сервера
+func (s *Server) Tag() string {
+	return s.tag
+}
+
+// Start запускает сервер
+func (s *Server) Start() error {
+	if s.tcp {
+		listener, err := net.Listen("tcp", s.listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+		}
+		s.listener = listener
+		go s.acceptLoop()
+	}
+
+	if s.udp {
+		addr, err := net.ResolveUDPAddr("udp", s.listen)
+		if err != nil {
+			s.closeListener()
+			return fmt.Errorf("invalid listen address %s: %w", s.listen, err)
+		}
+		packetConn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			s.closeListener()
+			return fmt.Errorf("failed to listen on udp %s: %w", s.listen, err)
+		}
+		s.packetConn = packetConn
+		go s.readPackets()
+	}
+
+	log.Printf("[Forward Inbound:%s] Listening on %s, forwarding to %s", s.tag, s.listen, net.JoinHostPort(s.address, strconv.Itoa(int(s.port))))
+	return nil
+}
+
+// Close закрывает сервер
+func (s *Server) Close() error {
+	s.cancel()
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	return s.closeListener()
+}
+
+// closeListener закрывает TCP listener, если он открыт
+func (s *Server) closeListener() error {
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// GetRandomInboundProxy возвращает адрес прокси (не используется для проброса порта)
+func (s *Server) GetRandomInboundProxy() (*net.TCPAddr, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// acceptLoop принимает входящие соединения
+func (s *Server) acceptLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+				log.Printf("[Forward Inbound:%s] Accept error: %v", s.tag, err)
+				continue
+			}
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection туннелирует соединение к назначению
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	dest := commnet.TCPDestination(s.address, s.port)
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: conn.RemoteAddr()})
+
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		log.Printf("[Forward Inbound:%s] Failed to dispatch to %s: %v", s.tag, dest.String(), err)
+		return
+	}
+	defer outConn.Close()
+
+	log.Printf("[Forward Inbound:%s] Tunnel established %s -> %s", s.tag, conn.RemoteAddr(), dest.String())
+
+	commnet.Relay(conn, outConn)
+}
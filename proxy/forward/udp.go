@@ -0,0 +1,46 @@
+package forward
+
+import (
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+)
+
+// readPackets принимает датаграммы и раскладывает их по сессиям клиентов
+func (s *Server) readPackets() {
+	sessions := commnet.NewUDPSessionTable()
+
+	buf := make([]byte, commnet.MaxPacketSize)
+	for {
+		n, client, err := s.packetConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		payload := append([]byte(nil), buf[:n]...)
+		sessions.Send(client.String(), payload, func(sess *commnet.UDPSession) {
+			s.runUDPSession(sess, client)
+		})
+	}
+}
+
+// runUDPSession пересылает датаграммы клиента через dispatcher до простоя
+func (s *Server) runUDPSession(sess *commnet.UDPSession, client *net.UDPAddr) {
+	dest := commnet.UDPDestination(s.address, s.port)
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: client})
+
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		log.Printf("[Forward Inbound:%s] Failed to dispatch UDP to %s: %v", s.tag, dest.String(), err)
+		return
+	}
+	defer outConn.Close()
+
+	log.Printf("[Forward Inbound:%s] UDP session %s -> %s", s.tag, client, dest.String())
+
+	sess.Relay(s.ctx, outConn, func(payload []byte) error {
+		_, err := s.packetConn.WriteToUDP(payload, client)
+		return err
+	})
+}
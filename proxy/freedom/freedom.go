@@ -4,13 +4,22 @@ import (
 	"context"
 	"fmt"
 	commnet "koria-core/common/net"
+	"koria-core/common/session"
 	"log"
 	"net"
 )
 
 // Handler представляет Freedom outbound (прямое соединение)
 type Handler struct {
-	tag string
+	tag           string
+	proxyProtocol int // версия заголовка PROXY protocol к цели, 0 - не отправлять
+}
+
+// Config конфигурация Freedom outbound
+type Config struct {
+	// ProxyProtocol версия заголовка PROXY protocol (1 или 2), который отправляется
+	// цели перед данными TCP соединения. Цель узнает адрес клиента inbound. 0 - выключено
+	ProxyProtocol int
 }
 
 // NewHandler создает новый Freedom handler
@@ -20,6 +29,18 @@ func NewHandler(tag string) *Handler {
 	}
 }
 
+// NewHandlerWithConfig создает новый Freedom handler с конфигурацией
+func NewHandlerWithConfig(tag string, cfg *Config) (*Handler, error) {
+	if cfg.ProxyProtocol < 0 || cfg.ProxyProtocol > 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version: %d", cfg.ProxyProtocol)
+	}
+
+	return &Handler{
+		tag:           tag,
+		proxyProtocol: cfg.ProxyProtocol,
+	}, nil
+}
+
 // Tag возвращает тег обработчика
 func (h *Handler) Tag() string {
 	return h.tag
@@ -35,6 +56,89 @@ func (h *Handler) Dial(ctx context.Context, dest commnet.Destination) (net.Conn,
 		return nil, fmt.Errorf("failed to dial %s: %w", dest.String(), err)
 	}
 
+	if h.proxyProtocol != 0 && dest.Network == commnet.TCP {
+		// Без сведений об источнике заголовок говорит, что адрес клиента неизвестен
+		var source net.Addr
+		if inbound := session.InboundFromContext(ctx); inbound != nil {
+			source = inbound.Source
+		}
+		if err := commnet.WriteProxyHeader(conn, h.proxyProtocol, source, conn.RemoteAddr()); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to write proxy protocol header to %s: %w", dest.String(), err)
+		}
+	}
+
 	log.Printf("[Freedom Outbound:%s] Connected to %s", h.tag, dest.String())
 	return conn, nil
 }
+
+// Bind слушает TCP порт, к которому подключится dest (SOCKS BIND)
+// Порт открывается на локальном IP, через который идет маршрут к dest: этот адрес dest увидит.
+// Как требует RFC 1928, принимаются только соединения с адресов dest, остальные сбрасываются
+func (h *Handler) Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error) {
+	var peers []net.IP
+	if ip := net.ParseIP(dest.Address); ip != nil {
+		peers = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, dest.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", dest.Address, err)
+		}
+		for _, addr := range addrs {
+			peers = append(peers, addr.IP)
+		}
+	}
+
+	// UDP "соединение" ничего не отправляет, а только выбирает маршрут. Порт на маршрут не влияет
+	probe, err := net.Dial("udp", net.JoinHostPort(dest.Address, "9"))
+	if err != nil {
+		return nil, fmt.Errorf("no route to %s: %w", dest.Address, err)
+	}
+	localIP := probe.LocalAddr().(*net.UDPAddr).IP
+	probe.Close()
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", net.JoinHostPort(localIP.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for %s: %w", dest.String(), err)
+	}
+
+	log.Printf("[Freedom Outbound:%s] Listening on %s for %s", h.tag, listener.Addr(), dest.String())
+	return &bindListener{Listener: listener, tag: h.tag, peers: peers}, nil
+}
+
+// bindListener принимает соединения только с адресов назначения BIND. Порт открыт всем,
+// и без проверки первый нашедший его перехватил бы соединение, которое ждет клиент
+type bindListener struct {
+	net.Listener
+	tag   string
+	peers []net.IP
+}
+
+// Accept ждет соединение с одного из адресов назначения, чужие закрывает
+func (l *bindListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.allowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		log.Printf("[Freedom Outbound:%s] Dropped BIND connection from unexpected %s", l.tag, conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+func (l *bindListener) allowed(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ip := range l.peers {
+		if ip.Equal(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// authRequiredResponse ответ клиенту без верного Proxy-Authorization
+const authRequiredResponse = "HTTP/1.1 407 Proxy Authentication Required\r\n" +
+	"Proxy-Authenticate: Basic realm=\"koria\"\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+// authenticate проверяет Proxy-Authorization: Basic и возвращает имя пользователя
+// Без настроенных аккаунтов пропускает всех с пустым именем
+func (s *Server) authenticate(req *http.Request) (string, bool) {
+	if len(s.accounts) == 0 {
+		return "", true
+	}
+
+	const prefix = "Basic "
+	header := req.Header.Get("Proxy-Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return "", false
+	}
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", false
+	}
+
+	expected, exists := s.accounts[user]
+	if !exists || subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) != 1 {
+		return "", false
+	}
+	return user, true
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopByHopHeaders заголовки одного соединения (RFC 7230, 6.1), прокси их не пересылает
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHop удаляет заголовки соединения, включая перечисленные в Connection
+// Запрос на смену протокола (Connection: Upgrade) сохраняется, чтобы работали WebSocket
+func removeHopByHop(header http.Header) {
+	upgrade := ""
+	for _, field := range header["Connection"] {
+		for _, name := range strings.Split(field, ",") {
+			name = textproto.TrimString(name)
+			if strings.EqualFold(name, "Upgrade") {
+				upgrade = header.Get("Upgrade")
+			}
+			if name != "" {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+
+	if upgrade != "" {
+		header.Set("Connection", "Upgrade")
+		header.Set("Upgrade", upgrade)
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	commnet "koria-core/common/net"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// handshakeTimeout время на ответ upstream прокси на CONNECT
+const handshakeTimeout = 10 * time.Second
+
+// Handler представляет HTTP outbound (CONNECT через upstream HTTP прокси)
+type Handler struct {
+	tag           string
+	server        string
+	authorization string // значение Proxy-Authorization, пусто - без аутентификации
+}
+
+// OutboundConfig конфигурация HTTP outbound
+type OutboundConfig struct {
+	Address string // Адрес upstream прокси
+	Port    int    // Порт upstream прокси
+
+	// User и Pass учетные данные Basic аутентификации. Пустой User - без аутентификации
+	User string
+	Pass string
+}
+
+// NewHandler создает новый HTTP outbound handler
+func NewHandler(tag string, cfg *OutboundConfig) *Handler {
+	h := &Handler{
+		tag:    tag,
+		server: net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+	}
+	if cfg.User != "" {
+		h.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.User+":"+cfg.Pass))
+	}
+	return h
+}
+
+// Tag возвращает тег обработчика
+func (h *Handler) Tag() string {
+	return h.tag
+}
+
+// Dial создает туннель к назначению через CONNECT upstream прокси
+func (h *Handler) Dial(ctx context.Context, dest commnet.Destination) (net.Conn, error) {
+	if dest.Network != commnet.TCP {
+		return nil, fmt.Errorf("http outbound supports only TCP, got %s", dest.Network)
+	}
+
+	log.Printf("[HTTP Outbound:%s] Dialing %s via %s", h.tag, dest.String(), h.server)
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", h.server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial http proxy %s: %w", h.server, err)
+	}
+
+	deadline := time.Now().Add(handshakeTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	tunnel, err := h.connect(conn, dest)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("http connect to %s: %w", dest.String(), err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	log.Printf("[HTTP Outbound:%s] Connected to %s", h.tag, dest.String())
+	return tunnel, nil
+}
+
+// connect отправляет CONNECT и ждет ответ 2xx
+func (h *Handler) connect(conn net.Conn, dest commnet.Destination) (net.Conn, error) {
+	target := dest.NetAddr()
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if h.authorization != "" {
+		req.Header.Set("Proxy-Authorization", h.authorization)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	// Тело не закрываем: у ответа на CONNECT оно тянется до конца туннеля
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		class := commnet.ErrorGeneral
+		switch resp.StatusCode {
+		case http.StatusForbidden, http.StatusProxyAuthRequired:
+			class = commnet.ErrorNotAllowed
+		case http.StatusGatewayTimeout:
+			class = commnet.ErrorTTLExpired
+		}
+		return nil, &commnet.ClassError{Class: class, Err: fmt.Errorf("proxy replied: %s", resp.Status)}
+	}
+
+	// Прокси мог прислать первые байты туннеля вместе с ответом
+	return commnet.NewBufferedConn(conn, reader), nil
+}
@@ -3,34 +3,67 @@ package http
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
-	commio "koria-core/common/io"
+	"io"
 	commnet "koria-core/common/net"
+	"koria-core/common/session"
 	"koria-core/app/dispatcher"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
+)
+
+const (
+	// keepAliveTimeout сколько соединение клиента ждет следующий запрос
+	keepAliveTimeout = 2 * time.Minute
+
+	// requestWriteGrace сколько после ответа ждать окончания отправки тела запроса
+	requestWriteGrace = 5 * time.Second
 )
 
 // Server представляет HTTP proxy сервер
 type Server struct {
 	tag        string
 	listen     string
+	proxyHdr   bool              // соединения приходят от балансировщика с заголовком PROXY protocol
+	accounts   map[string]string // логин -> пароль, пусто - без аутентификации
 	listener   net.Listener
 	dispatcher dispatcher.Interface
 	ctx        context.Context
 	cancel     context.CancelFunc
 }
 
+// Config конфигурация HTTP proxy сервера
+type Config struct {
+	Listen string // Адрес для прослушивания (например, "127.0.0.1:1080")
+
+	// AcceptProxyProtocol ждет заголовок PROXY protocol v1/v2 в начале каждого соединения,
+	// адрес клиента для маршрутизации и логов берется из него
+	AcceptProxyProtocol bool
+
+	// Accounts логины и пароли для Proxy-Authorization: Basic. Если заданы, запросы
+	// без них получают 407 Proxy Authentication Required
+	Accounts map[string]string
+}
+
 // NewServer создает новый HTTP proxy сервер
 func NewServer(tag string, listen string, d dispatcher.Interface) *Server {
+	return NewServerWithConfig(tag, &Config{Listen: listen}, d)
+}
+
+// NewServerWithConfig создает новый HTTP proxy сервер с конфигурацией
+func NewServerWithConfig(tag string, cfg *Config, d dispatcher.Interface) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		tag:        tag,
-		listen:     listen,
+		listen:     cfg.Listen,
+		proxyHdr:   cfg.AcceptProxyProtocol,
+		accounts:   cfg.Accounts,
 		dispatcher: d,
 		ctx:        ctx,
 		cancel:     cancel,
@@ -94,28 +127,80 @@ func (s *Server) acceptLoop() {
 	}
 }
 
+// ServeConn обслуживает соединение, принятое другим inbound (например, mixed)
+// Соединение закрывается по окончании
+func (s *Server) ServeConn(conn net.Conn) {
+	s.handleConnection(conn)
+}
+
 // handleConnection обрабатывает одно HTTP соединение
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	reader := bufio.NewReader(conn)
-	req, err := http.ReadRequest(reader)
-	if err != nil {
-		log.Printf("[HTTP Inbound:%s] Failed to read request: %v", s.tag, err)
-		return
+	// За балансировщиком настоящий адрес клиента приходит в заголовке PROXY protocol
+	if s.proxyHdr {
+		conn.SetReadDeadline(time.Now().Add(commnet.ProxyHeaderTimeout))
+		proxied, err := commnet.ReadProxyHeader(conn)
+		if err != nil {
+			log.Printf("[HTTP Inbound:%s] PROXY protocol header from %s rejected: %v", s.tag, conn.RemoteAddr(), err)
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		conn = proxied
 	}
 
-	log.Printf("[HTTP Inbound:%s] %s %s %s", s.tag, req.Method, req.Host, req.Proto)
+	// Соединение клиента живет несколько запросов, в том числе к разным хостам
+	var upstream upstreamConn
+	defer upstream.close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(keepAliveTimeout))
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("[HTTP Inbound:%s] Failed to read request: %v", s.tag, err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
 
-	if req.Method == "CONNECT" {
-		s.handleCONNECT(conn, req)
-	} else {
-		s.handleHTTP(conn, reader, req)
+		user, ok := s.authenticate(req)
+		if !ok {
+			log.Printf("[HTTP Inbound:%s] Proxy authentication from %s failed", s.tag, conn.RemoteAddr())
+			if _, err := conn.Write([]byte(authRequiredResponse)); err != nil {
+				return
+			}
+			// Клиент повторит запрос с паролем по этому же соединению, если его не занимает тело
+			if req.Close || (req.Body != nil && req.Body != http.NoBody) {
+				return
+			}
+			continue
+		}
+
+		if user != "" {
+			log.Printf("[HTTP Inbound:%s] %s %s %s from %s (user %s)", s.tag, req.Method, req.Host, req.Proto, conn.RemoteAddr(), user)
+		} else {
+			log.Printf("[HTTP Inbound:%s] %s %s %s from %s", s.tag, req.Method, req.Host, req.Proto, conn.RemoteAddr())
+		}
+
+		// Пользователь нужен маршрутизации, поэтому сведения о клиенте собираются на каждый запрос
+		ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: conn.RemoteAddr(), User: user})
+
+		if req.Method == "CONNECT" {
+			// Клиент мог отправить начало туннеля, не дожидаясь ответа
+			s.handleCONNECT(ctx, commnet.NewBufferedConn(conn, reader), req)
+			return
+		}
+
+		if !s.handleHTTP(ctx, conn, reader, req, &upstream) {
+			return
+		}
 	}
 }
 
 // handleCONNECT обрабатывает HTTPS туннелинг
-func (s *Server) handleCONNECT(conn net.Conn, req *http.Request) {
+func (s *Server) handleCONNECT(ctx context.Context, conn net.Conn, req *http.Request) {
 	// Парсим хост и порт
 	host, portStr, err := net.SplitHostPort(req.Host)
 	if err != nil {
@@ -135,7 +220,7 @@ func (s *Server) handleCONNECT(conn net.Conn, req *http.Request) {
 	dest := commnet.TCPDestination(host, uint16(port))
 
 	// Диспатчим через outbound
-	outConn, err := s.dispatcher.Dispatch(s.ctx, dest)
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
 	if err != nil {
 		log.Printf("[HTTP Inbound:%s] Failed to dispatch: %v", s.tag, err)
 		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
@@ -148,29 +233,36 @@ func (s *Server) handleCONNECT(conn net.Conn, req *http.Request) {
 
 	log.Printf("[HTTP Inbound:%s] HTTPS tunnel established to %s", s.tag, req.Host)
 
-	// Туннелирование с оптимизированным копированием
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		commio.Copy(outConn, conn)
-		outConn.Close()
-	}()
-
-	go func() {
-		defer wg.Done()
-		commio.Copy(conn, outConn)
-		conn.Close()
-	}()
-
-	wg.Wait()
+	commnet.Relay(conn, outConn)
 	// Логируем только при debug
 	// log.Printf("[HTTP Inbound:%s] HTTPS tunnel closed for %s", s.tag, req.Host)
 }
 
-// handleHTTP обрабатывает обычный HTTP запрос
-func (s *Server) handleHTTP(conn net.Conn, reader *bufio.Reader, req *http.Request) {
+// upstreamConn соединение с сервером назначения, которое переиспользуется между запросами
+type upstreamConn struct {
+	dest   commnet.Destination
+	user   string // маршрут зависит от пользователя
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// close закрывает соединение, если оно открыто
+func (u *upstreamConn) close() {
+	if u.conn != nil {
+		u.conn.Close()
+		*u = upstreamConn{}
+	}
+}
+
+// handleHTTP пересылает обычный HTTP запрос и ответ на него
+// Возвращает true, если соединение клиента можно использовать для следующего запроса
+func (s *Server) handleHTTP(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *http.Request, upstream *upstreamConn) bool {
+	if req.URL.Scheme != "" && req.URL.Scheme != "http" {
+		log.Printf("[HTTP Inbound:%s] Unsupported scheme: %s", s.tag, req.URL.Scheme)
+		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+		return false
+	}
+
 	// Определяем хост и порт
 	host := req.Host
 	if host == "" {
@@ -185,36 +277,144 @@ func (s *Server) handleHTTP(conn net.Conn, reader *bufio.Reader, req *http.Reque
 	if err != nil {
 		log.Printf("[HTTP Inbound:%s] Invalid host: %v", s.tag, err)
 		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
-		return
+		return false
 	}
 
 	port, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
 		log.Printf("[HTTP Inbound:%s] Invalid port: %v", s.tag, err)
 		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
-		return
+		return false
 	}
 
 	// Создаем destination
 	dest := commnet.TCPDestination(h, uint16(port))
 
-	// Диспатчим через outbound
-	outConn, err := s.dispatcher.Dispatch(s.ctx, dest)
+	// Запрос уходит серверу в origin-form (Request.Write) без заголовков соединения клиента
+	removeHopByHop(req.Header)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Иначе Request.Write подставит User-Agent Go
+		req.Header.Set("User-Agent", "")
+	}
+	keepAlive := !req.Close && req.ProtoAtLeast(1, 1)
+	req.Close = false
+
+	// Соединение с другим хостом или выбранное для другого пользователя не подходит
+	user := session.InboundFromContext(ctx).User
+	if upstream.conn != nil && (upstream.dest != dest || upstream.user != user) {
+		upstream.close()
+	}
+
+	// Сервер мог закрыть простаивавшее соединение: запрос без тела повторяем по новому
+	reused := upstream.conn != nil
+	resp, writeDone, err := s.roundTrip(ctx, conn, req, dest, upstream)
+	if err != nil && reused && (req.Body == nil || req.Body == http.NoBody) {
+		upstream.close()
+		resp, writeDone, err = s.roundTrip(ctx, conn, req, dest, upstream)
+	}
 	if err != nil {
-		log.Printf("[HTTP Inbound:%s] Failed to dispatch: %v", s.tag, err)
+		log.Printf("[HTTP Inbound:%s] Request to %s failed: %v", s.tag, dest.String(), err)
 		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
-		return
+		return false
 	}
-	defer outConn.Close()
+	defer resp.Body.Close()
 
-	// Отправляем запрос
-	if err := req.Write(outConn); err != nil {
-		log.Printf("[HTTP Inbound:%s] Failed to write request: %v", s.tag, err)
-		return
+	// Смена протокола (WebSocket): дальше байты идут как есть в обе стороны
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		removeHopByHop(resp.Header)
+		if err := writeHeader(conn, resp); err != nil {
+			return false
+		}
+		outConn := commnet.NewBufferedConn(upstream.conn, upstream.reader)
+		upstream.conn = nil
+		defer outConn.Close()
+		commnet.Relay(commnet.NewBufferedConn(conn, reader), outConn)
+		return false
+	}
+
+	// Сервер закрывает соединение или тело ответа длится до EOF - соединение не переиспользуем
+	delimited := resp.ContentLength >= 0 || len(resp.TransferEncoding) > 0 || resp.Body == http.NoBody
+	reusable := !resp.Close && delimited
+	removeHopByHop(resp.Header)
+
+	// Клиенту отвечаем от своего имени по HTTP/1.1. Тело до EOF передаем chunked,
+	// чтобы его конец не требовал закрыть соединение клиента
+	resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	if !delimited && keepAlive {
+		resp.TransferEncoding = []string{"chunked"}
+	}
+	resp.Close = !keepAlive
+	if err := resp.Write(conn); err != nil {
+		upstream.close()
+		return false
 	}
 
-	// Копируем ответ с оптимизацией
-	commio.Copy(conn, outConn)
+	// Тело запроса должно уйти целиком, иначе соединения рассинхронизированы
+	select {
+	case err := <-writeDone:
+		if err != nil {
+			upstream.close()
+			return false
+		}
+	case <-time.After(requestWriteGrace):
+		upstream.close()
+		return false
+	}
+
+	if !reusable {
+		upstream.close()
+	}
 	// Логируем только при debug
 	// log.Printf("[HTTP Inbound:%s] HTTP request completed for %s", s.tag, req.Host)
+	return keepAlive
+}
+
+// roundTrip отправляет запрос серверу и возвращает окончательный ответ
+// Промежуточные ответы 1xx (кроме 101) сразу передаются клиенту. Тело запроса пишется
+// параллельно, чтобы клиент с Expect: 100-continue получил 100 Continue до отправки тела;
+// результат записи приходит в возвращаемый канал
+func (s *Server) roundTrip(ctx context.Context, conn net.Conn, req *http.Request, dest commnet.Destination, upstream *upstreamConn) (*http.Response, <-chan error, error) {
+	if upstream.conn == nil {
+		outConn, err := s.dispatcher.Dispatch(ctx, dest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dispatch: %w", err)
+		}
+		user := session.InboundFromContext(ctx).User
+		*upstream = upstreamConn{dest: dest, user: user, conn: outConn, reader: bufio.NewReader(outConn)}
+	}
+
+	writeDone := make(chan error, 1)
+	go func() {
+		writeDone <- req.Write(upstream.conn)
+	}()
+
+	for {
+		resp, err := http.ReadResponse(upstream.reader, req)
+		if err != nil {
+			upstream.close()
+			return nil, nil, fmt.Errorf("read response: %w", err)
+		}
+
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			removeHopByHop(resp.Header)
+			if err := writeHeader(conn, resp); err != nil {
+				upstream.close()
+				return nil, nil, fmt.Errorf("write interim response: %w", err)
+			}
+			continue
+		}
+
+		return resp, writeDone, nil
+	}
+}
+
+// writeHeader отправляет клиенту ответ без тела: 1xx и 101 Switching Protocols
+// Response.Write добавил бы к ним Content-Length, запрещенный для 1xx (RFC 7230, 3.3.2)
+func writeHeader(conn net.Conn, resp *http.Response) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(&b)
+	b.WriteString("\r\n")
+	_, err := io.WriteString(conn, b.String())
+	return err
 }
@@ -0,0 +1,162 @@
+package koria
+
+import (
+	"context"
+	"fmt"
+	commnet "koria-core/common/net"
+	"koria-core/protocol/multiplexer"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bindListener ждет соединение, которое сервер принял для BIND и передал обратным потоком
+type bindListener struct {
+	handler *Handler
+	control *multiplexer.Stream
+	addr    net.Addr
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Bind просит сервер принять TCP соединение от dest. Сервер отвечает адресом, который
+// он слушает, а принятое соединение открывает обратным потоком
+func (h *Handler) Bind(ctx context.Context, dest commnet.Destination) (net.Listener, error) {
+	conn, err := h.client.DialStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	control, ok := conn.(*multiplexer.Stream)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected stream type %T", conn)
+	}
+
+	// Регистрируем ожидание до запроса, чтобы обратный поток не разминулся с ним
+	listener := &bindListener{
+		handler: h,
+		control: control,
+		conns:   make(chan net.Conn, 1),
+		done:    make(chan struct{}),
+	}
+	h.bindsMu.Lock()
+	h.binds[control.ID()] = listener
+	h.bindsMu.Unlock()
+	h.acceptOnce.Do(func() { go h.acceptReverse() })
+
+	if _, err := control.Write([]byte(fmt.Sprintf("BIND %s\n", dest.NetAddr()))); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to send destination: %w", err)
+	}
+
+	line, err := readLine(control)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to read server response: %w", err)
+	}
+
+	listener.addr, err = parseReply(line, commnet.TCP)
+	if err == nil && listener.addr == nil {
+		err = fmt.Errorf("server did not report bound address")
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// Сервер закрывает управляющий поток, если ожидание прервалось на его стороне
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := control.Read(buf); err != nil {
+				listener.Close()
+				return
+			}
+		}
+	}()
+
+	log.Printf("[Koria Outbound:%s] Server listening on %s for %s", h.tag, listener.addr, dest.String())
+	return listener, nil
+}
+
+// acceptReverse принимает обратные потоки сервера и отдает их ожидающим BIND
+func (h *Handler) acceptReverse() {
+	for {
+		stream, err := h.client.AcceptStream()
+		if err != nil {
+			return
+		}
+		go h.handleReverse(stream)
+	}
+}
+
+// handleReverse читает заголовок "BOUND <id> host:port\n" обратного потока
+func (h *Handler) handleReverse(stream net.Conn) {
+	line, err := readLine(stream)
+	if err != nil {
+		stream.Close()
+		return
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[0] != "BOUND" {
+		log.Printf("[Koria Outbound:%s] Invalid reverse stream header", h.tag)
+		stream.Close()
+		return
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		stream.Close()
+		return
+	}
+	remote, err := parseAddr(commnet.TCP, parts[2])
+	if err != nil {
+		stream.Close()
+		return
+	}
+
+	h.bindsMu.Lock()
+	listener := h.binds[uint16(id)]
+	h.bindsMu.Unlock()
+	if listener == nil {
+		stream.Close()
+		return
+	}
+
+	select {
+	case listener.conns <- &commnet.AddrConn{Conn: stream, Remote: remote}:
+	default:
+		stream.Close()
+	}
+}
+
+// Accept возвращает соединение, которое принял сервер
+func (l *bindListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close отменяет ожидание на сервере
+func (l *bindListener) Close() error {
+	l.once.Do(func() {
+		l.handler.bindsMu.Lock()
+		delete(l.handler.binds, l.control.ID())
+		l.handler.bindsMu.Unlock()
+
+		close(l.done)
+		l.control.Close()
+	})
+	return nil
+}
+
+// Addr возвращает адрес, который слушает сервер
+func (l *bindListener) Addr() net.Addr {
+	return l.addr
+}
@@ -4,16 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
-	commio "koria-core/common/io"
 	commnet "koria-core/common/net"
+	"koria-core/common/session"
 	"koria-core/app/dispatcher"
-	"koria-core/config"
+	"koria-core/protocol/multiplexer"
 	"koria-core/transport"
 	"log"
 	"net"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 // Server представляет Koria inbound (принимает соединения по Koria протоколу)
@@ -26,12 +25,7 @@ type Server struct {
 }
 
 // NewServer создает новый Koria inbound сервер
-func NewServer(tag string, listen string, users []config.User, d dispatcher.Interface) (*Server, error) {
-	serverConfig := &transport.ServerConfig{
-		ListenAddr: listen,
-		Users:      users,
-	}
-
+func NewServer(tag string, serverConfig *transport.ServerConfig, d dispatcher.Interface) (*Server, error) {
 	server, err := transport.Listen(serverConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create transport server: %w", err)
@@ -110,7 +104,9 @@ func (s *Server) handleStream(stream net.Conn) {
 	defer stream.Close()
 
 	// Читаем destination от клиента
-	// Формат: "CONNECT host:port\n"
+	// Формат: "CONNECT host:port\n", "UDP host:port\n" для датаграмм
+	// или "BIND host:port\n" для входящего соединения от host
+	// Ответ: "OK host:port\n" с адресом исходящего соединения или "ERR <класс>\n"
 	buf := make([]byte, 1024)
 	n, err := stream.Read(buf)
 	if err != nil {
@@ -121,7 +117,15 @@ func (s *Server) handleStream(stream net.Conn) {
 	line := string(buf[:n])
 
 	// Парсим команду
-	if !strings.HasPrefix(line, "CONNECT ") {
+	network := commnet.TCP
+	bind := false
+	switch {
+	case strings.HasPrefix(line, "CONNECT "):
+	case strings.HasPrefix(line, "UDP "):
+		network = commnet.UDP
+	case strings.HasPrefix(line, "BIND "):
+		bind = true
+	default:
 		log.Printf("[Koria Inbound:%s] Invalid command: %s", s.tag, line[:min(len(line), 50)])
 		return
 	}
@@ -129,69 +133,125 @@ func (s *Server) handleStream(stream net.Conn) {
 	// Извлекаем host:port
 	parts := strings.Fields(line)
 	if len(parts) < 2 {
-		log.Printf("[Koria Inbound:%s] Invalid CONNECT command", s.tag)
+		log.Printf("[Koria Inbound:%s] Invalid %s command", s.tag, parts[0])
 		return
 	}
 
 	targetAddr := parts[1]
-	log.Printf("[Koria Inbound:%s] CONNECT request to %s", s.tag, targetAddr)
+	log.Printf("[Koria Inbound:%s] %s request to %s from %s", s.tag, parts[0], targetAddr, stream.RemoteAddr())
 
 	// Парсим host и port
 	host, portStr, err := net.SplitHostPort(targetAddr)
 	if err != nil {
 		log.Printf("[Koria Inbound:%s] Invalid target address: %v", s.tag, err)
-		stream.Write([]byte("ERR\n"))
+		writeError(stream, commnet.ErrorGeneral)
 		return
 	}
 
 	port, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
 		log.Printf("[Koria Inbound:%s] Invalid port: %v", s.tag, err)
-		stream.Write([]byte("ERR\n"))
+		writeError(stream, commnet.ErrorGeneral)
 		return
 	}
 
 	// Создаем destination
-	dest := commnet.TCPDestination(host, uint16(port))
+	dest := commnet.Destination{Network: network, Address: host, Port: uint16(port)}
+
+	// Источник потока - адрес клиента, чье TCP соединение несет мультиплексор
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: stream.RemoteAddr()})
+
+	if bind {
+		s.handleBind(ctx, stream, dest)
+		return
+	}
 
 	// Dispatch через outbound
-	outConn, err := s.dispatcher.Dispatch(s.ctx, dest)
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
 	if err != nil {
 		log.Printf("[Koria Inbound:%s] Failed to dispatch: %v", s.tag, err)
-		stream.Write([]byte("ERR\n"))
+		writeError(stream, commnet.ClassifyError(err))
 		return
 	}
 	defer outConn.Close()
 
-	// Отправляем OK клиенту
-	if _, err := stream.Write([]byte("OK\n")); err != nil {
+	// Отправляем OK клиенту с адресом, который видит назначение
+	if _, err := stream.Write([]byte("OK " + outConn.LocalAddr().String() + "\n")); err != nil {
 		log.Printf("[Koria Inbound:%s] Failed to send OK: %v", s.tag, err)
 		return
 	}
 
-	log.Printf("[Koria Inbound:%s] Tunnel established to %s", s.tag, targetAddr)
+	log.Printf("[Koria Inbound:%s] Tunnel established to %s", s.tag, dest.String())
+
+	// Датаграммы идут по потоку с длиной, чтобы сохранить их границы
+	if network == commnet.UDP {
+		stream = commnet.NewStreamPacketConn(stream)
+	}
 
 	// Туннелирование данных с оптимизацией
-	var wg sync.WaitGroup
-	wg.Add(2)
+	commnet.Relay(stream, outConn)
+	// Логируем только при debug
+	// log.Printf("[Koria Inbound:%s] Tunnel closed for %s", s.tag, targetAddr)
+}
 
-	// Stream -> Target
-	go func() {
-		defer wg.Done()
-		commio.Copy(outConn, stream)
-		outConn.Close()
-	}()
+// handleBind принимает входящее соединение от dest через outbound и передает его клиенту
+// Отвечает "OK host:port\n" с адресом, который слушает outbound. Принятое соединение
+// приходит клиенту обратным потоком, первая строка которого "BOUND <id> host:port\n":
+// ID управляющего потока и адрес подключившегося. Закрытие управляющего потока клиентом
+// отменяет ожидание
+func (s *Server) handleBind(ctx context.Context, stream net.Conn, dest commnet.Destination) {
+	binder, ok := s.dispatcher.(dispatcher.Binder)
+	control, isStream := stream.(*multiplexer.Stream)
+	if !ok || !isStream {
+		log.Printf("[Koria Inbound:%s] BIND is not supported", s.tag)
+		writeError(stream, commnet.ErrorGeneral)
+		return
+	}
+
+	listener, err := binder.Bind(ctx, dest)
+	if err != nil {
+		log.Printf("[Koria Inbound:%s] Failed to bind for %s: %v", s.tag, dest.String(), err)
+		writeError(stream, commnet.ClassifyError(err))
+		return
+	}
+	defer listener.Close()
+
+	if _, err := stream.Write([]byte("OK " + listener.Addr().String() + "\n")); err != nil {
+		return
+	}
 
-	// Target -> Stream
 	go func() {
-		defer wg.Done()
-		commio.Copy(stream, outConn)
-		stream.Close()
+		io.Copy(io.Discard, stream)
+		listener.Close()
 	}()
 
-	wg.Wait()
-	// Логируем только при debug
-	// log.Printf("[Koria Inbound:%s] Tunnel closed for %s", s.tag, targetAddr)
+	peer, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	listener.Close()
+	defer peer.Close()
+
+	reverse, err := control.Multiplexer().OpenStream(ctx)
+	if err != nil {
+		log.Printf("[Koria Inbound:%s] Failed to open reverse stream: %v", s.tag, err)
+		return
+	}
+	defer reverse.Close()
+
+	header := fmt.Sprintf("BOUND %d %s\n", control.ID(), peer.RemoteAddr())
+	if _, err := reverse.Write([]byte(header)); err != nil {
+		return
+	}
+
+	log.Printf("[Koria Inbound:%s] BIND for %s accepted %s", s.tag, dest.String(), peer.RemoteAddr())
+
+	commnet.Relay(reverse, peer)
+}
+
+// writeError отвечает клиенту "ERR <класс>\n"
+func writeError(stream net.Conn, class commnet.ErrorClass) {
+	stream.Write([]byte("ERR " + string(class) + "\n"))
 }
 
 func min(a, b int) int {
@@ -205,8 +265,10 @@ func min(a, b int) int {
 func (s *Server) handleTransparent(stream net.Conn, dest commnet.Destination) {
 	defer stream.Close()
 
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: stream.RemoteAddr()})
+
 	// Dispatch через outbound
-	outConn, err := s.dispatcher.Dispatch(s.ctx, dest)
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
 	if err != nil {
 		log.Printf("[Koria Inbound:%s] Failed to dispatch: %v", s.tag, err)
 		return
@@ -216,21 +278,6 @@ func (s *Server) handleTransparent(stream net.Conn, dest commnet.Destination) {
 	log.Printf("[Koria Inbound:%s] Tunnel established to %s", s.tag, dest.String())
 
 	// Tunnel
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		io.Copy(outConn, stream)
-		outConn.Close()
-	}()
-
-	go func() {
-		defer wg.Done()
-		io.Copy(stream, outConn)
-		stream.Close()
-	}()
-
-	wg.Wait()
+	commnet.Relay(stream, outConn)
 	log.Printf("[Koria Inbound:%s] Tunnel closed for %s", s.tag, dest.String())
 }
@@ -6,13 +6,22 @@ import (
 	commnet "koria-core/common/net"
 	"koria-core/transport"
 	"log"
+	"io"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // Handler представляет Koria outbound (через Koria протокол)
 type Handler struct {
 	tag    string
 	client *transport.Client
+
+	// Ожидающие BIND по ID управляющего потока
+	binds      map[uint16]*bindListener
+	bindsMu    sync.Mutex
+	acceptOnce sync.Once
 }
 
 // NewHandler создает новый Koria outbound handler
@@ -20,6 +29,7 @@ func NewHandler(tag string, client *transport.Client) *Handler {
 	return &Handler{
 		tag:    tag,
 		client: client,
+		binds:  make(map[uint16]*bindListener),
 	}
 }
 
@@ -39,25 +49,101 @@ func (h *Handler) Dial(ctx context.Context, dest commnet.Destination) (net.Conn,
 	}
 
 	// Отправляем информацию о destination серверу
-	// Формат: "CONNECT host:port\n" (совместимо с http_proxy)
-	destStr := fmt.Sprintf("CONNECT %s\n", dest.NetAddr())
+	// Формат: "CONNECT host:port\n" (совместимо с http_proxy), для UDP - "UDP host:port\n"
+	command := "CONNECT"
+	if dest.Network == commnet.UDP {
+		command = "UDP"
+	}
+	destStr := fmt.Sprintf("%s %s\n", command, dest.NetAddr())
 	if _, err := stream.Write([]byte(destStr)); err != nil {
 		stream.Close()
 		return nil, fmt.Errorf("failed to send destination: %w", err)
 	}
 
 	// Ждем подтверждение от сервера
-	buf := make([]byte, 3)
-	if _, err := stream.Read(buf); err != nil {
+	line, err := readLine(stream)
+	if err != nil {
 		stream.Close()
 		return nil, fmt.Errorf("failed to read server response: %w", err)
 	}
 
-	if string(buf) != "OK\n" {
+	local, err := parseReply(line, dest.Network)
+	if err != nil {
 		stream.Close()
-		return nil, fmt.Errorf("server rejected connection")
+		return nil, err
 	}
 
 	log.Printf("[Koria Outbound:%s] Stream opened for %s", h.tag, dest.String())
-	return stream, nil
+
+	// Локальный адрес потока - адрес исходящего соединения на сервере
+	var conn net.Conn = stream
+	if local != nil {
+		conn = &commnet.AddrConn{Conn: stream, Local: local}
+	}
+
+	// Датаграммы идут по потоку с длиной, чтобы сохранить их границы
+	if dest.Network == commnet.UDP {
+		return commnet.NewStreamPacketConn(conn), nil
+	}
+	return conn, nil
+}
+
+// maxLineLength максимальная длина строки ответа сервера
+const maxLineLength = 256
+
+// readLine читает строку ответа сервера побайтно, чтобы не захватить данные после нее
+func readLine(conn net.Conn) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < maxLineLength {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", fmt.Errorf("response line too long")
+}
+
+// parseReply разбирает ответ сервера "OK host:port" с адресом исходящего соединения или
+// "ERR <класс>" с классом ошибки. Старые серверы отвечают "OK" и "ERR" без них
+func parseReply(line string, network commnet.Network) (net.Addr, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid server response")
+	}
+
+	switch fields[0] {
+	case "OK":
+		if len(fields) < 2 {
+			return nil, nil
+		}
+		return parseAddr(network, fields[1])
+	case "ERR":
+		class := commnet.ErrorGeneral
+		if len(fields) >= 2 {
+			class = commnet.ErrorClass(fields[1])
+		}
+		return nil, &commnet.ClassError{Class: class, Err: fmt.Errorf("server rejected connection: %s", class)}
+	}
+	return nil, fmt.Errorf("invalid server response: %q", line[:min(len(line), 50)])
+}
+
+// parseAddr разбирает "ip:port" в адрес сети network
+func parseAddr(network commnet.Network, s string) (net.Addr, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == commnet.UDP {
+		return &net.UDPAddr{IP: net.ParseIP(host), Port: int(port)}, nil
+	}
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: int(port)}, nil
 }
@@ -0,0 +1,153 @@
+package mixed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"koria-core/app/dispatcher"
+	commnet "koria-core/common/net"
+	proxyhttp "koria-core/proxy/http"
+	"koria-core/proxy/socks"
+	"log"
+	"net"
+	"time"
+)
+
+// detectTimeout сколько ждать первый байт, по которому выбирается протокол
+const detectTimeout = 30 * time.Second
+
+// Server принимает на одном порту SOCKS4/4a, SOCKS5 и HTTP прокси
+// Протокол определяется по первому байту: 0x04 и 0x05 - SOCKS, остальное - HTTP
+type Server struct {
+	tag      string
+	listen   string
+	proxyHdr bool // соединения приходят от балансировщика с заголовком PROXY protocol
+	listener net.Listener
+	socks    *socks.Server
+	http     *proxyhttp.Server
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// Config конфигурация mixed inbound
+type Config struct {
+	Listen string // Адрес для прослушивания (например, "127.0.0.1:7890")
+
+	// AcceptProxyProtocol ждет заголовок PROXY protocol v1/v2 в начале каждого соединения,
+	// адрес клиента для маршрутизации и логов берется из него
+	AcceptProxyProtocol bool
+
+	// Accounts логины и пароли для SOCKS5 (RFC 1929) и HTTP (Basic)
+	Accounts map[string]string
+}
+
+// NewServer создает новый mixed inbound
+func NewServer(tag string, cfg *Config, d dispatcher.Interface) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		tag:      tag,
+		listen:   cfg.Listen,
+		proxyHdr: cfg.AcceptProxyProtocol,
+		socks:    socks.NewServerWithConfig(tag, &socks.Config{Listen: cfg.Listen, Accounts: cfg.Accounts}, d),
+		http:     proxyhttp.NewServerWithConfig(tag, &proxyhttp.Config{Listen: cfg.Listen, Accounts: cfg.Accounts}, d),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Tag возвращает тег сервера
+func (s *Server) Tag() string {
+	return s.tag
+}
+
+// Start запускает сервер
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+	}
+	s.listener = listener
+
+	log.Printf("[Mixed Inbound:%s] Listening on %s", s.tag, s.listen)
+
+	go s.acceptLoop()
+	return nil
+}
+
+// Close закрывает сервер и обработчики протоколов
+func (s *Server) Close() error {
+	s.cancel()
+	s.socks.Close()
+	s.http.Close()
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// GetRandomInboundProxy возвращает адрес прокси (не используется для mixed)
+func (s *Server) GetRandomInboundProxy() (*net.TCPAddr, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// acceptLoop принимает входящие соединения
+func (s *Server) acceptLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+				log.Printf("[Mixed Inbound:%s] Accept error: %v", s.tag, err)
+				continue
+			}
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection определяет протокол и передает соединение его обработчику
+func (s *Server) handleConnection(conn net.Conn) {
+	// SOCKS открывает UDP relay на локальном адресе, а не на адресе из PROXY protocol
+	localAddr := conn.LocalAddr()
+
+	// За балансировщиком настоящий адрес клиента приходит в заголовке PROXY protocol
+	if s.proxyHdr {
+		conn.SetReadDeadline(time.Now().Add(commnet.ProxyHeaderTimeout))
+		proxied, err := commnet.ReadProxyHeader(conn)
+		if err != nil {
+			log.Printf("[Mixed Inbound:%s] PROXY protocol header from %s rejected: %v", s.tag, conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		conn = proxied
+	}
+
+	conn.SetReadDeadline(time.Now().Add(detectTimeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// Прочитанный байт остается в буфере и достается обработчику протокола
+	conn = &commnet.AddrConn{Conn: commnet.NewBufferedConn(conn, reader), Local: localAddr}
+
+	switch first[0] {
+	case 0x04, 0x05:
+		s.socks.ServeConn(conn)
+	default:
+		s.http.ServeConn(conn)
+	}
+}
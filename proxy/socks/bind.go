@@ -0,0 +1,78 @@
+package socks
+
+import (
+	"context"
+	"koria-core/app/dispatcher"
+	commnet "koria-core/common/net"
+	"log"
+	"net"
+	"time"
+)
+
+// bindTimeout сколько BIND ждет входящее соединение
+const bindTimeout = 2 * time.Minute
+
+// handleBind принимает входящее соединение от dest через outbound (BIND)
+// Первый ответ несет адрес, который надо сообщить dest, второй - адрес подключившегося
+func (s *Server) handleBind(ctx context.Context, conn net.Conn, dest commnet.Destination, reply replyFunc) {
+	log.Printf("[SOCKS5 Inbound:%s] BIND for %s from %s", s.tag, dest.String(), conn.RemoteAddr())
+
+	binder, ok := s.dispatcher.(dispatcher.Binder)
+	if !ok {
+		reply(0x07, nil) // Command not supported
+		return
+	}
+
+	listener, err := binder.Bind(ctx, dest)
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] Failed to bind: %v", s.tag, err)
+		reply(replyCode(err), nil)
+		return
+	}
+	defer listener.Close()
+
+	if err := reply(0x00, listener.Addr()); err != nil {
+		return
+	}
+
+	// Ожидание прерывается по таймауту или когда клиент закрывает соединение.
+	// До второго ответа клиент ничего не шлет, но прочитанный байт все равно не теряется
+	timer := time.AfterFunc(bindTimeout, func() { listener.Close() })
+	early := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, err := conn.Read(buf)
+		if err != nil {
+			listener.Close()
+		}
+		early <- buf[:n]
+	}()
+
+	peer, err := listener.Accept()
+	timer.Stop()
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] BIND for %s: no connection accepted", s.tag, dest.String())
+		reply(0x01, nil) // General failure
+		return
+	}
+	listener.Close()
+	defer peer.Close()
+
+	// Останавливаем чтение, чтобы данные клиента дальше шли в туннель
+	conn.SetReadDeadline(time.Now())
+	data := <-early
+	conn.SetReadDeadline(time.Time{})
+	if len(data) > 0 {
+		if _, err := peer.Write(data); err != nil {
+			return
+		}
+	}
+
+	if err := reply(0x00, peer.RemoteAddr()); err != nil {
+		return
+	}
+
+	log.Printf("[SOCKS5 Inbound:%s] BIND for %s accepted %s", s.tag, dest.String(), peer.RemoteAddr())
+
+	commnet.Relay(conn, peer)
+}
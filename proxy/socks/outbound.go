@@ -0,0 +1,224 @@
+package socks
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	commnet "koria-core/common/net"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// handshakeTimeout время на согласование с upstream SOCKS5 сервером
+const handshakeTimeout = 10 * time.Second
+
+// SOCKS5 аутентификация по логину и паролю (RFC 1929)
+const (
+	userPassAuth     = 0x02
+	noAcceptableAuth = 0xFF
+	userPassVersion  = 0x01
+)
+
+// replyMessages тексты кодов ответа SOCKS5 (RFC 1928)
+var replyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// Handler представляет SOCKS5 outbound (CONNECT через upstream SOCKS5 сервер)
+type Handler struct {
+	tag    string
+	server string
+	user   string
+	pass   string
+}
+
+// OutboundConfig конфигурация SOCKS5 outbound
+type OutboundConfig struct {
+	Address string // Адрес upstream сервера
+	Port    int    // Порт upstream сервера
+
+	// User и Pass логин и пароль (RFC 1929). Пустой User - без аутентификации
+	User string
+	Pass string
+}
+
+// NewHandler создает новый SOCKS5 outbound handler
+func NewHandler(tag string, cfg *OutboundConfig) (*Handler, error) {
+	if len(cfg.User) > 255 || len(cfg.Pass) > 255 {
+		return nil, fmt.Errorf("username and password must be at most 255 bytes")
+	}
+
+	return &Handler{
+		tag:    tag,
+		server: net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+		user:   cfg.User,
+		pass:   cfg.Pass,
+	}, nil
+}
+
+// Tag возвращает тег обработчика
+func (h *Handler) Tag() string {
+	return h.tag
+}
+
+// Dial создает соединение к назначению через upstream SOCKS5 сервер
+func (h *Handler) Dial(ctx context.Context, dest commnet.Destination) (net.Conn, error) {
+	if dest.Network != commnet.TCP {
+		return nil, fmt.Errorf("socks outbound supports only TCP, got %s", dest.Network)
+	}
+
+	log.Printf("[SOCKS5 Outbound:%s] Dialing %s via %s", h.tag, dest.String(), h.server)
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", h.server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial socks server %s: %w", h.server, err)
+	}
+
+	deadline := time.Now().Add(handshakeTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if err := h.connect(conn, dest); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks connect to %s: %w", dest.String(), err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	log.Printf("[SOCKS5 Outbound:%s] Connected to %s", h.tag, dest.String())
+	return conn, nil
+}
+
+// connect выполняет handshake, аутентификацию и CONNECT
+func (h *Handler) connect(conn net.Conn, dest commnet.Destination) error {
+	// Предлагаем только тот метод, который можем пройти
+	method := byte(noAuth)
+	if h.user != "" {
+		method = userPassAuth
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return fmt.Errorf("write greeting: %w", err)
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("read method: %w", err)
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("unsupported SOCKS version: %d", buf[0])
+	}
+	if buf[1] == noAcceptableAuth {
+		return fmt.Errorf("server rejected authentication method %d", method)
+	}
+	if buf[1] != method {
+		return fmt.Errorf("server chose unoffered method %d", buf[1])
+	}
+
+	if method == userPassAuth {
+		if err := h.authenticate(conn); err != nil {
+			return err
+		}
+	}
+
+	// Запрос CONNECT
+	request, err := appendAddress([]byte{socks5Version, connectCmd, 0x00}, dest.Address)
+	if err != nil {
+		return err
+	}
+	request = binary.BigEndian.AppendUint16(request, dest.Port)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("write request: %w", err)
+	}
+
+	// Ответ: VER REP RSV ATYP BND.ADDR BND.PORT
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read reply: %w", err)
+	}
+	if reply[1] != 0x00 {
+		// Класс ошибки upstream сервера передается дальше, например клиенту SOCKS5 inbound
+		class := commnet.ErrorGeneral
+		for c, code := range replyCodes {
+			if code == reply[1] {
+				class = c
+			}
+		}
+		if message, ok := replyMessages[reply[1]]; ok {
+			return &commnet.ClassError{Class: class, Err: fmt.Errorf("server replied: %s", message)}
+		}
+		return &commnet.ClassError{Class: class, Err: fmt.Errorf("server replied with code %d", reply[1])}
+	}
+
+	var addrLen int
+	switch reply[3] {
+	case ipv4Address:
+		addrLen = 4
+	case ipv6Address:
+		addrLen = 16
+	case domainAddress:
+		lenBuf := make([]byte, 1)
+		if _, err := io.ReadFull(conn, lenBuf); err != nil {
+			return fmt.Errorf("read bound address: %w", err)
+		}
+		addrLen = int(lenBuf[0])
+	default:
+		return fmt.Errorf("unsupported bound address type: %d", reply[3])
+	}
+
+	// Адрес и порт привязки не нужны, но их надо вычитать из потока
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("read bound address: %w", err)
+	}
+
+	return nil
+}
+
+// authenticate проходит аутентификацию по логину и паролю (RFC 1929)
+func (h *Handler) authenticate(conn net.Conn) error {
+	request := []byte{userPassVersion, byte(len(h.user))}
+	request = append(request, h.user...)
+	request = append(request, byte(len(h.pass)))
+	request = append(request, h.pass...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+
+	status := make([]byte, 2)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return fmt.Errorf("read auth status: %w", err)
+	}
+	if status[1] != 0x00 {
+		return fmt.Errorf("authentication failed")
+	}
+	return nil
+}
+
+// appendAddress добавляет ATYP и адрес в формате SOCKS5
+func appendAddress(b []byte, host string) ([]byte, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return append(append(b, ipv4Address), ip4...), nil
+		}
+		return append(append(b, ipv6Address), ip.To16()...), nil
+	}
+
+	// Длина домена ограничена одним байтом
+	if len(host) > 255 {
+		return nil, fmt.Errorf("domain name too long: %d bytes", len(host))
+	}
+	b = append(b, domainAddress, byte(len(host)))
+	return append(b, host...), nil
+}
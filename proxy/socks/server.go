@@ -2,15 +2,16 @@ package socks
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
 	"io"
-	commio "koria-core/common/io"
 	commnet "koria-core/common/net"
+	"koria-core/common/session"
 	"koria-core/app/dispatcher"
 	"log"
 	"net"
-	"sync"
+	"time"
 )
 
 // SOCKS5 constants
@@ -18,6 +19,8 @@ const (
 	socks5Version = 0x05
 	noAuth        = 0x00
 	connectCmd    = 0x01
+	bindCmd       = 0x02
+	udpAssociate  = 0x03
 	ipv4Address   = 0x01
 	domainAddress = 0x03
 	ipv6Address   = 0x04
@@ -27,18 +30,39 @@ const (
 type Server struct {
 	tag        string
 	listen     string
+	proxyHdr   bool              // соединения приходят от балансировщика с заголовком PROXY protocol
+	accounts   map[string]string // логин -> пароль, пусто - без аутентификации
 	listener   net.Listener
 	dispatcher dispatcher.Interface
 	ctx        context.Context
 	cancel     context.CancelFunc
 }
 
+// Config конфигурация SOCKS5 сервера
+type Config struct {
+	Listen string // Адрес для прослушивания (например, "127.0.0.1:1080")
+
+	// AcceptProxyProtocol ждет заголовок PROXY protocol v1/v2 в начале каждого соединения,
+	// адрес клиента для маршрутизации и логов берется из него
+	AcceptProxyProtocol bool
+
+	// Accounts логины и пароли (RFC 1929). Если заданы, клиенты без них получают отказ
+	Accounts map[string]string
+}
+
 // NewServer создает новый SOCKS5 сервер
 func NewServer(tag string, listen string, d dispatcher.Interface) *Server {
+	return NewServerWithConfig(tag, &Config{Listen: listen}, d)
+}
+
+// NewServerWithConfig создает новый SOCKS5 сервер с конфигурацией
+func NewServerWithConfig(tag string, cfg *Config, d dispatcher.Interface) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		tag:        tag,
-		listen:     listen,
+		listen:     cfg.Listen,
+		proxyHdr:   cfg.AcceptProxyProtocol,
+		accounts:   cfg.Accounts,
 		dispatcher: d,
 		ctx:        ctx,
 		cancel:     cancel,
@@ -102,153 +126,289 @@ func (s *Server) acceptLoop() {
 	}
 }
 
-// handleConnection обрабатывает одно SOCKS5 соединение
+// replyCodes коды ответа SOCKS5 для классов ошибок подключения (RFC 1928)
+var replyCodes = map[commnet.ErrorClass]byte{
+	commnet.ErrorGeneral:            0x01,
+	commnet.ErrorNotAllowed:         0x02,
+	commnet.ErrorNetworkUnreachable: 0x03,
+	commnet.ErrorHostUnreachable:    0x04,
+	commnet.ErrorConnectionRefused:  0x05,
+	commnet.ErrorTTLExpired:         0x06,
+}
+
+// replyCode возвращает код ответа SOCKS5 для ошибки подключения
+func replyCode(err error) byte {
+	if code, ok := replyCodes[commnet.ClassifyError(err)]; ok {
+		return code
+	}
+	return 0x01 // General failure
+}
+
+// replyFunc отправляет клиенту ответ с кодом SOCKS5 и адресом (nil - 0.0.0.0:0)
+// SOCKS4 переводит код в свой формат
+type replyFunc func(rep byte, addr net.Addr) error
+
+// ServeConn обслуживает соединение, принятое другим inbound (например, mixed)
+// Соединение закрывается по окончании
+func (s *Server) ServeConn(conn net.Conn) {
+	s.handleConnection(conn)
+}
+
+// handleConnection обрабатывает одно SOCKS соединение
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
+	// Локальный адрес до разбора PROXY protocol: на нем же открывается UDP relay
+	localAddr := conn.LocalAddr()
+
+	// За балансировщиком настоящий адрес клиента приходит в заголовке PROXY protocol
+	if s.proxyHdr {
+		conn.SetReadDeadline(time.Now().Add(commnet.ProxyHeaderTimeout))
+		proxied, err := commnet.ReadProxyHeader(conn)
+		if err != nil {
+			log.Printf("[SOCKS5 Inbound:%s] PROXY protocol header from %s rejected: %v", s.tag, conn.RemoteAddr(), err)
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		conn = proxied
+	}
+
+	// Версия протокола по первому байту: SOCKS4/4a или SOCKS5
+	version := make([]byte, 1)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return
+	}
+	switch version[0] {
+	case socks4Version:
+		s.handleSocks4(conn)
+		return
+	case socks5Version:
+	default:
+		log.Printf("[SOCKS5 Inbound:%s] Unsupported SOCKS version %d from %s", s.tag, version[0], conn.RemoteAddr())
+		return
+	}
+
 	// Handshake
-	if err := s.handshake(conn); err != nil {
-		log.Printf("[SOCKS5 Inbound:%s] Handshake failed: %v", s.tag, err)
+	user, err := s.handshake(conn)
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] Handshake from %s failed: %v", s.tag, conn.RemoteAddr(), err)
 		return
 	}
 
+	// Пользователь нужен маршрутизации, поэтому сведения о клиенте собираем после аутентификации
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: conn.RemoteAddr(), User: user})
+
 	// Read request
-	dest, err := s.readRequest(conn)
+	cmd, dest, err := s.readRequest(conn)
 	if err != nil {
 		log.Printf("[SOCKS5 Inbound:%s] Read request failed: %v", s.tag, err)
-		s.sendReply(conn, 0x01) // General failure
+		s.sendReply(conn, 0x01, nil) // General failure
 		return
 	}
 
-	log.Printf("[SOCKS5 Inbound:%s] CONNECT %s", s.tag, dest.String())
+	reply := func(rep byte, addr net.Addr) error {
+		return s.sendReply(conn, rep, addr)
+	}
+
+	switch cmd {
+	case udpAssociate:
+		s.handleUDPAssociate(ctx, conn, localAddr, user)
+	case bindCmd:
+		s.handleBind(ctx, conn, dest, reply)
+	default:
+		s.handleConnect(ctx, conn, dest, reply)
+	}
+}
+
+// handleConnect соединяется с dest через dispatcher и туннелирует данные (CONNECT)
+func (s *Server) handleConnect(ctx context.Context, conn net.Conn, dest commnet.Destination, reply replyFunc) {
+	if user := session.InboundFromContext(ctx).User; user != "" {
+		log.Printf("[SOCKS5 Inbound:%s] CONNECT %s from %s (user %s)", s.tag, dest.String(), conn.RemoteAddr(), user)
+	} else {
+		log.Printf("[SOCKS5 Inbound:%s] CONNECT %s from %s", s.tag, dest.String(), conn.RemoteAddr())
+	}
 
 	// Dispatch
-	outConn, err := s.dispatcher.Dispatch(s.ctx, dest)
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
 	if err != nil {
 		log.Printf("[SOCKS5 Inbound:%s] Failed to dispatch: %v", s.tag, err)
-		s.sendReply(conn, 0x04) // Host unreachable
+		reply(replyCode(err), nil)
 		return
 	}
 	defer outConn.Close()
 
-	// Send success reply
-	s.sendReply(conn, 0x00) // Success
+	// Send success reply с адресом, с которого outbound подключился к назначению
+	reply(0x00, outConn.LocalAddr()) // Success
 
 	log.Printf("[SOCKS5 Inbound:%s] Tunnel established to %s", s.tag, dest.String())
 
-	// Tunnel с оптимизированным копированием
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		commio.Copy(outConn, conn)
-		outConn.Close()
-	}()
-
-	go func() {
-		defer wg.Done()
-		commio.Copy(conn, outConn)
-		conn.Close()
-	}()
-
-	wg.Wait()
+	commnet.Relay(conn, outConn)
 	// Логируем только при debug
 	// log.Printf("[SOCKS5 Inbound:%s] Tunnel closed for %s", s.tag, dest.String())
 }
 
-// handshake выполняет SOCKS5 handshake
-func (s *Server) handshake(conn net.Conn) error {
-	// Read version and methods
-	buf := make([]byte, 2)
+// handshake выполняет SOCKS5 handshake и возвращает имя пользователя
+// Без настроенных аккаунтов выбирается метод без аутентификации, иначе только RFC 1929
+// Байт версии уже прочитан handleConnection
+func (s *Server) handshake(conn net.Conn) (string, error) {
+	// Read number of methods
+	buf := make([]byte, 1)
 	if _, err := io.ReadFull(conn, buf); err != nil {
-		return err
+		return "", err
 	}
 
-	version := buf[0]
-	nMethods := buf[1]
-
-	if version != socks5Version {
-		return fmt.Errorf("unsupported SOCKS version: %d", version)
-	}
+	nMethods := buf[0]
 
 	// Read methods
 	methods := make([]byte, nMethods)
 	if _, err := io.ReadFull(conn, methods); err != nil {
-		return err
+		return "", err
 	}
 
-	// Send no auth method
-	_, err := conn.Write([]byte{socks5Version, noAuth})
-	return err
+	if len(s.accounts) == 0 {
+		// Send no auth method
+		_, err := conn.Write([]byte{socks5Version, noAuth})
+		return "", err
+	}
+
+	offered := false
+	for _, method := range methods {
+		if method == userPassAuth {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socks5Version, noAcceptableAuth})
+		return "", fmt.Errorf("client does not offer username/password authentication")
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, userPassAuth}); err != nil {
+		return "", err
+	}
+	return s.authenticate(conn)
+}
+
+// authenticate проверяет логин и пароль клиента (RFC 1929)
+func (s *Server) authenticate(conn net.Conn) (string, error) {
+	// VER ULEN UNAME PLEN PASSWD
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != userPassVersion {
+		return "", fmt.Errorf("unsupported auth version: %d", header[0])
+	}
+
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return "", err
+	}
+
+	passLen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, passLen); err != nil {
+		return "", err
+	}
+	pass := make([]byte, passLen[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return "", err
+	}
+
+	expected, exists := s.accounts[string(user)]
+	if !exists || subtle.ConstantTimeCompare(pass, []byte(expected)) != 1 {
+		conn.Write([]byte{userPassVersion, 0x01})
+		return "", fmt.Errorf("invalid credentials for user %q", user)
+	}
+
+	if _, err := conn.Write([]byte{userPassVersion, 0x00}); err != nil {
+		return "", err
+	}
+	return string(user), nil
 }
 
-// readRequest читает SOCKS5 запрос
-func (s *Server) readRequest(conn net.Conn) (commnet.Destination, error) {
+// readRequest читает SOCKS5 запрос и возвращает команду и назначение
+func (s *Server) readRequest(conn net.Conn) (byte, commnet.Destination, error) {
 	// Read header
-	buf := make([]byte, 4)
+	buf := make([]byte, 3)
 	if _, err := io.ReadFull(conn, buf); err != nil {
-		return commnet.Destination{}, err
+		return 0, commnet.Destination{}, err
 	}
 
 	version := buf[0]
 	cmd := buf[1]
 	// reserved := buf[2]
-	addrType := buf[3]
 
 	if version != socks5Version {
-		return commnet.Destination{}, fmt.Errorf("unsupported version: %d", version)
+		return 0, commnet.Destination{}, fmt.Errorf("unsupported version: %d", version)
 	}
 
-	if cmd != connectCmd {
-		return commnet.Destination{}, fmt.Errorf("unsupported command: %d", cmd)
+	if cmd != connectCmd && cmd != bindCmd && cmd != udpAssociate {
+		return 0, commnet.Destination{}, fmt.Errorf("unsupported command: %d", cmd)
 	}
 
+	host, port, err := readAddress(conn)
+	if err != nil {
+		return 0, commnet.Destination{}, err
+	}
+
+	// Для UDP ASSOCIATE это адрес, с которого клиент будет слать датаграммы (часто нули)
+	if cmd == udpAssociate {
+		return cmd, commnet.UDPDestination(host, port), nil
+	}
+	return cmd, commnet.TCPDestination(host, port), nil
+}
+
+// readAddress читает ATYP, адрес и порт в формате SOCKS5
+func readAddress(r io.Reader) (string, uint16, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", 0, err
+	}
+	addrType := atyp[0]
+
 	var host string
 
 	switch addrType {
 	case ipv4Address:
 		addr := make([]byte, 4)
-		if _, err := io.ReadFull(conn, addr); err != nil {
-			return commnet.Destination{}, err
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return "", 0, err
 		}
 		host = net.IP(addr).String()
 
 	case domainAddress:
 		lenBuf := make([]byte, 1)
-		if _, err := io.ReadFull(conn, lenBuf); err != nil {
-			return commnet.Destination{}, err
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
+			return "", 0, err
 		}
 		domainLen := lenBuf[0]
 		domain := make([]byte, domainLen)
-		if _, err := io.ReadFull(conn, domain); err != nil {
-			return commnet.Destination{}, err
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", 0, err
 		}
 		host = string(domain)
 
 	case ipv6Address:
 		addr := make([]byte, 16)
-		if _, err := io.ReadFull(conn, addr); err != nil {
-			return commnet.Destination{}, err
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return "", 0, err
 		}
 		host = net.IP(addr).String()
 
 	default:
-		return commnet.Destination{}, fmt.Errorf("unsupported address type: %d", addrType)
+		return "", 0, fmt.Errorf("unsupported address type: %d", addrType)
 	}
 
 	// Read port
 	portBuf := make([]byte, 2)
-	if _, err := io.ReadFull(conn, portBuf); err != nil {
-		return commnet.Destination{}, err
+	if _, err := io.ReadFull(r, portBuf); err != nil {
+		return "", 0, err
 	}
-	port := binary.BigEndian.Uint16(portBuf)
-
-	return commnet.TCPDestination(host, port), nil
+	return host, binary.BigEndian.Uint16(portBuf), nil
 }
 
-// sendReply отправляет SOCKS5 ответ
-func (s *Server) sendReply(conn net.Conn, rep byte) error {
+// sendReply отправляет SOCKS5 ответ. Без bind адрес привязки 0.0.0.0:0
+func (s *Server) sendReply(conn net.Conn, rep byte, bind net.Addr) error {
 	// Version, Reply, Reserved, Address Type, BND.ADDR, BND.PORT
 	reply := []byte{
 		socks5Version,
@@ -258,6 +418,21 @@ func (s *Server) sendReply(conn net.Conn, rep byte) error {
 		0, 0, 0, 0, // 0.0.0.0
 		0, 0, // Port 0
 	}
+	if ip, port, ok := splitAddr(bind); ok {
+		reply, _ = appendAddress(reply[:3], ip.String())
+		reply = binary.BigEndian.AppendUint16(reply, port)
+	}
 	_, err := conn.Write(reply)
 	return err
 }
+
+// splitAddr возвращает IP и порт TCP или UDP адреса
+func splitAddr(addr net.Addr) (net.IP, uint16, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, uint16(a.Port), a.IP != nil
+	case *net.UDPAddr:
+		return a.IP, uint16(a.Port), a.IP != nil
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,120 @@
+package socks
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+)
+
+// SOCKS4 constants
+const (
+	socks4Version  = 0x04
+	socks4Granted  = 90
+	socks4Rejected = 91
+)
+
+// handleSocks4 обрабатывает запрос SOCKS4/4a (байт версии уже прочитан)
+// Запрос: CD DSTPORT DSTIP USERID 0x00, в 4a при DSTIP 0.0.0.x далее домен и 0x00
+func (s *Server) handleSocks4(conn net.Conn) {
+	reply := func(rep byte, addr net.Addr) error {
+		return sendSocks4Reply(conn, rep, addr)
+	}
+
+	cmd, dest, err := readSocks4Request(conn)
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] Read SOCKS4 request from %s failed: %v", s.tag, conn.RemoteAddr(), err)
+		reply(0x01, nil)
+		return
+	}
+
+	// В SOCKS4 нет паролей, а USERID ничем не подтвержден
+	if len(s.accounts) > 0 {
+		log.Printf("[SOCKS5 Inbound:%s] SOCKS4 from %s rejected: authentication required", s.tag, conn.RemoteAddr())
+		reply(0x02, nil)
+		return
+	}
+
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: conn.RemoteAddr()})
+
+	switch cmd {
+	case connectCmd:
+		s.handleConnect(ctx, conn, dest, reply)
+	case bindCmd:
+		s.handleBind(ctx, conn, dest, reply)
+	default:
+		log.Printf("[SOCKS5 Inbound:%s] Unsupported SOCKS4 command %d from %s", s.tag, cmd, conn.RemoteAddr())
+		reply(0x07, nil)
+	}
+}
+
+// readSocks4Request читает запрос SOCKS4/4a и возвращает команду и назначение
+func readSocks4Request(conn net.Conn) (byte, commnet.Destination, error) {
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, commnet.Destination{}, err
+	}
+
+	cmd := buf[0]
+	port := binary.BigEndian.Uint16(buf[1:3])
+	ip := net.IP(buf[3:7])
+
+	// USERID не используется, но его надо вычитать
+	if _, err := readNullTerminated(conn); err != nil {
+		return 0, commnet.Destination{}, fmt.Errorf("read user id: %w", err)
+	}
+
+	host := ip.String()
+
+	// SOCKS4a: адрес 0.0.0.x (x != 0) означает, что после USERID идет домен
+	if ip[0] == 0 && ip[1] == 0 && ip[2] == 0 && ip[3] != 0 {
+		domain, err := readNullTerminated(conn)
+		if err != nil {
+			return 0, commnet.Destination{}, fmt.Errorf("read domain: %w", err)
+		}
+		host = domain
+	}
+
+	return cmd, commnet.TCPDestination(host, port), nil
+}
+
+// readNullTerminated читает строку до 0x00 (не длиннее 255 байт)
+func readNullTerminated(r io.Reader) (string, error) {
+	var value []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == 0x00 {
+			return string(value), nil
+		}
+		if len(value) == 255 {
+			return "", fmt.Errorf("string too long")
+		}
+		value = append(value, b[0])
+	}
+}
+
+// sendSocks4Reply отправляет ответ SOCKS4: VN=0 CD DSTPORT DSTIP
+// Любой код SOCKS5, кроме успеха, становится отказом. Адрес передается только IPv4
+func sendSocks4Reply(conn net.Conn, rep byte, addr net.Addr) error {
+	reply := make([]byte, 8)
+	reply[1] = socks4Granted
+	if rep != 0x00 {
+		reply[1] = socks4Rejected
+	}
+
+	if ip, port, ok := splitAddr(addr); ok {
+		if ip4 := ip.To4(); ip4 != nil {
+			binary.BigEndian.PutUint16(reply[2:4], port)
+			copy(reply[4:], ip4)
+		}
+	}
+
+	_, err := conn.Write(reply)
+	return err
+}
@@ -0,0 +1,143 @@
+package socks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+)
+
+// udpAssociation UDP relay одного UDP ASSOCIATE, живет пока открыто управляющее TCP соединение
+type udpAssociation struct {
+	server   *Server
+	ctx      context.Context
+	relay    *net.UDPConn
+	clientIP net.IP
+	client   *net.UDPAddr // первый адрес, с которого пришла датаграмма
+
+	sessions *commnet.UDPSessionTable // по назначению
+}
+
+// handleUDPAssociate открывает UDP relay и пересылает датаграммы клиента через dispatcher
+func (s *Server) handleUDPAssociate(ctx context.Context, conn net.Conn, localAddr net.Addr, user string) {
+	inbound := session.InboundFromContext(ctx)
+	clientIP := inbound.SourceIP()
+
+	// Relay слушает на том же IP, на который клиент подключился по TCP
+	var relayIP net.IP
+	if tcpAddr, ok := localAddr.(*net.TCPAddr); ok {
+		relayIP = tcpAddr.IP
+	}
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: relayIP})
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] Failed to open UDP relay: %v", s.tag, err)
+		s.sendReply(conn, 0x01, nil) // General failure
+		return
+	}
+	defer relay.Close()
+
+	if user != "" {
+		log.Printf("[SOCKS5 Inbound:%s] UDP ASSOCIATE from %s (user %s), relay %s", s.tag, conn.RemoteAddr(), user, relay.LocalAddr())
+	} else {
+		log.Printf("[SOCKS5 Inbound:%s] UDP ASSOCIATE from %s, relay %s", s.tag, conn.RemoteAddr(), relay.LocalAddr())
+	}
+
+	if err := s.sendReply(conn, 0x00, relay.LocalAddr().(*net.UDPAddr)); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Ассоциация заканчивается вместе с управляющим соединением
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+		relay.Close()
+	}()
+
+	association := &udpAssociation{
+		server:   s,
+		ctx:      ctx,
+		relay:    relay,
+		clientIP: clientIP,
+		sessions: commnet.NewUDPSessionTable(),
+	}
+	association.readLoop()
+}
+
+// readLoop принимает датаграммы клиента и раскладывает их по сессиям
+func (a *udpAssociation) readLoop() {
+	buf := make([]byte, commnet.MaxPacketSize)
+	for {
+		n, from, err := a.relay.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		// Датаграммы принимаются только от клиента, открывшего ассоциацию
+		if a.clientIP != nil && !from.IP.Equal(a.clientIP) {
+			continue
+		}
+		if a.client == nil {
+			a.client = from
+		} else if from.Port != a.client.Port || !from.IP.Equal(a.client.IP) {
+			continue
+		}
+
+		dest, payload, ok := parseUDPRequest(buf[:n])
+		if !ok {
+			continue
+		}
+		a.send(dest, append([]byte(nil), payload...))
+	}
+}
+
+// parseUDPRequest разбирает заголовок датаграммы: RSV RSV FRAG ATYP DST.ADDR DST.PORT DATA
+// Фрагментированные датаграммы не поддерживаются и отбрасываются
+func parseUDPRequest(packet []byte) (commnet.Destination, []byte, bool) {
+	if len(packet) < 4 || packet[2] != 0x00 {
+		return commnet.Destination{}, nil, false
+	}
+
+	reader := bytes.NewReader(packet[3:])
+	host, port, err := readAddress(reader)
+	if err != nil {
+		return commnet.Destination{}, nil, false
+	}
+	return commnet.UDPDestination(host, port), packet[len(packet)-reader.Len():], true
+}
+
+// send ставит датаграмму в очередь сессии назначения, при необходимости создает сессию
+func (a *udpAssociation) send(dest commnet.Destination, payload []byte) {
+	a.sessions.Send(dest.NetAddr(), payload, func(sess *commnet.UDPSession) {
+		a.runSession(sess, dest)
+	})
+}
+
+// runSession соединяется с назначением и пересылает датаграммы до простоя или конца ассоциации
+// Ответы назначения уходят клиенту с SOCKS5 заголовком
+func (a *udpAssociation) runSession(sess *commnet.UDPSession, dest commnet.Destination) {
+	header, err := appendAddress([]byte{0x00, 0x00, 0x00}, dest.Address)
+	if err != nil {
+		return
+	}
+	header = binary.BigEndian.AppendUint16(header, dest.Port)
+
+	outConn, err := a.server.dispatcher.Dispatch(a.ctx, dest)
+	if err != nil {
+		log.Printf("[SOCKS5 Inbound:%s] Failed to dispatch UDP to %s: %v", a.server.tag, dest.String(), err)
+		return
+	}
+	defer outConn.Close()
+
+	sess.Relay(a.ctx, outConn, func(payload []byte) error {
+		packet := append(header[:len(header):len(header)], payload...)
+		_, err := a.relay.WriteToUDP(packet, a.client)
+		return err
+	})
+}
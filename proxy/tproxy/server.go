@@ -0,0 +1,206 @@
+package tproxy
+
+import (
+	"context"
+	"fmt"
+	"koria-core/app/dispatcher"
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+	"strconv"
+)
+
+// Режимы получения исходного адреса назначения
+const (
+	// ModeRedirect соединения перенаправлены iptables REDIRECT / nftables redirect,
+	// адрес назначения берется из conntrack (SO_ORIGINAL_DST). Только TCP
+	ModeRedirect = "redirect"
+
+	// ModeTProxy соединения перехвачены iptables/nftables TPROXY, сокет слушает с
+	// IP_TRANSPARENT и видит адрес назначения как свой локальный. TCP и UDP
+	ModeTProxy = "tproxy"
+)
+
+// Server прозрачный прокси для шлюза: принимает перехваченный трафик LAN и
+// отправляет его через dispatcher к исходному адресу назначения
+type Server struct {
+	tag        string
+	listen     string
+	mode       string
+	tcp        bool
+	udp        bool
+	listener   net.Listener
+	packetConn *net.UDPConn
+	dispatcher dispatcher.Interface
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// Config конфигурация прозрачного прокси
+type Config struct {
+	Listen string // Адрес для прослушивания (например, "0.0.0.0:12345")
+	Mode   string // ModeRedirect или ModeTProxy
+
+	// Network принимаемый трафик: "tcp", "udp" или "tcp,udp" (пусто = "tcp").
+	// UDP доступен только в режиме ModeTProxy
+	Network string
+}
+
+// NewServer создает новый прозрачный прокси
+func NewServer(tag string, cfg *Config, d dispatcher.Interface) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	tcp, udp := commnet.ParseNetworkList(cfg.Network)
+	return &Server{
+		tag:        tag,
+		listen:     cfg.Listen,
+		mode:       cfg.Mode,
+		tcp:        tcp,
+		udp:        udp,
+		dispatcher: d,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Tag возвращает тег сервера
+func (s *Server) Tag() string {
+	return s.tag
+}
+
+// Start запускает сервер
+func (s *Server) Start() error {
+	if s.udp && s.mode != ModeTProxy {
+		return fmt.Errorf("udp requires %s mode", ModeTProxy)
+	}
+
+	if s.tcp {
+		listener, err := listenTCP(s.listen, s.mode == ModeTProxy)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+		}
+		s.listener = listener
+		go s.acceptLoop()
+	}
+
+	if s.udp {
+		packetConn, err := listenUDP(s.listen)
+		if err != nil {
+			if s.listener != nil {
+				s.listener.Close()
+			}
+			return fmt.Errorf("failed to listen on udp %s: %w", s.listen, err)
+		}
+		s.packetConn = packetConn
+		go s.readPackets()
+	}
+
+	log.Printf("[TProxy Inbound:%s] Listening on %s (%s)", s.tag, s.listen, s.mode)
+	return nil
+}
+
+// Close закрывает сервер
+func (s *Server) Close() error {
+	s.cancel()
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// GetRandomInboundProxy возвращает адрес прокси (не используется для прозрачного прокси)
+func (s *Server) GetRandomInboundProxy() (*net.TCPAddr, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// acceptLoop принимает входящие соединения
+func (s *Server) acceptLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+				log.Printf("[TProxy Inbound:%s] Accept error: %v", s.tag, err)
+				continue
+			}
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection восстанавливает адрес назначения и туннелирует соединение к нему
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	var target *net.TCPAddr
+	var err error
+	if s.mode == ModeTProxy {
+		// TPROXY не меняет пакет: адрес назначения и есть локальный адрес сокета
+		target, _ = conn.LocalAddr().(*net.TCPAddr)
+	} else {
+		target, err = originalDst(conn)
+	}
+	if err != nil || target == nil {
+		log.Printf("[TProxy Inbound:%s] No original destination for %s: %v", s.tag, conn.RemoteAddr(), err)
+		return
+	}
+
+	// Соединение прямо на порт inbound'а не перехвачено, иначе оно ушло бы на самого себя
+	if s.isSelf(target.IP, target.Port, s.listener.Addr()) {
+		log.Printf("[TProxy Inbound:%s] Rejected direct connection from %s", s.tag, conn.RemoteAddr())
+		return
+	}
+
+	dest := commnet.TCPDestination(target.IP.String(), uint16(target.Port))
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: conn.RemoteAddr()})
+
+	log.Printf("[TProxy Inbound:%s] %s -> %s", s.tag, conn.RemoteAddr(), dest.String())
+
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		log.Printf("[TProxy Inbound:%s] Failed to dispatch to %s: %v", s.tag, dest.String(), err)
+		return
+	}
+	defer outConn.Close()
+
+	commnet.Relay(conn, outConn)
+}
+
+// isSelf проверяет, что адрес назначения - это адрес, который слушает inbound
+func (s *Server) isSelf(ip net.IP, port int, listenAddr net.Addr) bool {
+	host, portStr, err := net.SplitHostPort(listenAddr.String())
+	if err != nil || portStr != strconv.Itoa(port) {
+		return false
+	}
+	listenIP := net.ParseIP(host)
+	if listenIP == nil || listenIP.IsUnspecified() {
+		return ip.IsLoopback() || isLocalIP(ip)
+	}
+	return listenIP.Equal(ip)
+}
+
+// isLocalIP проверяет, назначен ли адрес одному из интерфейсов
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package tproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// Опции сокетов netfilter, которых нет в пакете syscall
+const (
+	soOriginalDst       = 80 // SO_ORIGINAL_DST, IP6T_SO_ORIGINAL_DST
+	ipv6Transparent     = 75 // IPV6_TRANSPARENT
+	ipv6RecvOrigDstAddr = 74 // IPV6_RECVORIGDSTADDR, он же IPV6_ORIGDSTADDR в cmsg
+)
+
+// listenTCP открывает TCP listener, для TPROXY - с IP_TRANSPARENT
+func listenTCP(address string, transparent bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if transparent {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			return setSockopts(c, network, transparentOpts)
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", address)
+}
+
+// listenUDP открывает UDP сокет TPROXY, который сообщает адрес назначения каждой датаграммы
+func listenUDP(address string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return setSockopts(c, network, transparentOpts, recvOrigDstOpts)
+		},
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// listenUDPFrom открывает UDP сокет на чужом адресе, чтобы отвечать клиенту от имени назначения
+// SO_REUSEADDR позволяет нескольким клиентам одновременно говорить с одним назначением
+func listenUDPFrom(addr *net.UDPAddr) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return setSockopts(c, network, transparentOpts, reuseAddrOpts)
+		},
+	}
+	network := "udp6"
+	if addr.IP.To4() != nil {
+		network = "udp4"
+	}
+	conn, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// sockopt опция сокета для IPv4 и IPv6 сокетов
+type sockopt struct {
+	level4, name4 int
+	level6, name6 int
+}
+
+var (
+	transparentOpts = sockopt{syscall.SOL_IP, syscall.IP_TRANSPARENT, syscall.SOL_IPV6, ipv6Transparent}
+	recvOrigDstOpts = sockopt{syscall.SOL_IP, syscall.IP_RECVORIGDSTADDR, syscall.SOL_IPV6, ipv6RecvOrigDstAddr}
+	reuseAddrOpts   = sockopt{syscall.SOL_SOCKET, syscall.SO_REUSEADDR, syscall.SOL_SOCKET, syscall.SO_REUSEADDR}
+)
+
+// setSockopts включает опции для семейства адресов сокета. На IPv6 сокете IPv4 вариант
+// включается дополнительно: dual-stack сокет принимает и IPv4 трафик
+func setSockopts(c syscall.RawConn, network string, opts ...sockopt) error {
+	ipv6 := network == "tcp6" || network == "udp6"
+
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		for _, opt := range opts {
+			if !ipv6 {
+				if sockErr = syscall.SetsockoptInt(int(fd), opt.level4, opt.name4, 1); sockErr != nil {
+					return
+				}
+				continue
+			}
+			if sockErr = syscall.SetsockoptInt(int(fd), opt.level6, opt.name6, 1); sockErr != nil {
+				return
+			}
+			if opt.level4 != opt.level6 {
+				// Не обязательна: сокет может быть только IPv6
+				syscall.SetsockoptInt(int(fd), opt.level4, opt.name4, 1)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("setsockopt: %w (transparent proxy needs CAP_NET_ADMIN)", sockErr)
+	}
+	return nil
+}
+
+// originalDst возвращает адрес назначения соединения до REDIRECT из conntrack
+func originalDst(conn net.Conn) (*net.TCPAddr, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, fmt.Errorf("not a TCP connection")
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ipv4 := true
+	if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok && remote.IP.To4() == nil {
+		ipv4 = false
+	}
+
+	var addr *net.TCPAddr
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv4 {
+			// sockaddr_in занимает первые 16 байт структуры ipv6_mreq
+			var mreq *syscall.IPv6Mreq
+			mreq, sockErr = syscall.GetsockoptIPv6Mreq(int(fd), syscall.SOL_IP, soOriginalDst)
+			if sockErr == nil {
+				raw := mreq.Multiaddr
+				addr = &net.TCPAddr{
+					IP:   net.IPv4(raw[4], raw[5], raw[6], raw[7]),
+					Port: int(binary.BigEndian.Uint16(raw[2:4])),
+				}
+			}
+			return
+		}
+
+		// sockaddr_in6 занимает начало структуры ip6_mtuinfo
+		var info *syscall.IPv6MTUInfo
+		info, sockErr = syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.SOL_IPV6, soOriginalDst)
+		if sockErr == nil {
+			port := (*[2]byte)(unsafe.Pointer(&info.Addr.Port))
+			addr = &net.TCPAddr{
+				IP:   net.IP(append([]byte(nil), info.Addr.Addr[:]...)),
+				Port: int(binary.BigEndian.Uint16(port[:])),
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, fmt.Errorf("getsockopt SO_ORIGINAL_DST: %w", sockErr)
+	}
+	return addr, nil
+}
+
+// readFromUDP читает датаграмму и адрес ее назначения из IP_ORIGDSTADDR
+// При ошибке разбора управляющих сообщений возвращается адрес клиента и ошибка
+func readFromUDP(conn *net.UDPConn, buf, oob []byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+	n, oobn, _, client, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return 0, client, nil, err
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.SOL_IP && msg.Header.Type == syscall.IP_ORIGDSTADDR && len(msg.Data) >= 8:
+			// sockaddr_in: family, port, addr
+			return n, client, &net.UDPAddr{
+				IP:   net.IPv4(msg.Data[4], msg.Data[5], msg.Data[6], msg.Data[7]),
+				Port: int(binary.BigEndian.Uint16(msg.Data[2:4])),
+			}, nil
+		case msg.Header.Level == syscall.SOL_IPV6 && msg.Header.Type == ipv6RecvOrigDstAddr && len(msg.Data) >= 24:
+			// sockaddr_in6: family, port, flowinfo, addr
+			return n, client, &net.UDPAddr{
+				IP:   net.IP(append([]byte(nil), msg.Data[8:24]...)),
+				Port: int(binary.BigEndian.Uint16(msg.Data[2:4])),
+			}, nil
+		}
+	}
+	return 0, client, nil, fmt.Errorf("no original destination in control message")
+}
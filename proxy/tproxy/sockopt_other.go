@@ -0,0 +1,31 @@
+//go:build !linux
+
+package tproxy
+
+import (
+	"errors"
+	"net"
+)
+
+// errUnsupported прозрачный прокси опирается на netfilter и есть только в Linux
+var errUnsupported = errors.New("transparent proxy is only supported on Linux")
+
+func listenTCP(address string, transparent bool) (net.Listener, error) {
+	return nil, errUnsupported
+}
+
+func listenUDP(address string) (*net.UDPConn, error) {
+	return nil, errUnsupported
+}
+
+func listenUDPFrom(addr *net.UDPAddr) (*net.UDPConn, error) {
+	return nil, errUnsupported
+}
+
+func originalDst(conn net.Conn) (*net.TCPAddr, error) {
+	return nil, errUnsupported
+}
+
+func readFromUDP(conn *net.UDPConn, buf, oob []byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+	return 0, nil, nil, errUnsupported
+}
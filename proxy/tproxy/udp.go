@@ -0,0 +1,70 @@
+package tproxy
+
+import (
+	commnet "koria-core/common/net"
+	"koria-core/common/session"
+	"log"
+	"net"
+)
+
+// readPackets принимает перехваченные датаграммы и раскладывает их по сессиям
+// (клиент, назначение). Ответы уходят клиенту с адреса назначения
+func (s *Server) readPackets() {
+	sessions := commnet.NewUDPSessionTable()
+
+	buf := make([]byte, commnet.MaxPacketSize)
+	oob := make([]byte, 1024)
+	for {
+		n, client, target, err := readFromUDP(s.packetConn, buf, oob)
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+			}
+			if client == nil {
+				log.Printf("[TProxy Inbound:%s] UDP read error: %v", s.tag, err)
+				return
+			}
+			continue
+		}
+
+		if s.isSelf(target.IP, target.Port, s.packetConn.LocalAddr()) {
+			continue
+		}
+
+		key := client.String() + ">" + target.String()
+		payload := append([]byte(nil), buf[:n]...)
+		sessions.Send(key, payload, func(sess *commnet.UDPSession) {
+			s.runUDPSession(sess, client, target)
+		})
+	}
+}
+
+// runUDPSession пересылает датаграммы сессии через dispatcher до простоя
+func (s *Server) runUDPSession(sess *commnet.UDPSession, client, target *net.UDPAddr) {
+	// Ответ должен прийти клиенту с адреса, на который он отправлял
+	reply, err := listenUDPFrom(target)
+	if err != nil {
+		log.Printf("[TProxy Inbound:%s] Failed to open reply socket on %s: %v", s.tag, target, err)
+		return
+	}
+	defer reply.Close()
+
+	dest := commnet.UDPDestination(target.IP.String(), uint16(target.Port))
+	ctx := session.ContextWithInbound(s.ctx, &session.Inbound{Tag: s.tag, Source: client})
+
+	log.Printf("[TProxy Inbound:%s] UDP %s -> %s", s.tag, client, dest.String())
+
+	outConn, err := s.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		log.Printf("[TProxy Inbound:%s] Failed to dispatch UDP to %s: %v", s.tag, dest.String(), err)
+		return
+	}
+	defer outConn.Close()
+
+	sess.Relay(s.ctx, outConn, func(payload []byte) error {
+		_, err := reply.WriteToUDP(payload, client)
+		return err
+	})
+}
@@ -0,0 +1,272 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBanDuration = 10 * time.Minute
+
+	// accessPruneInterval как часто удаляются устаревшие счетчики и баны
+	accessPruneInterval = time.Minute
+
+	// accessIdleTTL сколько хранится счетчик адреса без подключений
+	accessIdleTTL = 10 * time.Minute
+
+	// vanillaBanReason причина бана, которую vanilla пишет по умолчанию
+	vanillaBanReason = "Banned by an operator."
+)
+
+// AccessConfig ограничения доступа к Koria inbound по адресу источника
+type AccessConfig struct {
+	// Allow если не пусто, подключаться могут только эти сети
+	Allow []*net.IPNet
+	// Deny сети, которые всегда получают отказ как забаненные
+	Deny []*net.IPNet
+
+	// Rate новых соединений в секунду с одного адреса, Burst - запас (0 = без ограничения).
+	// Адрес IPv4 считается целиком, IPv6 - по сети /64
+	Rate  float64
+	Burst int
+
+	// BanAfter неудачных входов подряд до временного бана на BanDuration (0 = не банить)
+	BanAfter    int
+	BanDuration time.Duration
+}
+
+// ParseCIDRs разбирает список сетей, одиночный адрес считается сетью из одного адреса
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %w", err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// accessBan отказ забаненному адресу. Нулевой expires - бан бессрочный
+type accessBan struct {
+	expires time.Time
+}
+
+// banComponent chat component в порядке полей vanilla: translate, with, extra
+type banComponent struct {
+	Translate string         `json:"translate"`
+	With      []string       `json:"with"`
+	Extra     []banComponent `json:"extra,omitempty"`
+}
+
+// reason текст LoginDisconnect, как у vanilla при бане по IP
+func (b *accessBan) reason() string {
+	component := banComponent{
+		Translate: "multiplayer.disconnect.banned_ip.reason",
+		With:      []string{vanillaBanReason},
+	}
+	if !b.expires.IsZero() {
+		component.Extra = []banComponent{{
+			Translate: "multiplayer.disconnect.banned_ip.expiration",
+			With:      []string{b.expires.Format("2006-01-02 15:04:05 MST")},
+		}}
+	}
+
+	reason, _ := json.Marshal(component)
+	return string(reason)
+}
+
+// tokenBucket ведро токенов одного адреса
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// failureCount неудачные входы одного адреса
+type failureCount struct {
+	count int
+	last  time.Time
+}
+
+// accessControl применяет AccessConfig к новым соединениям
+type accessControl struct {
+	cfg AccessConfig
+
+	buckets  map[string]*tokenBucket
+	failures map[string]*failureCount
+	bans     map[string]time.Time
+	mu       sync.Mutex
+}
+
+func newAccessControl(cfg AccessConfig) *accessControl {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(cfg.Rate) + 1
+	}
+	if cfg.BanDuration <= 0 {
+		cfg.BanDuration = defaultBanDuration
+	}
+
+	return &accessControl{
+		cfg:      cfg,
+		buckets:  make(map[string]*tokenBucket),
+		failures: make(map[string]*failureCount),
+		bans:     make(map[string]time.Time),
+	}
+}
+
+// check решает судьбу нового соединения: ok = false - превышен лимит частоты,
+// ban != nil - адрес забанен или не пропущен списками
+func (a *accessControl) check(ip net.IP) (ban *accessBan, ok bool) {
+	if ip == nil {
+		return nil, true
+	}
+
+	if len(a.cfg.Allow) > 0 && !containsIP(a.cfg.Allow, ip) {
+		return &accessBan{}, true
+	}
+	if containsIP(a.cfg.Deny, ip) {
+		return &accessBan{}, true
+	}
+
+	key := accessKey(ip)
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if expires, banned := a.bans[key]; banned {
+		if now.Before(expires) {
+			return &accessBan{expires: expires}, true
+		}
+		delete(a.bans, key)
+	}
+
+	if a.cfg.Rate <= 0 {
+		return nil, true
+	}
+
+	bucket, exists := a.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(a.cfg.Burst), last: now}
+		a.buckets[key] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * a.cfg.Rate
+	if bucket.tokens > float64(a.cfg.Burst) {
+		bucket.tokens = float64(a.cfg.Burst)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return nil, false
+	}
+	bucket.tokens--
+	return nil, true
+}
+
+// recordFailure учитывает неудачный вход, после BanAfter подряд адрес банится
+func (a *accessControl) recordFailure(ip net.IP) {
+	if ip == nil || a.cfg.BanAfter <= 0 {
+		return
+	}
+
+	key := accessKey(ip)
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	failure, exists := a.failures[key]
+	if !exists || now.Sub(failure.last) > a.cfg.BanDuration {
+		failure = &failureCount{}
+		a.failures[key] = failure
+	}
+	failure.count++
+	failure.last = now
+
+	if failure.count >= a.cfg.BanAfter {
+		a.bans[key] = now.Add(a.cfg.BanDuration)
+		delete(a.failures, key)
+	}
+}
+
+// recordSuccess сбрасывает счетчик неудач после успешного входа
+func (a *accessControl) recordSuccess(ip net.IP) {
+	if ip == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, accessKey(ip))
+}
+
+// pruneLoop удаляет устаревшие записи до закрытия closeCh
+func (a *accessControl) pruneLoop(closeCh <-chan struct{}) {
+	ticker := time.NewTicker(accessPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closeCh:
+			return
+		case now := <-ticker.C:
+			a.prune(now)
+		}
+	}
+}
+
+func (a *accessControl) prune(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, bucket := range a.buckets {
+		if now.Sub(bucket.last) > accessIdleTTL {
+			delete(a.buckets, key)
+		}
+	}
+	for key, failure := range a.failures {
+		if now.Sub(failure.last) > a.cfg.BanDuration {
+			delete(a.failures, key)
+		}
+	}
+	for key, expires := range a.bans {
+		if now.After(expires) {
+			delete(a.bans, key)
+		}
+	}
+}
+
+// accessKey ключ адреса для лимитов: IPv4 целиком, IPv6 по сети /64
+func accessKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,8 +9,10 @@ import (
 	"koria-core/protocol/minecraft/packets/common"
 	s2c "koria-core/protocol/minecraft/packets/s2c"
 	"koria-core/protocol/multiplexer"
+	"koria-core/protocol/steganography"
 	"koria-core/stats"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -26,16 +28,58 @@ type ClientConfig struct {
 	ServerPort int       // Порт сервера
 	UserID     uuid.UUID // UUID пользователя для аутентификации
 	Flow       string    // Flow type (опционально)
+	Channels   []string  // Пул plugin-каналов (пусто = набор по умолчанию)
+
+	// CarrierMode стратегия выбора пакетов-носителей (пусто = adaptive)
+	CarrierMode steganography.SelectorMode
+
+	// Version версия Minecraft, за которую выдает себя клиент (nil = minecraft.DefaultProfile)
+	Version *minecraft.Profile
+
+	// Dialer устанавливает TCP соединение с сервером, например через другой outbound
+	// (SOCKS5 или HTTP прокси, еще один Koria сервер). nil - прямое соединение
+	Dialer DialFunc
+
+	// DialTimeout ограничивает TCP соединение, LoginTimeout - все остальное до начала
+	// трафика мультиплексора. 0 - значения по умолчанию (10 и 30 секунд)
+	DialTimeout  time.Duration
+	LoginTimeout time.Duration
 }
 
+// DialFunc устанавливает соединение с address ("host:port") по сети network
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
 // Dial подключается к серверу и выполняет Minecraft handshake с UUID аутентификацией
+// Отмена ctx прерывает подключение на любом этапе. Ошибки имеют тип *DialError с этапом,
+// на котором подключение не удалось
 func Dial(ctx context.Context, config *ClientConfig) (*Client, error) {
+	version := config.Version
+	if version == nil {
+		version = minecraft.DefaultProfile
+	}
+
+	dialTimeout := config.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	loginTimeout := config.LoginTimeout
+	if loginTimeout <= 0 {
+		loginTimeout = defaultClientLoginTimeout
+	}
+
 	// 1. Устанавливаем TCP соединение
-	addr := fmt.Sprintf("%s:%d", config.ServerAddr, config.ServerPort)
-	conn, err := net.Dial("tcp", addr)
+	dial := config.Dialer
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	addr := net.JoinHostPort(config.ServerAddr, strconv.Itoa(config.ServerPort))
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	conn, err := dial(dialCtx, "tcp", addr)
+	cancel()
 	if err != nil {
 		stats.Global().IncrementConnectionErrors()
-		return nil, fmt.Errorf("dial TCP: %w", err)
+		return nil, &DialError{Phase: DialPhaseTCP, Err: err}
 	}
 
 	// Оптимизируем TCP параметры для высокой производительности
@@ -47,23 +91,65 @@ func Dial(ctx context.Context, config *ClientConfig) (*Client, error) {
 		tcpConn.SetWriteBuffer(512 * 1024)              // 512KB write buffer
 	}
 
-	// 2. Выполняем Minecraft handshake
-	if err := performHandshake(conn, config); err != nil {
+	// Вход ограничен своим дедлайном и дедлайном ctx, отмена ctx прерывает чтение
+	deadline := time.Now().Add(loginTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	fail := func(phase DialPhase, err error) error {
+		stop()
 		conn.Close()
 		stats.Global().IncrementConnectionErrors()
-		return nil, fmt.Errorf("handshake: %w", err)
+		// Чтение прервано отменой ctx - причина в ней, а не в сети
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+		return &DialError{Phase: phase, Err: err}
+	}
+
+	// 2. Выполняем Minecraft handshake
+	if err := performHandshake(conn, config, version); err != nil {
+		return nil, fail(DialPhaseHandshake, err)
 	}
 
 	// 3. Выполняем login с UUID аутентификацией
-	if err := performLogin(conn, config.UserID); err != nil {
-		conn.Close()
+	if err := performLogin(conn, config.UserID, version); err != nil {
 		stats.Global().IncrementFailedConnections()
-		stats.Global().IncrementConnectionErrors()
-		return nil, fmt.Errorf("login: %w", err)
+		return nil, fail(DialPhaseLogin, err)
+	}
+
+	// Набор plugin-каналов выбирается один раз: его объявляют при входе и использует мультиплексор
+	channels := steganography.NewChannelRegistry(config.Channels)
+
+	// 4. Проходим фазу Configuration (1.20.2+)
+	if version.Configuration {
+		if err := performClientConfiguration(conn, version, channels); err != nil {
+			return nil, fail(DialPhaseConfiguration, err)
+		}
 	}
 
-	// 4. Создаем мультиплексор для управления виртуальными потоками
-	mux := multiplexer.NewMultiplexer(conn)
+	// 5. Проходим вход в мир до начала трафика мультиплексора
+	if err := performClientJoin(conn, version); err != nil {
+		return nil, fail(DialPhaseJoin, err)
+	}
+
+	// Вход завершен: дальше соединение живет независимо от ctx
+	if !stop() {
+		return nil, fail(DialPhaseJoin, ctx.Err())
+	}
+	conn.SetDeadline(time.Time{})
+
+	// 6. Создаем мультиплексор для управления виртуальными потоками
+	mux := multiplexer.NewMultiplexerWithConfig(conn, &multiplexer.Config{
+		ChannelRegistry: channels,
+		CarrierMode:     config.CarrierMode,
+		Version:         version,
+	})
 	stats.Global().IncrementConnections()
 
 	client := &Client{
@@ -80,6 +166,11 @@ func (c *Client) DialStream(ctx context.Context) (net.Conn, error) {
 	return c.mux.OpenStream(ctx)
 }
 
+// AcceptStream ждет поток, который открыл сервер (обратный поток для BIND)
+func (c *Client) AcceptStream() (net.Conn, error) {
+	return c.mux.AcceptStream()
+}
+
 // Close закрывает клиента и все виртуальные потоки
 func (c *Client) Close() error {
 	stats.Global().DecrementConnections()
@@ -92,9 +183,9 @@ func (c *Client) StreamCount() int {
 }
 
 // performHandshake выполняет Minecraft handshake фазу
-func performHandshake(conn net.Conn, config *ClientConfig) error {
+func performHandshake(conn net.Conn, config *ClientConfig, version *minecraft.Profile) error {
 	handshake := &common.HandshakePacket{
-		ProtocolVersion: 765, // Minecraft 1.20.4
+		ProtocolVersion: version.Protocol,
 		ServerAddress:   config.ServerAddr,
 		ServerPort:      uint16(config.ServerPort),
 		NextState:       2, // 2 = LOGIN state
@@ -108,7 +199,7 @@ func performHandshake(conn net.Conn, config *ClientConfig) error {
 }
 
 // performLogin выполняет login фазу с UUID аутентификацией
-func performLogin(conn net.Conn, userID uuid.UUID) error {
+func performLogin(conn net.Conn, userID uuid.UUID, version *minecraft.Profile) error {
 	// Username используем короткий (max 16 символов)
 	// UUID для аутентификации передается в отдельном поле
 	username := "koria"
@@ -118,27 +209,34 @@ func performLogin(conn net.Conn, userID uuid.UUID) error {
 		UUID:     userID,
 	}
 
-	if err := minecraft.WritePacket(conn, loginStart); err != nil {
+	if err := version.WritePacket(conn, minecraft.PhaseLogin, minecraft.Serverbound, loginStart); err != nil {
 		return fmt.Errorf("write login start packet: %w", err)
 	}
 
 	// Ждем ответ от сервера (LoginSuccess или LoginDisconnect)
-	packetID, data, err := minecraft.ReadPacketRaw(conn)
+	packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhaseLogin, minecraft.Clientbound)
 	if err != nil {
 		return fmt.Errorf("read login response: %w", err)
 	}
 
 	switch packetID {
 	case minecraft.PacketTypeLoginSuccess:
-		// Успешная аутентификация
+		// Успешная аутентификация, с 1.20.2 подтверждаем переход в Configuration
+		if !version.Configuration {
+			return nil
+		}
+		ack := &c2s.LoginAcknowledgedPacket{}
+		if err := version.WritePacket(conn, minecraft.PhaseLogin, minecraft.Serverbound, ack); err != nil {
+			return fmt.Errorf("write login acknowledged: %w", err)
+		}
 		return nil
 
-	case 0x00: // LOGIN_DISCONNECT
+	case minecraft.PacketTypeLoginDisconnect:
 		var disconnect s2c.LoginDisconnectPacket
-		if err := minecraft.DecodePacket(&disconnect, data); err != nil {
+		if err := version.DecodePacket(&disconnect, data); err != nil {
 			return fmt.Errorf("decode disconnect packet: %w", err)
 		}
-		return fmt.Errorf("login rejected: %s", disconnect.Reason)
+		return fmt.Errorf("%w: %s", ErrLoginRejected, disconnect.Reason)
 
 	default:
 		return fmt.Errorf("unexpected packet type: 0x%02X", packetID)
@@ -0,0 +1,449 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"koria-core/protocol/minecraft"
+	c2s "koria-core/protocol/minecraft/packets/c2s"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
+	"koria-core/protocol/steganography"
+	"math/rand"
+	"net"
+)
+
+const (
+	// serverBrand значение minecraft:brand, которое отправляет vanilla сервер
+	serverBrand = "vanilla"
+	// maxConfigPackets максимум пакетов, которые сторона читает в фазе Configuration
+	maxConfigPackets = 64
+)
+
+// performServerConfiguration проводит фазу Configuration (1.20.2+) на стороне сервера
+// Ждет Login Acknowledged, отправляет brand, feature flags, реестры и теги,
+// затем ждет подтверждение Finish Configuration и переходит в Play
+func performServerConfiguration(conn net.Conn, version *minecraft.Profile) error {
+	// Клиент подтверждает LoginSuccess и переходит в Configuration
+	packetID, _, err := version.ReadPacketRaw(conn, minecraft.PhaseLogin, minecraft.Serverbound)
+	if err != nil {
+		return fmt.Errorf("read login acknowledged: %w", err)
+	}
+	if packetID != minecraft.PacketTypeLoginAcknowledged {
+		return fmt.Errorf("unexpected packet in %s phase: 0x%02X", minecraft.PhaseLogin, packetID)
+	}
+
+	var brand bytes.Buffer
+	if err := minecraft.WriteString(&brand, serverBrand, 32767); err != nil {
+		return fmt.Errorf("encode brand: %w", err)
+	}
+
+	packets := []minecraft.Packet{
+		&s2c.ConfigPluginMessagePacket{Channel: "minecraft:brand", Data: brand.Bytes()},
+		&s2c.FeatureFlagsPacket{Flags: []string{"minecraft:vanilla"}},
+	}
+
+	if version.KnownPacks {
+		// С 1.20.5 сервер сначала выясняет, какие пакеты данных есть у клиента
+		corePack := s2c.KnownPack{Namespace: "minecraft", ID: "core", Version: version.Name}
+		packets = append(packets, &s2c.KnownPacksPacket{Packs: []s2c.KnownPack{corePack}})
+		if err := writeConfigurationPackets(conn, version, packets); err != nil {
+			return err
+		}
+
+		clientKnowsCore, err := readClientKnownPacks(conn, version, corePack)
+		if err != nil {
+			return err
+		}
+		packets = registryPackets(clientKnowsCore)
+	} else {
+		packets = append(packets, &s2c.RegistryDataPacket{Codec: registryCodec()})
+	}
+
+	packets = append(packets,
+		&s2c.UpdateTagsPacket{Groups: defaultTags()},
+		&s2c.FinishConfigurationPacket{},
+	)
+	if err := writeConfigurationPackets(conn, version, packets); err != nil {
+		return err
+	}
+
+	// Client Information и plugin-сообщения клиента пропускаем до подтверждения
+	for i := 0; i < maxConfigPackets; i++ {
+		packetID, _, err := version.ReadPacketRaw(conn, minecraft.PhaseConfiguration, minecraft.Serverbound)
+		if err != nil {
+			return fmt.Errorf("read configuration response: %w", err)
+		}
+		if packetID == minecraft.PacketTypeAcknowledgeFinishConfig {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no finish configuration acknowledgement after %d packets", maxConfigPackets)
+}
+
+// writeConfigurationPackets отправляет пакеты фазы Configuration одним сегментом
+func writeConfigurationPackets(conn net.Conn, version *minecraft.Profile, packets []minecraft.Packet) error {
+	writer := bufio.NewWriter(conn)
+	for _, packet := range packets {
+		if err := version.WritePacket(writer, minecraft.PhaseConfiguration, minecraft.Clientbound, packet); err != nil {
+			return fmt.Errorf("write configuration packet 0x%02X: %w", packet.PacketID(), err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("flush configuration packets: %w", err)
+	}
+	return nil
+}
+
+// readClientKnownPacks ждет ответ клиента на Known Packs
+// Возвращает true, если у клиента есть пакет данных core той же версии
+func readClientKnownPacks(conn net.Conn, version *minecraft.Profile, corePack s2c.KnownPack) (bool, error) {
+	for i := 0; i < maxConfigPackets; i++ {
+		packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhaseConfiguration, minecraft.Serverbound)
+		if err != nil {
+			return false, fmt.Errorf("read known packs: %w", err)
+		}
+		if packetID != minecraft.PacketTypeKnownPacksC2S {
+			continue
+		}
+
+		var known c2s.KnownPacksPacket
+		if err := version.DecodePacket(&known, data); err != nil {
+			return false, fmt.Errorf("decode known packs: %w", err)
+		}
+		for _, pack := range known.Packs {
+			if pack.Namespace == corePack.Namespace && pack.ID == corePack.ID && pack.Version == corePack.Version {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("no known packs response after %d packets", maxConfigPackets)
+}
+
+// performClientConfiguration проводит фазу Configuration на стороне клиента
+// Вызывается после отправки Login Acknowledged. Как клиент с модами, объявляет brand
+// и plugin-каналы сессии здесь, а не в фазе Play
+func performClientConfiguration(conn net.Conn, version *minecraft.Profile, channels *steganography.ChannelRegistry) error {
+	packets := []minecraft.Packet{
+		&c2s.ConfigPluginMessagePacket{CustomPayloadPacket: c2s.CustomPayloadPacket{
+			Channel: steganography.ChannelBrand,
+			Data:    channels.BrandPayload(),
+		}},
+		&c2s.ConfigClientInformationPacket{ClientInformationPacket: clientInformation()},
+		&c2s.ConfigPluginMessagePacket{CustomPayloadPacket: c2s.CustomPayloadPacket{
+			Channel: steganography.ChannelRegister,
+			Data:    channels.RegisterPayload(),
+		}},
+	}
+	writer := bufio.NewWriter(conn)
+	for _, packet := range packets {
+		if err := version.WritePacket(writer, minecraft.PhaseConfiguration, minecraft.Serverbound, packet); err != nil {
+			return fmt.Errorf("write configuration packet 0x%02X: %w", packet.PacketID(), err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("flush configuration packets: %w", err)
+	}
+
+	for i := 0; i < maxConfigPackets; i++ {
+		packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhaseConfiguration, minecraft.Clientbound)
+		if err != nil {
+			return fmt.Errorf("read configuration packet: %w", err)
+		}
+
+		var response minecraft.Packet
+
+		switch packetID {
+		case minecraft.PacketTypeKnownPacksS2C:
+			// Vanilla клиент знает встроенные пакеты данных своей версии
+			var known s2c.KnownPacksPacket
+			if err := version.DecodePacket(&known, data); err != nil {
+				return fmt.Errorf("decode known packs: %w", err)
+			}
+			reply := &c2s.KnownPacksPacket{}
+			for _, pack := range known.Packs {
+				if pack.Namespace == "minecraft" && pack.Version == version.Name {
+					reply.Packs = append(reply.Packs, c2s.KnownPack{Namespace: pack.Namespace, ID: pack.ID, Version: pack.Version})
+				}
+			}
+			response = reply
+
+		case minecraft.PacketTypeConfigKeepAliveS2C:
+			var keepAlive s2c.ConfigKeepAlivePacket
+			if err := version.DecodePacket(&keepAlive, data); err != nil {
+				return fmt.Errorf("decode keep alive: %w", err)
+			}
+			response = &c2s.ConfigKeepAlivePacket{ID: keepAlive.ID}
+
+		case minecraft.PacketTypeConfigPing:
+			var ping s2c.ConfigPingPacket
+			if err := version.DecodePacket(&ping, data); err != nil {
+				return fmt.Errorf("decode ping: %w", err)
+			}
+			response = &c2s.ConfigPongPacket{ID: ping.ID}
+
+		case minecraft.PacketTypeConfigDisconnect:
+			return fmt.Errorf("disconnected in %s phase", minecraft.PhaseConfiguration)
+
+		case minecraft.PacketTypeFinishConfiguration:
+			ack := &c2s.AcknowledgeFinishConfigurationPacket{}
+			if err := version.WritePacket(conn, minecraft.PhaseConfiguration, minecraft.Serverbound, ack); err != nil {
+				return fmt.Errorf("write finish configuration: %w", err)
+			}
+			return nil
+		}
+
+		if response != nil {
+			if err := version.WritePacket(conn, minecraft.PhaseConfiguration, minecraft.Serverbound, response); err != nil {
+				return fmt.Errorf("write configuration response 0x%02X: %w", response.PacketID(), err)
+			}
+		}
+	}
+
+	return fmt.Errorf("no finish configuration after %d packets", maxConfigPackets)
+}
+
+// clientInformation возвращает настройки, которые отправляет vanilla клиент
+func clientInformation() c2s.ClientInformationPacket {
+	return c2s.ClientInformationPacket{
+		Locale:              "en_us",
+		ViewDistance:        int8(8 + rand.Intn(5)),
+		ChatColors:          true,
+		DisplayedSkinParts:  0x7F,
+		MainHand:            1,
+		AllowServerListings: true,
+	}
+}
+
+// defaultTags теги жидкостей, как в vanilla реестре minecraft:fluid
+// ID: 1 flowing_water, 2 water, 3 flowing_lava, 4 lava
+func defaultTags() []s2c.TagGroup {
+	return []s2c.TagGroup{
+		{
+			Registry: "minecraft:fluid",
+			Tags: []s2c.Tag{
+				{Name: "minecraft:water", Entries: []int32{2, 1}},
+				{Name: "minecraft:lava", Entries: []int32{4, 3}},
+			},
+		},
+	}
+}
+
+// registryDefinition реестр и его элементы в порядке ID
+type registryDefinition struct {
+	id      string
+	entries []registryEntry
+}
+
+// registries реестры, которые сервер отправляет клиенту при входе
+// ID элементов определяются порядком в списке; биом 0 (plains) используется в чанках
+func registries() []registryDefinition {
+	return []registryDefinition{
+		{"minecraft:dimension_type", []registryEntry{
+			{"minecraft:overworld", dimensionType(false, false, true, "minecraft:overworld", "overworld", 1.0)},
+			{"minecraft:overworld_caves", dimensionType(false, true, true, "minecraft:overworld", "overworld", 1.0)},
+			{"minecraft:the_end", dimensionType(false, false, false, "minecraft:the_end", "end", 1.0)},
+			{"minecraft:the_nether", dimensionType(true, true, false, "minecraft:the_nether", "nether", 8.0)},
+		}},
+		{"minecraft:worldgen/biome", []registryEntry{
+			{"minecraft:plains", biome(true, 0.8, 0.4, 7907327, 4159204)},
+			{"minecraft:desert", biome(false, 2.0, 0.0, 7254527, 4159204)},
+			{"minecraft:forest", biome(true, 0.7, 0.8, 7972607, 4159204)},
+			{"minecraft:ocean", biome(true, 0.5, 0.5, 8103167, 4159204)},
+			{"minecraft:river", biome(true, 0.5, 0.5, 8103167, 4159204)},
+			{"minecraft:nether_wastes", biome(false, 2.0, 0.0, 7254527, 4159204)},
+			{"minecraft:the_end", biome(false, 0.5, 0.5, 0, 4159204)},
+			{"minecraft:the_void", biome(false, 0.5, 0.5, 8103167, 4159204)},
+		}},
+		{"minecraft:chat_type", []registryEntry{
+			{"minecraft:chat", chatType("chat.type.text", "chat.type.text.narrate")},
+			{"minecraft:emote_command", chatType("chat.type.emote", "chat.type.emote")},
+			{"minecraft:msg_command_incoming", chatType("commands.message.display.incoming", "chat.type.text.narrate")},
+			{"minecraft:msg_command_outgoing", chatType("commands.message.display.outgoing", "chat.type.text.narrate")},
+			{"minecraft:say_command", chatType("chat.type.announcement", "chat.type.text.narrate")},
+			{"minecraft:team_msg_command_incoming", chatType("chat.type.team.text", "chat.type.text.narrate")},
+			{"minecraft:team_msg_command_outgoing", chatType("chat.type.team.sent", "chat.type.text.narrate")},
+		}},
+		{"minecraft:damage_type", damageTypes()},
+	}
+}
+
+// registryCodec собирает реестры в один NBT тег (Registry Data до 1.20.5, Login (Play) до 1.20.2)
+func registryCodec() minecraft.NBTCompound {
+	var codec minecraft.NBTCompound
+	for _, def := range registries() {
+		codec = append(codec, minecraft.NBTField{Name: def.id, Value: registry(def.id, def.entries)})
+	}
+	return codec
+}
+
+// registryPackets собирает Registry Data 1.20.5+, по пакету на реестр
+// Если у клиента есть пакет данных minecraft:core, данные элементов не передаются
+func registryPackets(clientKnowsCore bool) []minecraft.Packet {
+	var packets []minecraft.Packet
+	for _, def := range registries() {
+		packet := &s2c.RegistryEntriesPacket{Registry: def.id}
+		for _, entry := range def.entries {
+			registryEntry := s2c.RegistryEntry{ID: entry.name}
+			if !clientKnowsCore {
+				registryEntry.Data = entry.element
+			}
+			packet.Entries = append(packet.Entries, registryEntry)
+		}
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// registryEntry элемент реестра с именем
+type registryEntry struct {
+	name    string
+	element minecraft.NBTCompound
+}
+
+// registry кодирует реестр в формате {type, value: [{name, id, element}]}
+func registry(registryType string, entries []registryEntry) minecraft.NBTCompound {
+	values := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		values[i] = minecraft.NBTCompound{
+			{Name: "name", Value: entry.name},
+			{Name: "id", Value: int32(i)},
+			{Name: "element", Value: entry.element},
+		}
+	}
+
+	return minecraft.NBTCompound{
+		{Name: "type", Value: registryType},
+		{Name: "value", Value: minecraft.NBTList{ElemType: minecraft.TagCompound, Elems: values}},
+	}
+}
+
+// dimensionType описывает тип измерения
+func dimensionType(ultrawarm, hasCeiling, hasSkylight bool, effects, infiniburn string, coordinateScale float64) minecraft.NBTCompound {
+	natural := effects == "minecraft:overworld"
+	return minecraft.NBTCompound{
+		{Name: "piglin_safe", Value: ultrawarm},
+		{Name: "has_raids", Value: natural},
+		{Name: "monster_spawn_light_level", Value: int32(0)},
+		{Name: "monster_spawn_block_light_limit", Value: int32(0)},
+		{Name: "natural", Value: natural},
+		{Name: "ambient_light", Value: float32(0)},
+		{Name: "infiniburn", Value: "#minecraft:infiniburn_" + infiniburn},
+		{Name: "respawn_anchor_works", Value: ultrawarm},
+		{Name: "has_skylight", Value: hasSkylight},
+		{Name: "bed_works", Value: natural},
+		{Name: "effects", Value: effects},
+		{Name: "min_y", Value: int32(-64)},
+		{Name: "height", Value: int32(384)},
+		{Name: "logical_height", Value: int32(384)},
+		{Name: "coordinate_scale", Value: coordinateScale},
+		{Name: "ultrawarm", Value: ultrawarm},
+		{Name: "has_ceiling", Value: hasCeiling},
+	}
+}
+
+// biome описывает биом с цветами неба и воды
+func biome(precipitation bool, temperature, downfall float32, skyColor, waterColor int32) minecraft.NBTCompound {
+	return minecraft.NBTCompound{
+		{Name: "has_precipitation", Value: precipitation},
+		{Name: "temperature", Value: temperature},
+		{Name: "downfall", Value: downfall},
+		{Name: "effects", Value: minecraft.NBTCompound{
+			{Name: "fog_color", Value: int32(12638463)},
+			{Name: "water_color", Value: waterColor},
+			{Name: "water_fog_color", Value: int32(329011)},
+			{Name: "sky_color", Value: skyColor},
+			{Name: "mood_sound", Value: minecraft.NBTCompound{
+				{Name: "sound", Value: "minecraft:ambient.cave"},
+				{Name: "tick_delay", Value: int32(6000)},
+				{Name: "block_search_extent", Value: int32(8)},
+				{Name: "offset", Value: float64(2)},
+			}},
+		}},
+	}
+}
+
+// chatType описывает формат сообщений чата
+func chatType(chatKey, narrationKey string) minecraft.NBTCompound {
+	parameters := minecraft.NBTList{ElemType: minecraft.TagString, Elems: []interface{}{"sender", "content"}}
+	return minecraft.NBTCompound{
+		{Name: "chat", Value: minecraft.NBTCompound{
+			{Name: "translation_key", Value: chatKey},
+			{Name: "parameters", Value: parameters},
+		}},
+		{Name: "narration", Value: minecraft.NBTCompound{
+			{Name: "translation_key", Value: narrationKey},
+			{Name: "parameters", Value: parameters},
+		}},
+	}
+}
+
+// damageTypes собирает реестр типов урона vanilla 1.20.4
+func damageTypes() []registryEntry {
+	types := []struct {
+		name       string
+		messageID  string
+		exhaustion float32
+	}{
+		{"arrow", "arrow", 0.1},
+		{"bad_respawn_point", "badRespawnPoint", 0.1},
+		{"cactus", "cactus", 0.1},
+		{"cramming", "cramming", 0},
+		{"dragon_breath", "dragonBreath", 0},
+		{"drown", "drown", 0},
+		{"dry_out", "dryout", 0.1},
+		{"explosion", "explosion", 0.1},
+		{"fall", "fall", 0},
+		{"falling_anvil", "anvil", 0.1},
+		{"falling_block", "fallingBlock", 0.1},
+		{"falling_stalactite", "fallingStalactite", 0.1},
+		{"fireball", "fireball", 0.1},
+		{"fireworks", "fireworks", 0.1},
+		{"fly_into_wall", "flyIntoWall", 0},
+		{"freeze", "freeze", 0},
+		{"generic", "generic", 0},
+		{"generic_kill", "genericKill", 0},
+		{"hot_floor", "hotFloor", 0.1},
+		{"in_fire", "inFire", 0.1},
+		{"in_wall", "inWall", 0},
+		{"indirect_magic", "indirectMagic", 0},
+		{"lava", "lava", 0.1},
+		{"lightning_bolt", "lightningBolt", 0.1},
+		{"magic", "magic", 0},
+		{"mob_attack", "mob", 0.1},
+		{"mob_attack_no_aggro", "mob", 0.1},
+		{"mob_projectile", "mob", 0.1},
+		{"on_fire", "onFire", 0},
+		{"out_of_world", "outOfWorld", 0},
+		{"outside_border", "outsideBorder", 0},
+		{"player_attack", "player", 0.1},
+		{"player_explosion", "explosion.player", 0.1},
+		{"sonic_boom", "sonic_boom", 0},
+		{"stalagmite", "stalagmite", 0},
+		{"starve", "starve", 0},
+		{"sting", "sting", 0.1},
+		{"sweet_berry_bush", "sweetBerryBush", 0.1},
+		{"thorns", "thorns", 0.1},
+		{"thrown", "thrown", 0.1},
+		{"trident", "trident", 0.1},
+		{"unattributed_fireball", "onFire", 0.1},
+		{"wither", "wither", 0},
+		{"wither_skull", "witherSkull", 0.1},
+	}
+
+	entries := make([]registryEntry, len(types))
+	for i, t := range types {
+		entries[i] = registryEntry{
+			name: "minecraft:" + t.name,
+			element: minecraft.NBTCompound{
+				{Name: "message_id", Value: t.messageID},
+				{Name: "scaling", Value: "when_caused_by_living_non_player"},
+				{Name: "exhaustion", Value: t.exhaustion},
+			},
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// defaultDialTimeout время на TCP соединение с сервером
+	defaultDialTimeout = 10 * time.Second
+
+	// defaultClientLoginTimeout время от Handshake до начала трафика мультиплексора,
+	// столько же дает клиенту сервер (defaultLoginTimeout)
+	defaultClientLoginTimeout = 30 * time.Second
+)
+
+// DialPhase этап подключения клиента к серверу
+type DialPhase string
+
+const (
+	DialPhaseTCP           DialPhase = "tcp"           // TCP соединение (в том числе через dialer)
+	DialPhaseHandshake     DialPhase = "handshake"     // Handshake пакет
+	DialPhaseLogin         DialPhase = "login"         // LoginStart и ответ сервера
+	DialPhaseConfiguration DialPhase = "configuration" // Фаза Configuration (1.20.2+)
+	DialPhaseJoin          DialPhase = "join"          // Вход в мир до начала трафика
+)
+
+// ErrLoginRejected сервер ответил LoginDisconnect: UUID не принят или версия не подходит.
+// Повтор с теми же настройками не поможет
+var ErrLoginRejected = errors.New("login rejected")
+
+// DialError ошибка подключения с этапом, на котором она произошла
+type DialError struct {
+	Phase DialPhase
+	Err   error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout true, если этап не уложился в дедлайн (свой или контекста)
+func (e *DialError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// Retryable true, если подключение имеет смысл повторить: сетевые ошибки и таймауты.
+// Отказ сервера и отмена контекста вызывающим повтором не исправляются
+func (e *DialError) Retryable() bool {
+	return !errors.Is(e.Err, ErrLoginRejected) && !errors.Is(e.Err, context.Canceled)
+}
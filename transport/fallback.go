@@ -0,0 +1,48 @@
+package transport
+
+import (
+	commnet "koria-core/common/net"
+	"log"
+	"net"
+	"time"
+)
+
+// fallbackDialTimeout время на подключение к fallback серверу
+const fallbackDialTimeout = 5 * time.Second
+
+// spliceToFallback передает соединение настоящему Minecraft серверу
+// Сначала отправляет уже прочитанные байты (handshake, login), затем связывает
+// соединения в обе стороны до закрытия. Перед этим выключает запись и вызывает release:
+// соединение больше не ждет аутентификации. Возвращает false, если fallback не задан
+func (s *Server) spliceToFallback(recorder *commnet.RecordingConn, release func()) bool {
+	if s.fallback == "" {
+		return false
+	}
+
+	recorded := recorder.Recorded()
+	recorder.StopRecording()
+
+	// Дальше работаем с самим соединением: ни запись, ни дедлайны фаз и таймаут чтения
+	// hardened режима не нужны, настоящий сервер сам следит за таймаутами
+	conn := recorder.Conn
+
+	upstream, err := net.DialTimeout("tcp", s.fallback, fallbackDialTimeout)
+	if err != nil {
+		log.Printf("Fallback %s unavailable for %s: %v", s.fallback, conn.RemoteAddr(), err)
+		return true
+	}
+	defer upstream.Close()
+
+	conn.SetDeadline(time.Time{})
+
+	if len(recorded) > 0 {
+		if _, err := upstream.Write(recorded); err != nil {
+			log.Printf("Fallback %s write failed: %v", s.fallback, err)
+			return true
+		}
+	}
+
+	release()
+	commnet.Relay(conn, upstream)
+	return true
+}
@@ -0,0 +1,184 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"koria-core/protocol/minecraft"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Поведение vanilla 1.20.4, которое повторяет сервер в hardened режиме
+const (
+	// vanillaReadTimeout ReadTimeoutHandler vanilla: 30 секунд без данных - соединение закрывается молча.
+	// В hardened режиме так ограничено каждое чтение до входа, это же дедлайн Handshake по умолчанию
+	vanillaReadTimeout = 30 * time.Second
+
+	// vanillaOutdatedWait vanilla отказывает другой версии сразу после Handshake, не читая
+	// LoginStart. Свой клиент присылает LoginStart вместе с Handshake, поэтому его ждем недолго
+	vanillaOutdatedWait = time.Second
+
+	// vanillaMaxNameLength длина ника в символах UTF-16, буфер строки - втрое больше в байтах
+	vanillaMaxNameLength = 16
+)
+
+// readTimeoutConn повторяет ReadTimeoutHandler vanilla: каждое чтение ждет данных не дольше
+// timeout. Дедлайн фазы, выставленный через SetReadDeadline или SetDeadline, продолжает
+// действовать: чтение прерывается по тому, что наступит раньше
+type readTimeoutConn struct {
+	net.Conn
+	timeout  time.Duration
+	deadline time.Time // Дедлайн фазы, нулевой - без него
+}
+
+func newReadTimeoutConn(conn net.Conn, timeout time.Duration) *readTimeoutConn {
+	return &readTimeoutConn{Conn: conn, timeout: timeout}
+}
+
+// Read перевзводит таймаут перед каждым чтением
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	deadline := time.Now().Add(c.timeout)
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// SetDeadline выставляет дедлайн фазы для чтения и записи
+func (c *readTimeoutConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline выставляет дедлайн фазы для чтения
+func (c *readTimeoutConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// vanillaError отказ, который vanilla сервер отправляет клиенту в LoginDisconnect
+type vanillaError struct {
+	Reason string // JSON chat component
+	Err    error
+}
+
+func (e *vanillaError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *vanillaError) Unwrap() error {
+	return e.Err
+}
+
+// vanillaInternalException текст, которым vanilla отвечает на исключение при разборе пакета
+// Gson в vanilla не экранирует HTML символы, поэтому "(17 > 16)" уходит как есть
+func vanillaInternalException(exception string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]interface{}{
+		"translate": "disconnect.genericReason",
+		"with":      []string{"Internal Exception: " + exception},
+	})
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// vanillaTruncated исключение Netty при чтении за концом пакета
+const vanillaTruncated = "io.netty.handler.codec.DecoderException: java.lang.IndexOutOfBoundsException"
+
+// vanillaNotWhitelisted отказ неизвестному игроку: так выглядит сервер с белым списком
+const vanillaNotWhitelisted = `{"translate":"multiplayer.disconnect.not_whitelisted"}`
+
+// vanillaOutdatedReason отказ клиенту другой версии: vanilla называет единственную свою
+// версию, ту же, что объявлена в статусе
+func vanillaOutdatedReason(protocol int32, advertised *minecraft.Profile) string {
+	key := "multiplayer.disconnect.outdated_client"
+	if protocol > advertised.Protocol {
+		key = "multiplayer.disconnect.outdated_server"
+	}
+	return fmt.Sprintf(`{"translate":"%s","with":["%s"]}`, key, advertised.Name)
+}
+
+// vanillaBadPacketID отказ на пакет с неожиданным ID. IOException бросает PacketDecoder,
+// поэтому Netty оборачивает ее в DecoderException, как и ошибки разбора строк
+func vanillaBadPacketID(phase minecraft.NetworkPhase, packetID minecraft.PacketType) error {
+	return &vanillaError{
+		Reason: vanillaInternalException(fmt.Sprintf("io.netty.handler.codec.DecoderException: java.io.IOException: Bad packet id %d", packetID)),
+		Err:    fmt.Errorf("unexpected packet in %s phase: 0x%02X", phase, packetID),
+	}
+}
+
+// checkVanillaUsername проверяет ник из LoginStart так же, как readUtf и
+// isValidPlayerName в vanilla, и возвращает их текст ошибки
+func checkVanillaUsername(data []byte) error {
+	length, n := readRawVarInt(data)
+	if n == 0 {
+		return &vanillaError{
+			Reason: vanillaInternalException(vanillaTruncated),
+			Err:    fmt.Errorf("truncated login start"),
+		}
+	}
+
+	maxBytes := int32(vanillaMaxNameLength * 3)
+	if length > maxBytes {
+		return &vanillaError{
+			Reason: vanillaInternalException(fmt.Sprintf(
+				"io.netty.handler.codec.DecoderException: The received encoded string buffer length is longer than maximum allowed (%d > %d)",
+				length, maxBytes)),
+			Err: fmt.Errorf("username buffer too long: %d", length),
+		}
+	}
+	if length < 0 {
+		return &vanillaError{
+			Reason: vanillaInternalException(
+				"io.netty.handler.codec.DecoderException: The received encoded string buffer length is less than zero! Weird string!"),
+			Err: fmt.Errorf("negative username length: %d", length),
+		}
+	}
+	if len(data) < n+int(length) {
+		return &vanillaError{
+			Reason: vanillaInternalException(vanillaTruncated),
+			Err:    fmt.Errorf("truncated username"),
+		}
+	}
+
+	name := data[n : n+int(length)]
+	chars := len(utf16.Encode([]rune(string(name))))
+	if chars > vanillaMaxNameLength {
+		return &vanillaError{
+			Reason: vanillaInternalException(fmt.Sprintf(
+				"io.netty.handler.codec.DecoderException: The received string length is longer than maximum allowed (%d > %d)",
+				chars, vanillaMaxNameLength)),
+			Err: fmt.Errorf("username too long: %d", chars),
+		}
+	}
+
+	for _, r := range string(name) {
+		if r <= ' ' || r >= 0x7F {
+			return &vanillaError{
+				Reason: vanillaInternalException("java.lang.IllegalStateException: Invalid characters in username"),
+				Err:    fmt.Errorf("invalid characters in username %q", name),
+			}
+		}
+	}
+
+	return nil
+}
+
+// readRawVarInt читает VarInt из начала буфера, n = 0 - буфер оборван
+func readRawVarInt(data []byte) (int32, int) {
+	var value uint32
+	for i := 0; i < 5 && i < len(data); i++ {
+		value |= uint32(data[i]&0x7F) << (7 * i)
+		if data[i]&0x80 == 0 {
+			return int32(value), i + 1
+		}
+	}
+	return 0, 0
+}
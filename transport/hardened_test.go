@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"koria-core/config"
+	"koria-core/protocol/minecraft"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// vanillaAddr адрес настоящего сервера 1.20.4 (online-mode=false, white-list=true, пустой
+// белый список). С ним тест сначала сверяет ожидаемые ответы с ответами этого сервера:
+//
+//	go test ./transport -run Hardened -vanilla 127.0.0.1:25565
+var vanillaAddr = flag.String("vanilla", "", "address of a vanilla 1.20.4 server to check the fixtures against")
+
+// Причины отказа vanilla 1.20.4. Записаны по коду сервера, а не сняты с живого сервера:
+// ключи перевода из ServerHandshakePacketListenerImpl и PlayerList, тексты исключений из
+// FriendlyByteBuf.readUtf, PacketDecoder и ServerLoginPacketListenerImpl.handleHello в том виде,
+// в каком их собирает Connection.exceptionCaught ("Internal Exception: " + исключение).
+// Пустая причина - vanilla закрывает соединение, ничего не отправив
+const (
+	vanillaLongNameReason = `{"translate":"disconnect.genericReason","with":["Internal Exception: ` +
+		`io.netty.handler.codec.DecoderException: The received string length is longer than maximum allowed (17 > 16)"]}`
+	vanillaBadCharsReason = `{"translate":"disconnect.genericReason","with":["Internal Exception: ` +
+		`java.lang.IllegalStateException: Invalid characters in username"]}`
+	vanillaBadPacketIDReason = `{"translate":"disconnect.genericReason","with":["Internal Exception: ` +
+		`io.netty.handler.codec.DecoderException: java.io.IOException: Bad packet id 5"]}`
+	vanillaNotWhitelistedReason = `{"translate":"multiplayer.disconnect.not_whitelisted"}`
+	vanillaOutdatedClientReason = `{"translate":"multiplayer.disconnect.outdated_client","with":["1.20.4"]}`
+	vanillaOutdatedServerReason = `{"translate":"multiplayer.disconnect.outdated_server","with":["1.20.4"]}`
+)
+
+func TestHardenedDisconnectMatchesVanilla(t *testing.T) {
+	server := listenHardened(t)
+
+	tests := []struct {
+		name    string
+		request []byte
+		reason  string
+	}{
+		{
+			name:    "over-long username",
+			request: concat(handshakeFrame(765, 2), loginFrame(minecraft.PacketTypeLoginStart, loginStartBody("ABCDEFGHIJKLMNOPQ"))),
+			reason:  vanillaLongNameReason,
+		},
+		{
+			name:    "bad username characters",
+			request: concat(handshakeFrame(765, 2), loginFrame(minecraft.PacketTypeLoginStart, loginStartBody("has space"))),
+			reason:  vanillaBadCharsReason,
+		},
+		{
+			name:    "unknown packet id",
+			request: concat(handshakeFrame(765, 2), loginFrame(5, loginStartBody("Steve"))),
+			reason:  vanillaBadPacketIDReason,
+		},
+		{
+			name:    "not whitelisted",
+			request: concat(handshakeFrame(765, 2), loginFrame(minecraft.PacketTypeLoginStart, loginStartBody("Steve"))),
+			reason:  vanillaNotWhitelistedReason,
+		},
+		{
+			name:    "unsupported older protocol",
+			request: handshakeFrame(764, 2),
+			reason:  vanillaOutdatedClientReason,
+		},
+		{
+			name:    "unsupported newer protocol",
+			request: handshakeFrame(769, 2),
+			reason:  vanillaOutdatedServerReason,
+		},
+		{
+			// 1.20.1 мы поддерживаем, но vanilla 1.20.4 - нет: чужой UUID не должен это выдать
+			name:    "supported but not advertised protocol",
+			request: concat(handshakeFrame(763, 2), loginFrame(minecraft.PacketTypeLoginStart, loginStartBody("Steve"))),
+			reason:  vanillaOutdatedClientReason,
+		},
+		{
+			// Handshake оборван посреди VarInt версии протокола
+			name:    "malformed handshake",
+			request: []byte{0x02, 0x00, 0xFF},
+			reason:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := vanillaDisconnect(tt.reason)
+
+			if *vanillaAddr != "" {
+				if got := exchange(t, *vanillaAddr, tt.request); !bytes.Equal(got, want) {
+					t.Fatalf("fixture does not match vanilla\nvanilla: %x\nfixture: %x", got, want)
+				}
+			}
+
+			if got := exchange(t, server.Addr(), tt.request); !bytes.Equal(got, want) {
+				t.Errorf("response mismatch\n got: %x\nwant: %x", got, want)
+			}
+		})
+	}
+}
+
+func TestHardenedReadTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the 30s vanilla read timeout")
+	}
+	server := listenHardened(t)
+
+	addrs := []string{server.Addr()}
+	if *vanillaAddr != "" {
+		addrs = append(addrs, *vanillaAddr)
+	}
+
+	for _, addr := range addrs {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("dial %s: %v", addr, err)
+		}
+		conn.SetDeadline(time.Now().Add(vanillaReadTimeout + 10*time.Second))
+
+		start := time.Now()
+		response, err := io.ReadAll(conn)
+		elapsed := time.Since(start)
+		conn.Close()
+
+		if err != nil {
+			t.Fatalf("%s: connection was not closed: %v", addr, err)
+		}
+		if len(response) != 0 {
+			t.Errorf("%s: got %x before close, want nothing", addr, response)
+		}
+		if elapsed < vanillaReadTimeout-time.Second || elapsed > vanillaReadTimeout+3*time.Second {
+			t.Errorf("%s: closed after %v, want %v", addr, elapsed, vanillaReadTimeout)
+		}
+	}
+}
+
+// listenHardened запускает hardened сервер с одним пользователем, которого тесты не знают
+func listenHardened(t *testing.T) *Server {
+	t.Helper()
+
+	server, err := Listen(&ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		Users:      []config.User{{ID: uuid.New(), Email: "player"}},
+		Hardened:   true,
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve()
+	return server
+}
+
+// exchange отправляет request и возвращает все байты ответа до закрытия соединения сервером
+func exchange(t *testing.T, addr string, request []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return response
+}
+
+// vanillaDisconnect LoginDisconnect с причиной reason целиком, с длиной пакета
+func vanillaDisconnect(reason string) []byte {
+	if reason == "" {
+		return []byte{}
+	}
+	var body bytes.Buffer
+	writeVarInt(&body, int32(minecraft.PacketTypeLoginDisconnect))
+	writeVarInt(&body, int32(len(reason)))
+	body.WriteString(reason)
+	return frame(body.Bytes())
+}
+
+// handshakeFrame Handshake на localhost:25565
+func handshakeFrame(protocol int32, nextState int32) []byte {
+	var body bytes.Buffer
+	writeVarInt(&body, int32(minecraft.PacketTypeHandshake))
+	writeVarInt(&body, protocol)
+	writeVarInt(&body, int32(len("localhost")))
+	body.WriteString("localhost")
+	body.Write([]byte{0x63, 0xDD})
+	writeVarInt(&body, nextState)
+	return frame(body.Bytes())
+}
+
+// loginFrame пакет фазы Login с произвольным ID
+func loginFrame(packetID minecraft.PacketType, payload []byte) []byte {
+	var body bytes.Buffer
+	writeVarInt(&body, int32(packetID))
+	body.Write(payload)
+	return frame(body.Bytes())
+}
+
+// loginStartBody тело LoginStart 1.20.4: ник и случайный UUID
+func loginStartBody(name string) []byte {
+	var body bytes.Buffer
+	writeVarInt(&body, int32(len(name)))
+	body.WriteString(name)
+	id := uuid.New()
+	body.Write(id[:])
+	return body.Bytes()
+}
+
+func frame(body []byte) []byte {
+	var out bytes.Buffer
+	writeVarInt(&out, int32(len(body)))
+	out.Write(body)
+	return out.Bytes()
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// writeVarInt пишет VarInt сам, чтобы ожидания не зависели от кодека пакета
+func writeVarInt(buf *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for v >= 0x80 {
+		buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	buf.WriteByte(byte(v))
+}
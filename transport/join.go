@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"koria-core/protocol/minecraft"
+	c2s "koria-core/protocol/minecraft/packets/c2s"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
+	"math/rand"
+	"net"
+)
+
+const (
+	// joinChunkRadius радиус чанков вокруг игрока, отправляемых при входе
+	joinChunkRadius = 1
+	// maxJoinPackets максимум пакетов, которые сторона читает во время входа в мир
+	maxJoinPackets = 64
+)
+
+// performServerJoin разыгрывает вход игрока в мир после фазы Configuration
+// Сервер отправляет пакеты в том же порядке, что и vanilla сервер выбранной версии,
+// и ждет ответ на Keep Alive. После этого по соединению идет трафик мультиплексора
+func performServerJoin(conn net.Conn, version *minecraft.Profile) error {
+	// Игрок появляется в случайной точке недалеко от спавна
+	spawnX := int32(rand.Intn(2000) - 1000)
+	spawnZ := int32(rand.Intn(2000) - 1000)
+	chunkX, chunkZ := spawnX>>4, spawnZ>>4
+	surfaceY := s2c.NewFlatChunk(chunkX, chunkZ).SurfaceY()
+
+	teleportID := rand.Int31n(1 << 16)
+	keepAliveID := rand.Int63()
+
+	loginPlay := &s2c.LoginPlayPacket{
+		EntityID:            rand.Int31n(1 << 16),
+		DimensionNames:      []string{"minecraft:overworld", "minecraft:the_nether", "minecraft:the_end"},
+		MaxPlayers:          20,
+		ViewDistance:        10,
+		SimulationDistance:  10,
+		EnableRespawnScreen: true,
+		DimensionType:       "minecraft:overworld",
+		DimensionName:       "minecraft:overworld",
+		HashedSeed:          rand.Int63(),
+		GameMode:            0, // Survival
+		PreviousGameMode:    -1,
+		IsFlat:              true,
+	}
+	if !version.Configuration {
+		// До 1.20.2 реестры передаются в Login (Play)
+		loginPlay.RegistryCodec = registryCodec()
+	}
+
+	packets := []minecraft.Packet{
+		loginPlay,
+		&s2c.ChangeDifficultyPacket{Difficulty: 2},
+		&s2c.PlayerAbilitiesPacket{FlyingSpeed: 0.05, FOVModifier: 0.1},
+		&s2c.SetHeldItemPacket{Slot: int8(rand.Intn(9))},
+		&s2c.SyncPlayerPositionPacket{
+			X:          float64(spawnX) + 0.5,
+			Y:          float64(surfaceY),
+			Z:          float64(spawnZ) + 0.5,
+			Yaw:        rand.Float32() * 360,
+			TeleportID: teleportID,
+		},
+		&s2c.SetDefaultSpawnPacket{X: spawnX, Y: surfaceY, Z: spawnZ},
+	}
+	if version.WaitForChunksEvent {
+		packets = append(packets, &s2c.GameEventPacket{Event: s2c.GameEventStartWaitingForChunks})
+	}
+	packets = append(packets, &s2c.SetCenterChunkPacket{ChunkX: chunkX, ChunkZ: chunkZ})
+	if version.ChunkBatches {
+		packets = append(packets, &s2c.ChunkBatchStartPacket{})
+	}
+
+	batchSize := 0
+	for x := chunkX - joinChunkRadius; x <= chunkX+joinChunkRadius; x++ {
+		for z := chunkZ - joinChunkRadius; z <= chunkZ+joinChunkRadius; z++ {
+			packets = append(packets, s2c.NewFlatChunk(x, z))
+			batchSize++
+		}
+	}
+
+	if version.ChunkBatches {
+		packets = append(packets, &s2c.ChunkBatchFinishedPacket{BatchSize: int32(batchSize)})
+	}
+	packets = append(packets, &s2c.KeepAlivePacket{ID: keepAliveID})
+
+	// Буферизуем, чтобы не отправлять каждый пакет отдельным сегментом
+	writer := bufio.NewWriter(conn)
+	for _, packet := range packets {
+		if err := version.WritePacket(writer, minecraft.PhasePlay, minecraft.Clientbound, packet); err != nil {
+			return fmt.Errorf("write join packet 0x%02X: %w", packet.PacketID(), err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("flush join packets: %w", err)
+	}
+
+	// Читаем ответы клиента до Keep Alive
+	for i := 0; i < maxJoinPackets; i++ {
+		packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhasePlay, minecraft.Serverbound)
+		if err != nil {
+			return fmt.Errorf("read join response: %w", err)
+		}
+
+		switch packetID {
+		case minecraft.PacketTypeConfirmTeleport:
+			var confirm c2s.ConfirmTeleportPacket
+			if err := version.DecodePacket(&confirm, data); err != nil {
+				return fmt.Errorf("decode confirm teleport: %w", err)
+			}
+			if confirm.TeleportID != teleportID {
+				return fmt.Errorf("unexpected teleport ID: %d", confirm.TeleportID)
+			}
+
+		case minecraft.PacketTypeKeepAliveC2S:
+			var keepAlive c2s.KeepAlivePacket
+			if err := version.DecodePacket(&keepAlive, data); err != nil {
+				return fmt.Errorf("decode keep alive: %w", err)
+			}
+			if keepAlive.ID != keepAliveID {
+				return fmt.Errorf("unexpected keep alive ID: %d", keepAlive.ID)
+			}
+			return nil
+
+		default:
+			// Client Information, Chunk Batch Received и прочее - не влияют на вход
+		}
+	}
+
+	return fmt.Errorf("no keep alive response after %d packets", maxJoinPackets)
+}
+
+// performClientJoin отвечает на вход в мир так же, как vanilla клиент
+// Завершается после ответа на первый Keep Alive сервера
+func performClientJoin(conn net.Conn, version *minecraft.Profile) error {
+	for i := 0; i < maxJoinPackets; i++ {
+		packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhasePlay, minecraft.Clientbound)
+		if err != nil {
+			return fmt.Errorf("read join packet: %w", err)
+		}
+
+		var response minecraft.Packet
+
+		switch packetID {
+		case minecraft.PacketTypeLoginPlay:
+			// До 1.20.2 настройки клиента отправляются после Login (Play)
+			if !version.Configuration {
+				info := clientInformation()
+				response = &info
+			}
+
+		case minecraft.PacketTypeSyncPlayerPosition:
+			var sync s2c.SyncPlayerPositionPacket
+			if err := version.DecodePacket(&sync, data); err != nil {
+				return fmt.Errorf("decode player position: %w", err)
+			}
+			response = &c2s.ConfirmTeleportPacket{TeleportID: sync.TeleportID}
+
+		case minecraft.PacketTypeChunkBatchFinished:
+			response = &c2s.ChunkBatchReceivedPacket{ChunksPerTick: 7 + rand.Float32()*2}
+
+		case minecraft.PacketTypeKeepAliveS2C:
+			var keepAlive s2c.KeepAlivePacket
+			if err := version.DecodePacket(&keepAlive, data); err != nil {
+				return fmt.Errorf("decode keep alive: %w", err)
+			}
+			reply := &c2s.KeepAlivePacket{ID: keepAlive.ID}
+			if err := version.WritePacket(conn, minecraft.PhasePlay, minecraft.Serverbound, reply); err != nil {
+				return fmt.Errorf("write keep alive: %w", err)
+			}
+			return nil
+		}
+
+		if response != nil {
+			if err := version.WritePacket(conn, minecraft.PhasePlay, minecraft.Serverbound, response); err != nil {
+				return fmt.Errorf("write join response 0x%02X: %w", response.PacketID(), err)
+			}
+		}
+	}
+
+	return fmt.Errorf("no keep alive after %d packets", maxJoinPackets)
+}
@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// legacyPingByte первый байт Server List Ping клиентов до 1.7 (вместо длины пакета)
+	legacyPingByte = 0xFE
+
+	// legacyKickByte ID пакета Kick, в котором старый сервер возвращает статус
+	legacyKickByte = 0xFF
+
+	// legacyPingProtocol протокол в ответе 1.4+, vanilla всегда отвечает 127
+	legacyPingProtocol = 127
+
+	// legacyPayloadWait сколько ждем продолжения пинга после 0xFE.
+	// Клиенты 1.4-1.6 присылают его в том же TCP сегменте, Beta 1.8-1.3 - только 0xFE
+	legacyPayloadWait = 100 * time.Millisecond
+)
+
+// handleLegacyPing отвечает на Server List Ping клиентов до 1.7.
+// Первый байт 0xFE уже прочитан
+func (s *Server) handleLegacyPing(conn net.Conn) {
+	// Смотрим, есть ли продолжение: 0x01 (1.4-1.5) и MC|PingHost (1.6)
+	payload := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(legacyPayloadWait))
+	n, _ := conn.Read(payload)
+	conn.SetReadDeadline(time.Time{})
+
+	var status s2c.StatusResponse
+	if err := json.Unmarshal([]byte(s.statusResponse(0)), &status); err != nil {
+		return
+	}
+	motd := plainText(status.Description)
+
+	var response string
+	if n > 0 && payload[0] == 0x01 {
+		// 1.4+: §1\0протокол\0версия\0MOTD\0онлайн\0максимум
+		response = strings.Join([]string{
+			"§1",
+			strconv.Itoa(legacyPingProtocol),
+			status.Version.Name,
+			motd,
+			strconv.Itoa(status.Players.Online),
+			strconv.Itoa(status.Players.Max),
+		}, "\x00")
+	} else {
+		// Beta 1.8-1.3: MOTD§онлайн§максимум, коды форматирования в MOTD ломают разбор
+		response = fmt.Sprintf("%s§%d§%d",
+			stripFormatting(motd), status.Players.Online, status.Players.Max)
+	}
+
+	if err := writeLegacyKick(conn, response); err != nil {
+		log.Printf("Failed to send legacy status response: %v", err)
+		return
+	}
+
+	log.Printf("Sent Legacy Status Response to %s (Server List Ping)", conn.RemoteAddr())
+}
+
+// writeLegacyKick записывает пакет Kick: 0xFF, длина в символах UTF-16 и строка UTF-16BE
+func writeLegacyKick(w io.Writer, text string) error {
+	chars := utf16.Encode([]rune(text))
+
+	buf := make([]byte, 3, 3+2*len(chars))
+	buf[0] = legacyKickByte
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(chars)))
+	for _, c := range chars {
+		buf = binary.BigEndian.AppendUint16(buf, c)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// stripFormatting убирает коды форматирования вида §a
+func stripFormatting(text string) string {
+	var sb strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '§' {
+			i++
+			continue
+		}
+		sb.WriteRune(runes[i])
+	}
+	return sb.String()
+}
+
+// plainText собирает текст chat component без форматирования: строку,
+// объект с text и extra или массив компонентов
+func plainText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		var sb strings.Builder
+		for _, part := range list {
+			sb.WriteString(plainText(part))
+		}
+		return sb.String()
+	}
+
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if err := json.Unmarshal(raw, &component); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(component.Text)
+	for _, part := range component.Extra {
+		sb.WriteString(plainText(part))
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHandshakeTimeout время от подключения до конца Handshake (и Status запроса)
+	defaultHandshakeTimeout = 15 * time.Second
+
+	// defaultLoginTimeout время от Handshake до начала трафика мультиплексора,
+	// vanilla отключает медленный вход через 30 секунд (slow_login)
+	defaultLoginTimeout = 30 * time.Second
+
+	// defaultFirstFrameTimeout время на первый пакет мультиплексора после входа
+	defaultFirstFrameTimeout = 30 * time.Second
+
+	// defaultMaxPendingPerIP одновременных соединений без аутентификации с одного IP
+	defaultMaxPendingPerIP = 16
+)
+
+// pendingLimiter считает соединения, еще не прошедшие аутентификацию, по IP источника.
+// Не дает одному адресу занять все горутины и сокеты медленными handshake (slowloris)
+type pendingLimiter struct {
+	max    int
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+func newPendingLimiter(max int) *pendingLimiter {
+	return &pendingLimiter{
+		max:    max,
+		counts: make(map[string]int),
+	}
+}
+
+// acquire занимает место для IP, false - лимит исчерпан
+func (l *pendingLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[ip] >= l.max {
+		return false
+	}
+	l.counts[ip]++
+	return true
+}
+
+// release освобождает место, занятое acquire
+func (l *pendingLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[ip] <= 1 {
+		delete(l.counts, ip)
+		return
+	}
+	l.counts[ip]--
+}
+
+// remoteIP возвращает IP источника соединения без порта
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	queryTypeHandshake = 0x09
+	queryTypeStat      = 0x00
+
+	// queryChallengeTTL сколько живет challenge token, vanilla обновляет их раз в 30 секунд
+	queryChallengeTTL = 30 * time.Second
+
+	// queryMaxChallenges ограничивает таблицу token'ов при потоке handshake с разных адресов
+	queryMaxChallenges = 4096
+
+	queryBasicStatLen = 11 // magic + тип + сессия + challenge
+	queryFullStatLen  = 15 // то же + 4 байта выравнивания
+)
+
+var (
+	queryMagic = []byte{0xFE, 0xFD}
+
+	// Заголовки Full Stat, которые vanilla отправляет побайтно
+	queryFullStatPadding = []byte("splitnum\x00\x80\x00")
+	queryPlayersPadding  = []byte("\x01player_\x00\x00")
+)
+
+// queryChallenge выданный адресу challenge token
+type queryChallenge struct {
+	token   int32
+	expires time.Time
+}
+
+// queryResponder отвечает на GameSpy4 Query (enable-query=true в server.properties).
+// Данные берутся из того же статуса, что отдает Server List Ping
+type queryResponder struct {
+	conn     net.PacketConn
+	server   *Server
+	hostIP   string
+	hostPort string
+
+	challenges map[string]queryChallenge
+	mu         sync.Mutex
+}
+
+func newQueryResponder(conn net.PacketConn, server *Server) *queryResponder {
+	hostIP, hostPort, _ := net.SplitHostPort(server.listener.Addr().String())
+	if ip := net.ParseIP(hostIP); ip == nil || ip.IsUnspecified() {
+		hostIP = "0.0.0.0"
+	}
+
+	return &queryResponder{
+		conn:       conn,
+		server:     server,
+		hostIP:     hostIP,
+		hostPort:   hostPort,
+		challenges: make(map[string]queryChallenge),
+	}
+}
+
+// serve читает запросы до закрытия сокета
+func (q *queryResponder) serve() {
+	buf := make([]byte, 1460)
+	for {
+		n, addr, err := q.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		response := q.handle(buf[:n], addr)
+		if response == nil {
+			continue
+		}
+		if _, err := q.conn.WriteTo(response, addr); err != nil {
+			log.Printf("Failed to send query response to %s: %v", addr, err)
+		}
+	}
+}
+
+// handle разбирает запрос и возвращает ответ. nil - запрос молча игнорируется, как в vanilla
+func (q *queryResponder) handle(packet []byte, addr net.Addr) []byte {
+	if len(packet) < 7 || !bytes.Equal(packet[:2], queryMagic) {
+		return nil
+	}
+	packetType := packet[2]
+	session := packet[3:7]
+
+	switch packetType {
+	case queryTypeHandshake:
+		token, ok := q.issueChallenge(addr)
+		if !ok {
+			return nil
+		}
+
+		response := []byte{queryTypeHandshake}
+		response = append(response, session...)
+		response = append(response, strconv.Itoa(int(token))...)
+		return append(response, 0x00)
+
+	case queryTypeStat:
+		if len(packet) < queryBasicStatLen {
+			return nil
+		}
+		token := int32(binary.BigEndian.Uint32(packet[7:11]))
+		if !q.checkChallenge(addr, token) {
+			return nil
+		}
+
+		var status s2c.StatusResponse
+		if err := json.Unmarshal([]byte(q.server.statusResponse(0)), &status); err != nil {
+			return nil
+		}
+
+		response := []byte{queryTypeStat}
+		response = append(response, session...)
+		if len(packet) >= queryFullStatLen {
+			return q.fullStat(response, &status)
+		}
+		return q.basicStat(response, &status)
+	}
+
+	return nil
+}
+
+// basicStat MOTD, режим, карта, онлайн, слоты, порт (little-endian) и IP
+func (q *queryResponder) basicStat(response []byte, status *s2c.StatusResponse) []byte {
+	response = appendCString(response, plainText(status.Description))
+	response = appendCString(response, "SMP")
+	response = appendCString(response, "world")
+	response = appendCString(response, strconv.Itoa(status.Players.Online))
+	response = appendCString(response, strconv.Itoa(status.Players.Max))
+
+	port, _ := strconv.Atoi(q.hostPort)
+	response = binary.LittleEndian.AppendUint16(response, uint16(port))
+	return appendCString(response, q.hostIP)
+}
+
+// fullStat пары ключ-значение в порядке vanilla и список игроков
+func (q *queryResponder) fullStat(response []byte, status *s2c.StatusResponse) []byte {
+	response = append(response, queryFullStatPadding...)
+
+	fields := [][2]string{
+		{"hostname", plainText(status.Description)},
+		{"gametype", "SMP"},
+		{"game_id", "MINECRAFT"},
+		{"version", status.Version.Name},
+		{"plugins", ""},
+		{"map", "world"},
+		{"numplayers", strconv.Itoa(status.Players.Online)},
+		{"maxplayers", strconv.Itoa(status.Players.Max)},
+		{"hostport", q.hostPort},
+		{"hostip", q.hostIP},
+	}
+	for _, field := range fields {
+		response = appendCString(response, field[0])
+		response = appendCString(response, field[1])
+	}
+	response = append(response, 0x00)
+
+	response = append(response, queryPlayersPadding...)
+	for _, player := range status.Players.Sample {
+		response = appendCString(response, player.Name)
+	}
+	return append(response, 0x00)
+}
+
+// issueChallenge выдает адресу новый token. false - таблица token'ов переполнена
+func (q *queryResponder) issueChallenge(addr net.Addr) (int32, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for key, challenge := range q.challenges {
+		if now.After(challenge.expires) {
+			delete(q.challenges, key)
+		}
+	}
+
+	if len(q.challenges) >= queryMaxChallenges {
+		return 0, false
+	}
+
+	token := rand.Int31()
+	q.challenges[addr.String()] = queryChallenge{token: token, expires: now.Add(queryChallengeTTL)}
+	return token, true
+}
+
+// checkChallenge проверяет token, выданный этому адресу
+func (q *queryResponder) checkChallenge(addr net.Addr, token int32) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	challenge, ok := q.challenges[addr.String()]
+	return ok && challenge.token == token && time.Now().Before(challenge.expires)
+}
+
+// appendCString добавляет строку с завершающим нулем
+func appendCString(b []byte, s string) []byte {
+	b = append(b, s...)
+	return append(b, 0x00)
+}
@@ -1,13 +1,18 @@
 package transport
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	commnet "koria-core/common/net"
 	"koria-core/config"
 	"koria-core/protocol/minecraft"
 	c2s "koria-core/protocol/minecraft/packets/c2s"
 	"koria-core/protocol/minecraft/packets/common"
 	s2c "koria-core/protocol/minecraft/packets/s2c"
 	"koria-core/protocol/multiplexer"
+	"koria-core/protocol/steganography"
 	"koria-core/stats"
 	"log"
 	"net"
@@ -19,6 +24,20 @@ import (
 type Server struct {
 	listener  net.Listener
 	validator *config.UserValidator
+	channels  []string
+	carrier   steganography.SelectorMode
+	fallback  string
+	status    *statusSource // nil - статус отдает fallback или ответ по умолчанию
+	query     net.PacketConn
+	hardened  bool
+	proxyHdr  bool // соединения приходят от балансировщика с заголовком PROXY protocol
+	pending   *pendingLimiter
+	access    *accessControl // nil - без ограничений по адресу
+
+	// Дедлайны фаз до начала трафика мультиплексора
+	handshakeTimeout  time.Duration
+	loginTimeout      time.Duration
+	firstFrameTimeout time.Duration
 
 	// Активные мультиплексоры (одно TCP соединение = один мультиплексор)
 	muxes   map[string]*multiplexer.Multiplexer
@@ -31,6 +50,42 @@ type Server struct {
 type ServerConfig struct {
 	ListenAddr string        // Адрес для прослушивания (например, "0.0.0.0:25565")
 	Users      []config.User // Список пользователей
+	Channels   []string      // Пул plugin-каналов (пусто = набор по умолчанию)
+
+	// CarrierMode стратегия выбора пакетов-носителей (пусто = adaptive)
+	CarrierMode steganography.SelectorMode
+
+	// Fallback адрес настоящего Minecraft сервера (host:port), которому передаются
+	// соединения без аутентификации. Пусто - такие клиенты получают LoginDisconnect
+	Fallback string
+
+	// Status ответ на Server List Ping. Если задан, статус отвечаем сами даже при fallback
+	Status *StatusConfig
+
+	// Hardened повторяет поведение vanilla 1.20.4 для чужих клиентов: тексты отказов,
+	// 30 секунд ожидания на каждое чтение до входа и молчаливое закрытие на обрыве
+	Hardened bool
+
+	// HandshakeTimeout, LoginTimeout и FirstFrameTimeout ограничивают фазы соединения:
+	// Handshake (и Status), вход до начала трафика мультиплексора и первый пакет
+	// мультиплексора. 0 - значения по умолчанию
+	HandshakeTimeout  time.Duration
+	LoginTimeout      time.Duration
+	FirstFrameTimeout time.Duration
+
+	// MaxPendingPerIP одновременных соединений без аутентификации с одного IP (0 - 16)
+	MaxPendingPerIP int
+
+	// Access лимит частоты подключений, временные баны и списки сетей (nil - без ограничений)
+	Access *AccessConfig
+
+	// QueryAddr UDP адрес GameSpy4 Query (обычно тот же порт, что и у игры). Пусто - выключен
+	QueryAddr string
+
+	// AcceptProxyProtocol ждет заголовок PROXY protocol v1/v2 в начале каждого соединения:
+	// адрес клиента для лимитов, банов и логов берется из него. Соединения без заголовка
+	// закрываются, поэтому порт должен быть доступен только балансировщику
+	AcceptProxyProtocol bool
 }
 
 // Listen создает и запускает сервер
@@ -43,8 +98,58 @@ func Listen(cfg *ServerConfig) (*Server, error) {
 	server := &Server{
 		listener:  listener,
 		validator: config.NewUserValidator(cfg.Users),
+		channels:  cfg.Channels,
+		carrier:   cfg.CarrierMode,
+		fallback:  cfg.Fallback,
+		hardened:  cfg.Hardened,
+		proxyHdr:  cfg.AcceptProxyProtocol,
 		muxes:     make(map[string]*multiplexer.Multiplexer),
 		closeCh:   make(chan struct{}),
+
+		handshakeTimeout:  cfg.HandshakeTimeout,
+		loginTimeout:      cfg.LoginTimeout,
+		firstFrameTimeout: cfg.FirstFrameTimeout,
+	}
+
+	if server.handshakeTimeout <= 0 {
+		server.handshakeTimeout = defaultHandshakeTimeout
+		if cfg.Hardened {
+			server.handshakeTimeout = vanillaReadTimeout
+		}
+	}
+	if server.loginTimeout <= 0 {
+		server.loginTimeout = defaultLoginTimeout
+	}
+	if server.firstFrameTimeout <= 0 {
+		server.firstFrameTimeout = defaultFirstFrameTimeout
+	}
+
+	maxPending := cfg.MaxPendingPerIP
+	if maxPending <= 0 {
+		maxPending = defaultMaxPendingPerIP
+	}
+	server.pending = newPendingLimiter(maxPending)
+
+	if cfg.Access != nil {
+		server.access = newAccessControl(*cfg.Access)
+		go server.access.pruneLoop(server.closeCh)
+	}
+
+	if cfg.QueryAddr != "" {
+		query, err := net.ListenPacket("udp", cfg.QueryAddr)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("listen query UDP: %w", err)
+		}
+		server.query = query
+		go newQueryResponder(query, server).serve()
+	}
+
+	if cfg.Status != nil {
+		server.status = newStatusSource(*cfg.Status)
+		if cfg.Status.Mirror != "" {
+			go server.status.mirrorLoop(server.closeCh)
+		}
 	}
 
 	return server, nil
@@ -80,46 +185,195 @@ func (s *Server) handleConnection(conn net.Conn) {
 		tcpConn.SetWriteBuffer(512 * 1024)              // 512KB write buffer
 	}
 
+	// За балансировщиком настоящий адрес клиента приходит в заголовке PROXY protocol
+	if s.proxyHdr {
+		conn.SetReadDeadline(time.Now().Add(commnet.ProxyHeaderTimeout))
+		proxied, err := commnet.ReadProxyHeader(conn)
+		if err != nil {
+			log.Printf("PROXY protocol header from %s rejected: %v", conn.RemoteAddr(), err)
+			stats.Global().IncrementFailedConnections()
+			conn.Close()
+			return
+		}
+		conn = proxied
+	}
+
+	// Лимит частоты проверяем до чтения Minecraft пакетов: лишние соединения ничего нам не стоят.
+	// ban != nil - адрес забанен: статус он видит как обычно, а вход получает отказ
+	var ban *accessBan
+	if s.access != nil {
+		var ok bool
+		ban, ok = s.access.check(net.ParseIP(remoteIP(conn)))
+		if !ok {
+			stats.Global().IncrementFailedConnections()
+			conn.Close()
+			return
+		}
+	}
+
 	stats.Global().IncrementConnections()
 	defer func() {
 		stats.Global().DecrementConnections()
 		conn.Close()
 	}()
 
+	// Ограничиваем число соединений без аутентификации с одного адреса
+	ip := remoteIP(conn)
+	if !s.pending.acquire(ip) {
+		stats.Global().IncrementFailedConnections()
+		return
+	}
+	// Слот освобождается, как только соединение перестает ждать аутентификации:
+	// клиент вошел или ушел к fallback серверу
+	pending := true
+	releasePending := func() {
+		if pending {
+			s.pending.release(ip)
+			pending = false
+		}
+	}
+	defer releasePending()
+
+	// Запоминаем все, что прочитали до успешной аутентификации:
+	// при отказе эти байты уходят fallback серверу вместе с остальным соединением
+	recorder := commnet.NewRecordingConn(conn)
+	conn = recorder
+
+	// В hardened режиме, как у vanilla, до входа каждое чтение ждет данных не дольше 30 секунд
+	// вдобавок к дедлайнам фаз
+	var timeoutConn *readTimeoutConn
+	if s.hardened {
+		timeoutConn = newReadTimeoutConn(conn, vanillaReadTimeout)
+		conn = timeoutConn
+	}
+
+	// Handshake (или Status запрос) должен уложиться в свой дедлайн
+	commnet.SetTCPDeadlines(conn, s.handshakeTimeout, s.handshakeTimeout)
+
+	// Клиенты до 1.7 и многие сканеры начинают с legacy пинга 0xFE вместо длины пакета
+	var first [1]byte
+	if _, err := io.ReadFull(conn, first[:]); err != nil {
+		return
+	}
+	if first[0] == legacyPingByte {
+		if s.status == nil && s.spliceToFallback(recorder, releasePending) {
+			return
+		}
+		s.handleLegacyPing(conn)
+		return
+	}
+
 	// 1. Читаем и проверяем Handshake
-	handshake, err := s.readHandshake(conn)
+	handshake, err := s.readHandshake(io.MultiReader(bytes.NewReader(first[:]), conn))
 	if err != nil {
 		stats.Global().IncrementConnectionErrors()
-		// log error
+		s.spliceToFallback(recorder, releasePending)
 		return
 	}
 
 	// Проверяем NextState
 	if handshake.NextState == 1 {
 		// Status запрос (Server List Ping) - ДОЛЖНЫ ответить для маскировки!
-		s.handleStatusRequest(conn)
+		// Без своих настроек статуса с fallback отвечает настоящий сервер
+		if s.status == nil && s.spliceToFallback(recorder, releasePending) {
+			return
+		}
+		s.handleStatusRequest(conn, handshake.ProtocolVersion)
 		return
 	}
 
 	// Проверяем, что клиент хочет войти (NextState = 2)
 	if handshake.NextState != 2 {
-		// Неизвестный NextState - игнорируем
+		// Неизвестный NextState - отдаем fallback или игнорируем
+		s.spliceToFallback(recorder, releasePending)
+		return
+	}
+
+	// Принимаем любую поддерживаемую версию, дальше говорим на ее протоколе
+	version, ok := minecraft.ProfileByProtocol(handshake.ProtocolVersion)
+	if !ok {
+		stats.Global().IncrementFailedConnections()
+		if s.spliceToFallback(recorder, releasePending) {
+			return
+		}
+		reason := unsupportedVersionReason(handshake.ProtocolVersion)
+		if s.hardened {
+			reason = vanillaOutdatedReason(handshake.ProtocolVersion, s.statusSource().profile(handshake.ProtocolVersion))
+		}
+		minecraft.WritePacket(conn, &s2c.LoginDisconnectPacket{Reason: reason})
 		return
 	}
 
+	// Дальше дедлайн на весь вход: LoginStart, Configuration и вход в мир
+	loginDeadline := time.Now().Add(s.loginTimeout)
+	conn.SetDeadline(loginDeadline)
+
+	// В hardened режиме, как у vanilla, поддерживается только версия из статуса.
+	// Другие версии принимаем лишь у своих клиентов, остальные получают отказ по версии
+	outdated := s.hardened && handshake.ProtocolVersion != s.statusSource().profile(handshake.ProtocolVersion).Protocol
+	if outdated {
+		conn.SetReadDeadline(time.Now().Add(vanillaOutdatedWait))
+	}
+
 	// 2. Читаем LoginStart и валидируем UUID
-	user, err := s.readAndValidateLogin(conn)
+	user, err := s.readAndValidateLogin(conn, version)
+	if outdated {
+		if err != nil {
+			err = &vanillaError{
+				Reason: vanillaOutdatedReason(handshake.ProtocolVersion, s.statusSource().profile(handshake.ProtocolVersion)),
+				Err:    fmt.Errorf("protocol %d is not advertised: %w", handshake.ProtocolVersion, err),
+			}
+		}
+		conn.SetReadDeadline(loginDeadline)
+	}
+	if err == nil && ban != nil {
+		// Как vanilla: бан по IP проверяется после белого списка, свой UUID от него не спасает
+		err = &vanillaError{Reason: ban.reason(), Err: fmt.Errorf("address %s is banned", ip)}
+	}
 	if err != nil {
+		stats.Global().IncrementFailedConnections()
+		stats.Global().IncrementConnectionErrors()
+
+		// Неудачным входом считаем только полученный и отвергнутый LoginStart
+		var vErr *vanillaError
+		isRejection := errors.As(err, &vErr)
+		if s.access != nil && ban == nil && isRejection {
+			s.access.recordFailure(net.ParseIP(ip))
+		}
+
+		if s.spliceToFallback(recorder, releasePending) {
+			return
+		}
+
+		reason := fmt.Sprintf(`{"text":"Authentication failed: %s"}`, err.Error())
+		if s.hardened || ban != nil {
+			// Обрыв и таймаут vanilla не объясняет, просто закрывает соединение
+			if !isRejection {
+				return
+			}
+			reason = vErr.Reason
+		}
+
 		// Отправляем disconnect
 		disconnect := &s2c.LoginDisconnectPacket{
-			Reason: fmt.Sprintf(`{"text":"Authentication failed: %s"}`, err.Error()),
+			Reason: reason,
 		}
 		minecraft.WritePacket(conn, disconnect)
-		stats.Global().IncrementFailedConnections()
-		stats.Global().IncrementConnectionErrors()
 		return
 	}
 
+	// Клиент свой, дальше соединение обслуживаем сами
+	recorder.StopRecording()
+	conn = recorder.Conn
+	if timeoutConn != nil {
+		// Таймаут чтения vanilla нужен только для чужих клиентов, дальше действует дедлайн входа
+		conn.SetReadDeadline(timeoutConn.deadline)
+	}
+	releasePending()
+	if s.access != nil {
+		s.access.recordSuccess(net.ParseIP(ip))
+	}
+
 	// 3. Отправляем LoginSuccess
 	// Minecraft protocol ограничивает имя пользователя 16 символами
 	username := user.Email
@@ -130,14 +384,41 @@ func (s *Server) handleConnection(conn net.Conn) {
 		UUID:       user.ID,
 		Username:   username,
 		Properties: nil,
+
+		StrictErrorHandling: true,
 	}
 
-	if err := minecraft.WritePacket(conn, success); err != nil {
+	if err := version.WritePacket(conn, minecraft.PhaseLogin, minecraft.Clientbound, success); err != nil {
 		return
 	}
 
-	// 4. Создаем мультиплексор для этого соединения
-	mux := multiplexer.NewMultiplexer(conn)
+	// 4. Фаза Configuration (1.20.2+): реестры, теги, Finish Configuration
+	if version.Configuration {
+		if err := performServerConfiguration(conn, version); err != nil {
+			log.Printf("Configuration with %s failed: %v", conn.RemoteAddr(), err)
+			stats.Global().IncrementConnectionErrors()
+			return
+		}
+	}
+
+	// 5. Разыгрываем вход в мир, чтобы сессия выглядела как настоящая игра
+	if err := performServerJoin(conn, version); err != nil {
+		log.Printf("Join sequence with %s failed: %v", conn.RemoteAddr(), err)
+		stats.Global().IncrementConnectionErrors()
+		return
+	}
+
+	// Вход завершен, дальше ожидание данных ограничивает только мультиплексор
+	conn.SetDeadline(time.Time{})
+
+	// 6. Создаем мультиплексор для этого соединения
+	mux := multiplexer.NewMultiplexerWithConfig(conn, &multiplexer.Config{
+		Channels:          s.channels,
+		CarrierMode:       s.carrier,
+		Version:           version,
+		FirstFrameTimeout: s.firstFrameTimeout,
+		Server:            true,
+	})
 
 	// DEBUG
 
@@ -156,7 +437,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 		mux.Close()
 	}()
 
-	// 5. Принимаем виртуальные потоки и обрабатываем их
+	// 7. Принимаем виртуальные потоки и обрабатываем их
 	// Это зависит от вашей логики проксирования
 	// Например, каждый виртуальный поток можно проксировать к целевому серверу
 
@@ -171,9 +452,9 @@ func (s *Server) handleConnection(conn net.Conn) {
 }
 
 // readHandshake читает и парсит handshake пакет
-func (s *Server) readHandshake(conn net.Conn) (*common.HandshakePacket, error) {
+func (s *Server) readHandshake(r io.Reader) (*common.HandshakePacket, error) {
 	var handshake common.HandshakePacket
-	if err := minecraft.ReadPacket(conn, &handshake); err != nil {
+	if err := minecraft.ReadPacket(r, &handshake); err != nil {
 		return nil, fmt.Errorf("read handshake: %w", err)
 	}
 
@@ -181,21 +462,49 @@ func (s *Server) readHandshake(conn net.Conn) (*common.HandshakePacket, error) {
 }
 
 // readAndValidateLogin читает LoginStart и валидирует UUID пользователя
-func (s *Server) readAndValidateLogin(conn net.Conn) (*config.User, error) {
-	var loginStart c2s.LoginStartPacket
-	if err := minecraft.ReadPacket(conn, &loginStart); err != nil {
+func (s *Server) readAndValidateLogin(conn net.Conn, version *minecraft.Profile) (*config.User, error) {
+	packetID, data, err := version.ReadPacketRaw(conn, minecraft.PhaseLogin, minecraft.Serverbound)
+	if err != nil {
 		return nil, fmt.Errorf("read login start: %w", err)
 	}
+	if packetID != minecraft.PacketTypeLoginStart {
+		return nil, vanillaBadPacketID(minecraft.PhaseLogin, packetID)
+	}
+	if err := checkVanillaUsername(data); err != nil {
+		return nil, err
+	}
+
+	var loginStart c2s.LoginStartPacket
+	if err := version.DecodePacket(&loginStart, data); err != nil {
+		return nil, &vanillaError{
+			Reason: vanillaInternalException(vanillaTruncated),
+			Err:    fmt.Errorf("decode login start: %w", err),
+		}
+	}
 
 	// Валидируем UUID
 	user, valid := s.validator.Validate(loginStart.UUID)
 	if !valid {
-		return nil, fmt.Errorf("invalid user UUID: %s", loginStart.UUID)
+		return nil, &vanillaError{
+			Reason: vanillaNotWhitelisted,
+			Err:    fmt.Errorf("invalid user UUID: %s", loginStart.UUID),
+		}
 	}
 
 	return user, nil
 }
 
+// unsupportedVersionReason возвращает текст отказа, как у vanilla сервера
+// Клиенту новее всех поддерживаемых версий сервер называет самую новую,
+// остальным - версию по умолчанию
+func unsupportedVersionReason(protocol int32) string {
+	latest := minecraft.Profiles[len(minecraft.Profiles)-1]
+	if protocol > latest.Protocol {
+		return fmt.Sprintf(`{"translate":"multiplayer.disconnect.outdated_server","with":["%s"]}`, latest.Name)
+	}
+	return fmt.Sprintf(`{"translate":"multiplayer.disconnect.outdated_client","with":["%s"]}`, minecraft.DefaultProfile.Name)
+}
+
 // AcceptStream ждет новый виртуальный поток от любого подключенного клиента
 // В реальной реализации это нужно доработать для управления потоками от разных клиентов
 func (s *Server) AcceptStream() (net.Conn, error) {
@@ -226,6 +535,10 @@ func (s *Server) Close() error {
 	}
 	s.muxesMu.Unlock()
 
+	if s.query != nil {
+		s.query.Close()
+	}
+
 	return s.listener.Close()
 }
 
@@ -241,9 +554,22 @@ func (s *Server) Addr() string {
 	return s.listener.Addr().String()
 }
 
+// statusSource возвращает источник статуса: из настроек inbound или по умолчанию
+func (s *Server) statusSource() *statusSource {
+	if s.status == nil {
+		return newStatusSource(StatusConfig{})
+	}
+	return s.status
+}
+
+// statusResponse возвращает JSON статуса
+func (s *Server) statusResponse(clientProtocol int32) string {
+	return s.statusSource().response(clientProtocol)
+}
+
 // handleStatusRequest обрабатывает Status Request (Server List Ping)
 // КРИТИЧНО для маскировки под настоящий Minecraft сервер!
-func (s *Server) handleStatusRequest(conn net.Conn) {
+func (s *Server) handleStatusRequest(conn net.Conn, clientProtocol int32) {
 	// 1. Читаем Status Request (Packet ID 0x00, пустой)
 	packetID, _, err := minecraft.ReadPacketRaw(conn)
 	if err != nil || packetID != 0x00 {
@@ -251,11 +577,9 @@ func (s *Server) handleStatusRequest(conn net.Conn) {
 	}
 
 	// 2. Отправляем Status Response с реалистичными данными
-	statusResponse := s2c.NewStatusResponse(
-		"Minecraft Server", // Название сервера
-		20,                 // Max players
-		0,                  // Online players (0 для конспирации)
-	)
+	statusResponse := &s2c.StatusResponsePacket{
+		JSONResponse: s.statusResponse(clientProtocol),
+	}
 
 	if err := minecraft.WritePacket(conn, statusResponse); err != nil {
 		log.Printf("Failed to send status response: %v", err)
@@ -0,0 +1,259 @@
+package transport
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"koria-core/protocol/minecraft"
+	c2s "koria-core/protocol/minecraft/packets/c2s"
+	"koria-core/protocol/minecraft/packets/common"
+	s2c "koria-core/protocol/minecraft/packets/s2c"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMirrorInterval = 5 * time.Minute
+	mirrorDialTimeout     = 5 * time.Second
+	maxStatusSample       = 12 // vanilla показывает не больше 12 игроков
+	onlinePeakHour        = 20 // час пика онлайна (локальное время)
+)
+
+// StatusConfig ответ на Server List Ping
+// Пустые поля заполняются значениями по умолчанию ("A Minecraft Server", 20 слотов)
+type StatusConfig struct {
+	// Description MOTD в виде JSON chat component (например {"text":"..."})
+	Description json.RawMessage
+
+	// VersionName и Protocol поля version ответа (Protocol = 0 - версия по умолчанию, 1.20.4)
+	VersionName string
+	Protocol    int32
+
+	// EchoProtocol отвечает протоколом клиента, если он поддерживается, как прокси вроде
+	// Velocity. Настоящий сервер так не делает, поэтому по умолчанию выключено
+	EchoProtocol bool
+
+	// Favicon готовый data URI ("data:image/png;base64,...")
+	Favicon string
+
+	// MaxPlayers число слотов, OnlineMin и OnlineMax границы суточной кривой онлайна
+	MaxPlayers int
+	OnlineMin  int
+	OnlineMax  int
+
+	// Sample ники, из которых набирается список игроков при наведении на онлайн
+	Sample []string
+
+	// Mirror адрес (host:port) настоящего сервера, чей статус периодически копируется.
+	// Пока копия не получена, отвечаем по остальным полям
+	Mirror         string
+	MirrorInterval time.Duration
+}
+
+// statusSource отдает JSON статуса: собственный или скопированный с настоящего сервера
+type statusSource struct {
+	cfg StatusConfig
+
+	mirrored string
+	mu       sync.RWMutex
+}
+
+func newStatusSource(cfg StatusConfig) *statusSource {
+	if cfg.MaxPlayers <= 0 {
+		cfg.MaxPlayers = 20
+	}
+	if cfg.OnlineMax > cfg.MaxPlayers {
+		cfg.OnlineMax = cfg.MaxPlayers
+	}
+	if cfg.OnlineMin > cfg.OnlineMax {
+		cfg.OnlineMin = cfg.OnlineMax
+	}
+	if len(cfg.Description) == 0 {
+		cfg.Description = json.RawMessage(`{"text":"A Minecraft Server"}`)
+	}
+	if cfg.MirrorInterval <= 0 {
+		cfg.MirrorInterval = defaultMirrorInterval
+	}
+	return &statusSource{cfg: cfg}
+}
+
+// response возвращает JSON для Status Response клиенту с указанным протоколом
+func (s *statusSource) response(clientProtocol int32) string {
+	s.mu.RLock()
+	mirrored := s.mirrored
+	s.mu.RUnlock()
+	if mirrored != "" {
+		return mirrored
+	}
+
+	now := time.Now()
+	online := s.online(now)
+
+	response := s2c.StatusResponse{
+		Version: s.version(clientProtocol),
+		Players: s2c.StatusPlayers{
+			Max:    s.cfg.MaxPlayers,
+			Online: online,
+			Sample: s.sample(online, now),
+		},
+		Description: s.cfg.Description,
+		Favicon:     s.cfg.Favicon,
+	}
+
+	data, _ := json.Marshal(response)
+	return string(data)
+}
+
+// profile возвращает версию, которую сервер объявляет клиенту
+// Одна и та же для всех клиентов, если не включен EchoProtocol
+func (s *statusSource) profile(clientProtocol int32) *minecraft.Profile {
+	if s.cfg.Protocol != 0 {
+		if p, ok := minecraft.ProfileByProtocol(s.cfg.Protocol); ok {
+			return p
+		}
+	} else if s.cfg.EchoProtocol {
+		if p, ok := minecraft.ProfileByProtocol(clientProtocol); ok {
+			return p
+		}
+	}
+	return minecraft.DefaultProfile
+}
+
+// version возвращает поле version ответа
+func (s *statusSource) version(clientProtocol int32) s2c.StatusVersion {
+	profile := s.profile(clientProtocol)
+
+	protocol := profile.Protocol
+	if s.cfg.Protocol != 0 {
+		protocol = s.cfg.Protocol
+	}
+	name := s.cfg.VersionName
+	if name == "" {
+		name = profile.Name
+	}
+	return s2c.StatusVersion{Name: name, Protocol: int(protocol)}
+}
+
+// online считает правдоподобный онлайн: суточная кривая с пиком вечером
+// и небольшим шумом, который меняется раз в минуту (повторный пинг видит то же число)
+func (s *statusSource) online(now time.Time) int {
+	if s.cfg.OnlineMax <= 0 {
+		return 0
+	}
+
+	hour := float64(now.Hour()) + float64(now.Minute())/60
+	level := (1 + math.Cos(2*math.Pi*(hour-onlinePeakHour)/24)) / 2
+
+	spread := float64(s.cfg.OnlineMax - s.cfg.OnlineMin)
+	rng := rand.New(rand.NewSource(now.Unix() / 60))
+	noise := (rng.Float64()*2 - 1) * math.Max(1, spread*0.05)
+
+	online := int(math.Round(float64(s.cfg.OnlineMin) + spread*level + noise))
+	if online < s.cfg.OnlineMin {
+		online = s.cfg.OnlineMin
+	}
+	if online > s.cfg.OnlineMax {
+		online = s.cfg.OnlineMax
+	}
+	return online
+}
+
+// sample выбирает до 12 ников из настроек, но не больше текущего онлайна
+func (s *statusSource) sample(online int, now time.Time) []s2c.StatusPlayerSample {
+	count := len(s.cfg.Sample)
+	if count > online {
+		count = online
+	}
+	if count > maxStatusSample {
+		count = maxStatusSample
+	}
+	if count == 0 {
+		return nil
+	}
+
+	rng := rand.New(rand.NewSource(now.Unix() / 60))
+	sample := make([]s2c.StatusPlayerSample, count)
+	for i, idx := range rng.Perm(len(s.cfg.Sample))[:count] {
+		name := s.cfg.Sample[idx]
+		sample[i] = s2c.StatusPlayerSample{Name: name, ID: offlineUUID(name).String()}
+	}
+	return sample
+}
+
+// offlineUUID UUID игрока в offline-mode: MD5 от "OfflinePlayer:<ник>", версия 3
+func offlineUUID(name string) uuid.UUID {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return uuid.UUID(sum)
+}
+
+// mirrorLoop периодически копирует статус настоящего сервера до закрытия closeCh
+func (s *statusSource) mirrorLoop(closeCh <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.MirrorInterval)
+	defer ticker.Stop()
+
+	for {
+		if status, err := fetchStatus(s.cfg.Mirror); err != nil {
+			log.Printf("Failed to mirror status from %s: %v", s.cfg.Mirror, err)
+		} else {
+			s.mu.Lock()
+			s.mirrored = status
+			s.mu.Unlock()
+		}
+
+		select {
+		case <-closeCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchStatus выполняет Server List Ping к серверу и возвращает JSON его статуса
+func fetchStatus(addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("parse address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("parse port: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, mirrorDialTimeout)
+	if err != nil {
+		return "", fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mirrorDialTimeout))
+
+	handshake := &common.HandshakePacket{
+		ProtocolVersion: minecraft.DefaultProfile.Protocol,
+		ServerAddress:   host,
+		ServerPort:      uint16(port),
+		NextState:       1, // 1 = STATUS state
+	}
+	if err := minecraft.WritePacket(conn, handshake); err != nil {
+		return "", fmt.Errorf("write handshake: %w", err)
+	}
+	if err := minecraft.WritePacket(conn, &c2s.StatusRequestPacket{}); err != nil {
+		return "", fmt.Errorf("write status request: %w", err)
+	}
+
+	var response s2c.StatusResponsePacket
+	if err := minecraft.ReadPacket(conn, &response); err != nil {
+		return "", fmt.Errorf("read status response: %w", err)
+	}
+	if !json.Valid([]byte(response.JSONResponse)) {
+		return "", fmt.Errorf("invalid status JSON")
+	}
+
+	return response.JSONResponse, nil
+}